@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"github.com/Ekliptor/cashwhale/internal/backfill"
+	"github.com/Ekliptor/cashwhale/internal/bch"
+	"github.com/Ekliptor/cashwhale/internal/miner"
+	"github.com/Ekliptor/cashwhale/internal/social"
+	"github.com/Ekliptor/cashwhale/internal/store"
+	"github.com/Ekliptor/cashwhale/internal/watcher"
+	"github.com/Ekliptor/cashwhale/pkg/txcounter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var backfillFlags struct {
+	from       uint32
+	to         uint32
+	publish    bool
+	checkpoint string
+	restart    bool
+}
+
+func init() {
+	BackfillCmd.Flags().Uint32Var(&backfillFlags.from, "from", 0, "first block height to scan")
+	BackfillCmd.Flags().Uint32Var(&backfillFlags.to, "to", 0, "last block height to scan (default is the best block)")
+	BackfillCmd.Flags().BoolVar(&backfillFlags.publish, "publish", false, "publish whales on all enabled publishers (default is to only store them)")
+	BackfillCmd.Flags().StringVar(&backfillFlags.checkpoint, "checkpoint", "backfill.json", "file to store the progress in to resume an interrupted scan")
+	BackfillCmd.Flags().BoolVar(&backfillFlags.restart, "restart", false, "ignore an existing checkpoint and start at --from")
+	BackfillCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(BackfillCmd)
+}
+
+var BackfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Scan a range of historical blocks for Whales",
+	Long: `This command will scan historical blocks for whales and store them in the whale database.
+		It also adds all TX of the average window to the TX counter history.
+		Stop the watch command first because both use the same database and history files.
+		Progress is stored in a checkpoint file, so you can interrupt the scan and run it again to resume.`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		logger, err := getLogger()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go listenExitCommand(logger, cancel)
+
+		counter, err := txcounter.NewTxCounter(getTxCounterConfig(cfg), ctx, logger, nil)
+		if err != nil {
+			return errors.Wrap(err, "error creating TX counter")
+		}
+
+		msgBuilderConfig := getMessageBuilderConfig(cfg)
+		msgBuilderConfig.Publishers.Telegram.PinDailySummary = false // posted by the watch command
+		msgBuilder, err := social.NewMessageBuilder(ctx, msgBuilderConfig, logger, nil)
+		if err != nil {
+			return errors.Wrap(err, "error creating message builder")
+		}
+		if cfg.Store.Enable {
+			whales, err := store.NewWhaleStore(getWhaleStoreConfig(cfg), logger, nil)
+			if err != nil {
+				return errors.Wrap(err, "error opening whale database")
+			}
+			defer whales.Close()
+			msgBuilder.SetRecorder(whales)
+		} else if !backfillFlags.publish {
+			logger.Warnf("Whale database is disabled. Whales will only be added to the TX counter")
+		}
+
+		bch, err := bch.NewBch(ctx, getBchConfig(cfg), logger, nil)
+		if err != nil {
+			return errors.Wrap(err, "error creating BCH client")
+		}
+		watch, err := watcher.NewWatcher(getWatcherConfig(cfg), logger, nil, counter, msgBuilder)
+		if err != nil {
+			return errors.Wrap(err, "error creating watcher")
+		}
+		watch.SetRecordOnly(!backfillFlags.publish)
+		if cfg.Miner.Enable {
+			miners, err := miner.NewMinerTracker(getMinerTrackerConfig(cfg), logger, nil, msgBuilder)
+			if err != nil {
+				return errors.Wrap(err, "error creating miner tracker")
+			}
+			watch.SetMinerTracker(miners)
+		}
+
+		scan, err := backfill.NewBackfill(backfill.BackfillConfig{
+			From:           backfillFlags.from,
+			To:             backfillFlags.to,
+			CheckpointFile: backfillFlags.checkpoint,
+			Restart:        backfillFlags.restart,
+		}, logger, bch, watch)
+		if err != nil {
+			return err
+		}
+		err = scan.Run(ctx)
+
+		// keep the TX history of all scanned blocks, also if we got interrupted
+		if flushErr := counter.Flush(); flushErr != nil {
+			logger.Errorf("Error writing transaction data to disk %+v", flushErr)
+		}
+		return err
+	},
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/config"
 	"github.com/Ekliptor/cashwhale/internal/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -42,13 +43,17 @@ func initConfig() {
 		viper.AddConfigPath(".")
 	}
 
-	viper.SetDefault("Log.Level", "debug")
-	viper.AutomaticEnv()
+	config.SetDefaults(viper.GetViper())
+	config.UseEnv(viper.GetViper())
 
 	if err := viper.ReadInConfig(); err != nil {
 		fmt.Printf("unable to read config: %v\n", err)
 		os.Exit(1)
 	}
+	if err := config.ResolveSecrets(viper.GetViper()); err != nil {
+		fmt.Printf("unable to resolve config secrets: %v\n", err)
+		os.Exit(1)
+	}
 }
 
 func listenExitCommand(logger log.Logger, cancel context.CancelFunc) {
@@ -73,3 +78,8 @@ func listenExitCommand(logger log.Logger, cancel context.CancelFunc) {
 func getLogger() (log.Logger, error) {
 	return log.NewLogger(log.NewConfig(viper.GetViper()), log.DefaultLogger)
 }
+
+// Validates the config and returns the typed settings.
+func loadConfig() (*config.Config, error) {
+	return config.Load(viper.GetViper())
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"github.com/Ekliptor/cashwhale/internal/bch"
+	"github.com/Ekliptor/cashwhale/internal/bch/network"
+	"github.com/Ekliptor/cashwhale/internal/config"
+	"github.com/Ekliptor/cashwhale/internal/miner"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/internal/social"
+	"github.com/Ekliptor/cashwhale/internal/store"
+	"github.com/Ekliptor/cashwhale/internal/watcher"
+	"github.com/Ekliptor/cashwhale/pkg/notification"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"github.com/Ekliptor/cashwhale/pkg/txcounter"
+	"time"
+)
+
+// The config structs of all components created from the typed config. cmd is the only package reading config.yaml.
+
+func getTxCounterConfig(cfg *config.Config) *txcounter.TxCounterConfig {
+	return &txcounter.TxCounterConfig{
+		AverageTime:     time.Duration(cfg.Average.TransactionAverageTimeH) * time.Hour,
+		CleanupInterval: time.Duration(cfg.Average.AverageTxCleanupTimeMin) * time.Minute,
+		HistoryFile:     cfg.Average.TxHistoryFile,
+		UpperTxPercent:  cfg.Average.UpperTxPercent,
+	}
+}
+
+// txCounterMonitor reports the statistics of the TX counter to the monitoring server.
+type txCounterMonitor struct {
+	*monitoring.HttpMonitoring
+}
+
+func (m txCounterMonitor) Gauge(name string, help string) txcounter.Gauge {
+	return m.Metrics().Gauge(name, help)
+}
+
+func getTxCounterMonitor(monitor *monitoring.HttpMonitoring) txcounter.Monitor {
+	if monitor == nil {
+		return nil // monitoring disabled
+	}
+	return txCounterMonitor{monitor}
+}
+
+func getMessageBuilderConfig(cfg *config.Config) social.MessageBuilderConfig {
+	return social.MessageBuilderConfig{
+		Text:          cfg.Message.Text,
+		BlockExplorer: cfg.Message.BlockExplorer,
+		FiatCurrency:  cfg.Message.FiatCurrency,
+		Network:       cfg.BCH.Network,
+		PriceAPI: price.PriceAPIConfig{
+			URLs:    cfg.Price.API,
+			Timeout: time.Duration(cfg.HTTP.RequestTimeoutSec) * time.Second,
+		},
+		PriceUpdateInterval: time.Duration(cfg.Price.UpdateIntervalMin) * time.Minute,
+		StreamReplay:        cfg.Monitoring.StreamReplay,
+		Publishers:          getPublishersConfig(cfg),
+	}
+}
+
+func getPublishersConfig(cfg *config.Config) social.PublishersConfig {
+	return social.PublishersConfig{
+		TwitterEnable: cfg.Twitter.Enable,
+		Twitter: social.TwitterClientConfig{
+			ConsumerKey:    cfg.Twitter.ConsumerKey,
+			ConsumerSecret: cfg.Twitter.ConsumerSecret,
+			AccessToken:    cfg.Twitter.AccessToken,
+			AccessSecret:   cfg.Twitter.AccessSecret,
+		},
+		TelegramEnable: cfg.Telegram.Enable,
+		Telegram: social.TelegramPublisherConfig{
+			Token:           cfg.Telegram.Token,
+			Channel:         cfg.Telegram.Channel,
+			Text:            cfg.Telegram.Text,
+			PinDailySummary: cfg.Telegram.PinDailySummary,
+			Symbol:          getNetwork(cfg).Symbol,
+			Timeout:         time.Duration(cfg.HTTP.RequestTimeoutSec) * time.Second,
+		},
+	}
+}
+
+func getWatcherConfig(cfg *config.Config) watcher.WatcherConfig {
+	return watcher.WatcherConfig{
+		Thresholds: getThresholds(cfg),
+		Classifier: watcher.ClassifierConfig{
+			ConsolidationMinInputs:    cfg.Classifier.ConsolidationMinInputs,
+			BatchMinOutputs:           cfg.Classifier.BatchMinOutputs,
+			CoinJoinMinEqualOutputs:   cfg.Classifier.CoinJoinMinEqualOutputs,
+			PeelChainMinChangePercent: cfg.Classifier.PeelChainMinChangePercent,
+		},
+		RuleTypes:      getRuleTypes(cfg),
+		Notify:         cfg.Notify,
+		Notifier:       getNotifierConfig(cfg),
+		TweetThreshold: time.Duration(cfg.Monitoring.TweetThresholdH) * time.Hour,
+	}
+}
+
+func getThresholds(cfg *config.Config) watcher.Thresholds {
+	return watcher.Thresholds{
+		WhaleBch:       cfg.Message.WahleThresholdBCH,
+		UpperTxPercent: cfg.Average.UpperTxPercent,
+		MinTxCount:     cfg.Average.MinTxCount,
+	}
+}
+
+// Returns the TX types per rule name.
+func getRuleTypes(cfg *config.Config) map[string]*watcher.RuleTypes {
+	toTypes := func(names []string) []watcher.TxType {
+		txTypes := make([]watcher.TxType, len(names))
+		for i, name := range names {
+			txTypes[i] = watcher.TxType(name)
+		}
+		return txTypes
+	}
+	ruleTypes := make(map[string]*watcher.RuleTypes, len(cfg.Classifier.Rules))
+	for rule, types := range cfg.Classifier.Rules {
+		if types == nil {
+			continue
+		}
+		ruleTypes[rule] = &watcher.RuleTypes{
+			Include: toTypes(types.Include),
+			Exclude: toTypes(types.Exclude),
+		}
+	}
+	return ruleTypes
+}
+
+func getNotifierConfig(cfg *config.Config) notification.NotifierConfig {
+	return notification.NotifierConfig{
+		AppName:        cfg.App.Name,
+		Timeout:        time.Duration(cfg.HTTP.RequestTimeoutSec) * time.Second,
+		ConnectTimeout: time.Duration(cfg.Email.ConnectTimeoutSec) * time.Second,
+	}
+}
+
+func getBchConfig(cfg *config.Config) bch.BchConfig {
+	return bch.BchConfig{
+		Nodes:           cfg.BCH.Nodes,
+		Network:         cfg.BCH.Network,
+		MaxBlockAge:     time.Duration(cfg.Monitoring.MaxBlockAgeMin) * time.Minute,
+		MempoolInterval: time.Duration(cfg.BCH.MempoolPollSec) * time.Second,
+	}
+}
+
+// Returns the network of the config. The network name is validated when loading the config.
+func getNetwork(cfg *config.Config) *network.Network {
+	chain, err := network.Get(cfg.BCH.Network)
+	if err != nil {
+		chain, _ = network.Get(network.MAINNET)
+	}
+	return chain
+}
+
+func getMinerTrackerConfig(cfg *config.Config) miner.MinerTrackerConfig {
+	pools := make([]*miner.Pool, 0, len(cfg.Miner.Pools))
+	for _, pool := range cfg.Miner.Pools {
+		pools = append(pools, &miner.Pool{
+			Name:      pool.Name,
+			Tags:      pool.Tags,
+			Addresses: pool.Addresses,
+		})
+	}
+	return miner.MinerTrackerConfig{
+		AnnounceBlocks:     cfg.Miner.AnnounceBlocks,
+		BlockText:          cfg.Miner.BlockText,
+		PayoutText:         cfg.Miner.PayoutText,
+		PayoutThresholdBch: cfg.Miner.PayoutThresholdBCH,
+		Pools:              pools,
+	}
+}
+
+func getWhaleStoreConfig(cfg *config.Config) store.WhaleStoreConfig {
+	return store.WhaleStoreConfig{
+		Path: cfg.Store.Path,
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/config"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func init() {
+	ConfigCmd.AddCommand(ConfigValidateCmd)
+	ConfigCmd.AddCommand(ConfigPrintCmd)
+	rootCmd.AddCommand(ConfigCmd)
+}
+
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Validate or print the config",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var ConfigValidateCmd = &cobra.Command{
+	Use:          "validate",
+	Short:        "Check the config file for invalid and missing settings",
+	SilenceUsage: true,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, err := loadConfig()
+		if errs, ok := err.(config.ValidationErrors); ok {
+			for _, validationErr := range errs {
+				fmt.Println(validationErr.Error())
+			}
+			return errors.Errorf("%s has %d invalid settings", configFile, len(errs))
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("%s is valid\n", configFile)
+		return nil
+	},
+}
+
+var ConfigPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Print the effective config including defaults with secrets masked",
+	Long: `This command will print the config file merged with defaults and environment variables as JSON.
+		All secrets such as passwords and tokens are masked.`,
+	SilenceUsage: true,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := loadConfig()
+		if errs, ok := err.(config.ValidationErrors); ok {
+			fmt.Fprintf(os.Stderr, "Warning: %s has %d invalid settings (run 'config validate' for details)\n", configFile, len(errs))
+		} else if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(settings.Masked(), "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "error encoding config")
+		}
+		fmt.Println(string(data))
+		return nil
+	},
+}
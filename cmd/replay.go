@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/bch"
+	"github.com/Ekliptor/cashwhale/internal/config"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/miner"
+	"github.com/Ekliptor/cashwhale/internal/replay"
+	"github.com/Ekliptor/cashwhale/internal/social"
+	"github.com/Ekliptor/cashwhale/internal/watcher"
+	"github.com/Ekliptor/cashwhale/pkg/txcounter"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+)
+
+var replayFlags struct {
+	fixture string
+	from    uint32
+	to      uint32
+	save    string
+	compare string
+	price   float32
+}
+
+func init() {
+	ReplayCmd.Flags().StringVar(&replayFlags.fixture, "fixture", "", "fixture file with recorded blocks to replay (instead of --from and --to)")
+	ReplayCmd.Flags().Uint32Var(&replayFlags.from, "from", 0, "first block height to replay from the node")
+	ReplayCmd.Flags().Uint32Var(&replayFlags.to, "to", 0, "last block height to replay from the node (default is the best block)")
+	ReplayCmd.Flags().StringVar(&replayFlags.save, "save", "", "save the blocks of --from and --to as fixture file")
+	ReplayCmd.Flags().StringVar(&replayFlags.compare, "compare", "", "config file with changed settings to compare alerts with (only changed keys are needed)")
+	ReplayCmd.Flags().Float32Var(&replayFlags.price, "price", 0, "fixed BCH price for all messages (default is the current price)")
+	rootCmd.AddCommand(ReplayCmd)
+}
+
+var ReplayCmd = &cobra.Command{
+	Use:     "replay",
+	Aliases: []string{"simulate"},
+	Short:   "Replay recorded blocks and print the messages that would have been posted",
+	Long: `This command will run recorded blocks through the whale watcher without publishing anything.
+		Blocks are read from a fixture file or fetched from the node by height.
+		With --compare the blocks are replayed a 2nd time with the settings of another config
+		file merged on top of the current config, and all different alerts are printed.`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		logger, err := getLogger()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var blocks []*replay.ReplayBlock
+		if len(replayFlags.fixture) != 0 {
+			blocks, err = replay.LoadFixture(replayFlags.fixture)
+		} else if cmd.Flags().Changed("from") {
+			blocks, err = fetchReplayBlocks(ctx, cfg, logger)
+		} else {
+			return errors.New("either --fixture or --from is required")
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("=== Replaying %d blocks with config A\n\n", len(blocks))
+		alertsA, err := replayBlocks(ctx, cfg, logger, blocks)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("=== %d alerts with config A\n", len(alertsA))
+		if len(replayFlags.compare) == 0 {
+			return nil
+		}
+
+		viper.SetConfigFile(replayFlags.compare)
+		if err = viper.MergeInConfig(); err != nil {
+			return errors.Wrap(err, "error reading config to compare")
+		} else if err = config.ResolveSecrets(viper.GetViper()); err != nil {
+			return err
+		}
+		cfgB, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\n=== Replaying %d blocks with config B (%s)\n\n", len(blocks), replayFlags.compare)
+		alertsB, err := replayBlocks(ctx, cfgB, logger, blocks)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("=== %d alerts with config B\n\n", len(alertsB))
+		replay.Compare(alertsA, alertsB).Write(os.Stdout)
+		return nil
+	},
+}
+
+func fetchReplayBlocks(ctx context.Context, cfg *config.Config, logger log.Logger) ([]*replay.ReplayBlock, error) {
+	bch, err := bch.NewBch(ctx, getBchConfig(cfg), logger, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating BCH client")
+	}
+	blocks, err := replay.FetchBlocks(bch, replayFlags.from, replayFlags.to)
+	if err != nil {
+		return nil, err
+	}
+	if len(replayFlags.save) != 0 {
+		if err = replay.SaveFixture(replayFlags.save, blocks); err != nil {
+			return nil, err
+		}
+		logger.Infof("Saved %d blocks to fixture %s", len(blocks), replayFlags.save)
+	}
+	return blocks, nil
+}
+
+// Runs the blocks through a new watcher with the config and returns the alerts
+// of the dry run publisher.
+func replayBlocks(ctx context.Context, cfg *config.Config, logger log.Logger, blocks []*replay.ReplayBlock) ([]*replay.Alert, error) {
+	// never publish, start with an empty TX history for reproducible results
+	counterConfig := getTxCounterConfig(cfg)
+	counterConfig.HistoryFile = ""
+	msgBuilderConfig := getMessageBuilderConfig(cfg)
+	msgBuilderConfig.Publishers = social.PublishersConfig{}
+
+	counter, err := txcounter.NewTxCounter(counterConfig, ctx, logger, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating TX counter")
+	}
+	msgBuilder, err := social.NewMessageBuilder(ctx, msgBuilderConfig, logger, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating message builder")
+	}
+	if replayFlags.price > 0.0 {
+		msgBuilder.SetFixedRate(replayFlags.price)
+	}
+	dryRun := social.NewDryRunPublisher(os.Stdout)
+	msgBuilder.AddPublisher(dryRun)
+
+	watch, err := watcher.NewWatcher(getWatcherConfig(cfg), logger, nil, counter, msgBuilder)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating watcher")
+	}
+	if cfg.Miner.Enable {
+		miners, err := miner.NewMinerTracker(getMinerTrackerConfig(cfg), logger, nil, msgBuilder)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating miner tracker")
+		}
+		watch.SetMinerTracker(miners)
+	}
+	replay.Replay(blocks, watch)
+	return replay.NewAlerts(dryRun.GetPublished()), nil
+}
@@ -2,16 +2,20 @@ package cmd
 
 import (
 	"context"
+	"github.com/Ekliptor/cashwhale/internal/admin"
 	"github.com/Ekliptor/cashwhale/internal/bch"
+	"github.com/Ekliptor/cashwhale/internal/config"
+	"github.com/Ekliptor/cashwhale/internal/dashboard"
 	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/miner"
 	monitoring "github.com/Ekliptor/cashwhale/internal/monitoring"
 	"github.com/Ekliptor/cashwhale/internal/social"
+	"github.com/Ekliptor/cashwhale/internal/store"
 	"github.com/Ekliptor/cashwhale/internal/watcher"
 	"github.com/Ekliptor/cashwhale/pkg/txcounter"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"sync"
-	"time"
 )
 
 func init() {
@@ -22,9 +26,15 @@ var WatchCmd = &cobra.Command{
 	Use:   "watch",
 	Short: "Watch for Whales on the BitcoinCash network",
 	Long: `This command will watch for large amounts of BCH being transferred on-chain.
-		It will then tweet about these transactions.`,
+		It will then tweet about these transactions.
+		Changes of the config file (or SIGHUP) reload thresholds, TX types of rules, message templates, publishers and
+		notification receivers without restarting. Invalid configs are rejected.`,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
 		logger, err := getLogger()
 		if err != nil {
 			return err
@@ -34,7 +44,7 @@ var WatchCmd = &cobra.Command{
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 		go listenExitCommand(logger, cancel)
-		monitor := createMonitoringClient(ctx, logger)
+		monitor := createMonitoringClient(cfg, logger)
 
 		// start all main workers in separate goroutines
 		var wg sync.WaitGroup
@@ -48,9 +58,7 @@ var WatchCmd = &cobra.Command{
 		}
 
 		// create the avg TX size counter
-		counter, err := txcounter.NewTxCounter(&txcounter.TxCounterConfig{
-			AverageTime: time.Duration(viper.GetInt("Average.TransactionAverageTimeH")) * time.Hour,
-		}, ctx, logger, monitor)
+		counter, err := txcounter.NewTxCounter(getTxCounterConfig(cfg), ctx, logger, getTxCounterMonitor(monitor))
 		if err != nil {
 			logger.Fatalf("Error creating TX counter: %+v", err)
 		}
@@ -61,7 +69,7 @@ var WatchCmd = &cobra.Command{
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			watchTransactionsRest(counter, ctx, logger, monitor)
+			watchTransactionsRest(cfg, counter, ctx, logger, monitor)
 		}()
 
 		wg.Wait()
@@ -76,32 +84,72 @@ var WatchCmd = &cobra.Command{
 	},
 }
 
-func watchTransactionsRest(counter *txcounter.TxCounter, ctx context.Context, logger log.Logger, monitor *monitoring.HttpMonitoring) {
-	msgBuilder := social.NewMessageBuilder(logger)
-	bch, err := bch.NewBch(ctx, logger)
+func watchTransactionsRest(cfg *config.Config, counter *txcounter.TxCounter, ctx context.Context, logger log.Logger, monitor *monitoring.HttpMonitoring) {
+	msgBuilder, err := social.NewMessageBuilder(ctx, getMessageBuilderConfig(cfg), logger, monitor)
+	if err != nil {
+		logger.Fatalf("Error creating message builder: %+v", err)
+	}
+	if cfg.Store.Enable {
+		whales, err := store.NewWhaleStore(getWhaleStoreConfig(cfg), logger, monitor)
+		if err != nil {
+			logger.Fatalf("Error opening whale database: %+v", err)
+		}
+		defer whales.Close()
+		msgBuilder.SetRecorder(whales)
+	}
+	bch, err := bch.NewBch(ctx, getBchConfig(cfg), logger, monitor)
 	if err != nil {
 		logger.Fatalf("Error creating BCH client: %+v", err)
 	}
 	bch.StartNodeTimer()
 
-	watch, err := watcher.NewWatcher(logger, monitor, counter, msgBuilder)
+	watch, err := watcher.NewWatcher(getWatcherConfig(cfg), logger, monitor, counter, msgBuilder)
 	if err != nil {
 		logger.Fatalf("Error creating watcher: %+v", err)
 	}
+	if cfg.Miner.Enable {
+		miners, err := miner.NewMinerTracker(getMinerTrackerConfig(cfg), logger, monitor, msgBuilder)
+		if err != nil {
+			logger.Fatalf("Error creating miner tracker: %+v", err)
+		}
+		watch.SetMinerTracker(miners)
+	}
+	if monitor != nil && cfg.Monitoring.Dashboard {
+		dashboard.NewDashboard(dashboard.DashboardConfig{}, logger, monitor, counter, watch, msgBuilder)
+	}
+	if cfg.Admin.Enable {
+		_, err = admin.NewAdmin(admin.AdminConfig{Path: cfg.Admin.Path}, logger, monitor, msgBuilder, watch, counter, bch)
+		if err != nil {
+			logger.Fatalf("Error creating admin API: %+v", err)
+		}
+	}
+
+	reloader, err := config.NewReloader(viper.ConfigFileUsed(), cfg, logger, monitor)
+	if err != nil {
+		logger.Fatalf("Error creating config reloader: %+v", err)
+	}
+	addReloadHandlers(reloader, msgBuilder, watch)
+	go reloader.Run(ctx)
 
 	blockCh, err := bch.WatchNewBlocks(ctx)
 	if err != nil {
 		logger.Fatalf("Error watching new blocks: %+v", err)
 	}
+	mempoolCh := bch.WatchMempool(ctx) // nil if disabled
 
 	terminating := false
 	for !terminating {
 		select {
-		case block := <-blockCh:
-			for _, tx := range block.Tx {
-				watch.CheckTransaction(&tx)
+		case chunk := <-blockCh:
+			watch.CheckTransactions(chunk.Tx)
+			if chunk.Aborted {
+				logger.Warnf("Skipped the rest of block %d", chunk.Height)
+			} else if chunk.Last {
+				watch.BlockChecked()
 			}
-			watch.CheckLastTweetTime()
+
+		case txs := <-mempoolCh:
+			watch.CheckUnconfirmedTransactions(txs)
 
 		case <-ctx.Done():
 			terminating = true
@@ -109,6 +157,46 @@ func watchTransactionsRest(counter *txcounter.TxCounter, ctx context.Context, lo
 	}
 }
 
+// Applies the reloadable settings of a changed config file to the running components.
+// Only thresholds can change at runtime (via admin API), so the other settings are restored
+// from the previous config if a reload fails.
+func addReloadHandlers(reloader *config.Reloader, msgBuilder *social.MessageBuilder, watch *watcher.Watcher) {
+	reloader.OnReload(func(previous *config.Config, next *config.Config) (func() error, error) {
+		return func() error {
+			return msgBuilder.SetPublishers(getPublishersConfig(previous)) // keeps paused publishers
+		}, msgBuilder.SetPublishers(getPublishersConfig(next))
+	})
+	reloader.OnReload(func(previous *config.Config, next *config.Config) (func() error, error) {
+		if previous.Message.Text == next.Message.Text && previous.Message.BlockExplorer == next.Message.BlockExplorer {
+			return nil, nil
+		}
+		return func() error {
+			return msgBuilder.SetTemplate(previous.Message.Text, previous.Message.BlockExplorer)
+		}, msgBuilder.SetTemplate(next.Message.Text, next.Message.BlockExplorer)
+	})
+	reloader.OnReload(func(previous *config.Config, next *config.Config) (func() error, error) {
+		if getThresholds(previous) == getThresholds(next) {
+			return nil, nil // keep thresholds changed via admin API
+		}
+		live := watch.GetThresholds()
+		return func() error {
+			return watch.SetThresholds(live)
+		}, watch.SetThresholds(getThresholds(next))
+	})
+	reloader.OnReload(func(previous *config.Config, next *config.Config) (func() error, error) {
+		return func() error {
+			return watch.SetRuleTypes(getRuleTypes(previous))
+		}, watch.SetRuleTypes(getRuleTypes(next))
+	})
+	reloader.OnReload(func(previous *config.Config, next *config.Config) (func() error, error) {
+		watch.SetNotifyReceivers(next.Notify)
+		return func() error {
+			watch.SetNotifyReceivers(previous.Notify)
+			return nil
+		}, nil
+	})
+}
+
 /*
 func watchTransactions(counter *txcounter.TxCounter, ctx context.Context, logger log.Logger, monitor *monitoring.HttpMonitoring) {
 	client, err := bchd.NewGrpcClient(logger, monitor, counter)
@@ -148,15 +236,20 @@ func watchTransactions(counter *txcounter.TxCounter, ctx context.Context, logger
 }
 */
 
-func createMonitoringClient(ctx context.Context, logger log.Logger) *monitoring.HttpMonitoring {
-	if viper.GetBool("Monitoring.Enable") == false {
+func createMonitoringClient(cfg *config.Config, logger log.Logger) *monitoring.HttpMonitoring {
+	if cfg.Monitoring.Enable == false {
 		return nil
 	}
 
 	monitor, err := monitoring.NewHttpMonitoring(monitoring.HttpMonitoringConfig{
-		HttpListenAddress: viper.GetString("Monitoring.Address"),
+		HttpListenAddress: cfg.Monitoring.Address,
+		EventHistory:      cfg.Monitoring.EventHistory,
+		TLSCertFile:       cfg.Monitoring.TLSCertFile,
+		TLSKeyFile:        cfg.Monitoring.TLSKeyFile,
+		Auth:              cfg.Monitoring.Auth,
 		Events: []string{
-			"LastTweet", "TxCount", "TxAvgBch", "TxUpperPercentBch",
+			"LastTweet", "TxCount", "TxAvgBch", "TxUpperPercentBch", admin.AdminActionEvent, config.ConfigReloadEvent,
+			miner.LastBlockMinedEvent,
 		},
 	}, logger)
 	if err != nil {
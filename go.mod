@@ -1,18 +1,21 @@
 module github.com/Ekliptor/cashwhale
 
-go 1.14
+go 1.16
 
 require (
 	github.com/checksum0/go-electrum v0.0.0-20220912200153-b862ac442cf9
 	github.com/dghubble/go-twitter v0.0.0-20190719072343-39e5462e111f
 	github.com/dghubble/oauth1 v0.6.0
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/gcash/bchd v0.19.0
 	github.com/gcash/bchutil v0.0.0-20210113190856-6ea28dff4000
 	github.com/golang/protobuf v1.5.2
+	github.com/gorilla/websocket v1.4.2
 	github.com/pkg/errors v0.9.1
 	github.com/prompt-cash/go-bitcoin v0.3.0
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/viper v1.7.1
+	go.etcd.io/bbolt v1.3.5
 	go.uber.org/zap v1.16.0
 	golang.org/x/text v0.3.6
 	google.golang.org/grpc v1.38.0
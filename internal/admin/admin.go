@@ -0,0 +1,254 @@
+package admin
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/internal/watcher"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+)
+
+// The name of the monitoring event emitted for every admin action.
+const AdminActionEvent = "AdminAction"
+
+// Publishers controls publishing whale messages (implemented by social.MessageBuilder).
+type Publishers interface {
+	SetPublisherPaused(name string, paused bool) error
+	ResendTransaction(txHash string) error
+	SuppressTransaction(txHash string)
+}
+
+// Rules holds the thresholds to identify whales (implemented by watcher.Watcher).
+type Rules interface {
+	GetThresholds() watcher.Thresholds
+	SetThresholds(thresholds watcher.Thresholds) error
+}
+
+// TxCounter keeps the TX history of dynamic thresholds (implemented by txcounter.TxCounter).
+type TxCounter interface {
+	Flush() error
+}
+
+// Nodes is the pool of BCH nodes (implemented by bch.Bch).
+type Nodes interface {
+	Failover(address string) (string, error)
+}
+
+// Admin serves authenticated endpoints on the monitoring server to control the running bot.
+// Changes are kept in memory until the next restart.
+type Admin struct {
+	config  AdminConfig
+	logger  log.Logger
+	monitor *monitoring.HttpMonitoring
+
+	publishers Publishers
+	rules      Rules
+	counter    TxCounter
+	nodes      Nodes
+}
+
+type AdminConfig struct {
+	Path string // the HTTP path prefix of all admin routes - defaults to "/admin"
+}
+
+type publisherRequest struct {
+	Publisher string `json:"publisher"`
+}
+
+// ThresholdsRequest changes the thresholds. Omitted values are kept.
+type ThresholdsRequest struct {
+	WhaleBch       *float64 `json:"whale_bch"`
+	UpperTxPercent *float64 `json:"upper_tx_percent"`
+	MinTxCount     *int     `json:"min_tx_count"`
+}
+
+type txRequest struct {
+	TxID string `json:"txid"`
+}
+
+type failoverRequest struct {
+	Address string `json:"address"` // empty for the next node
+}
+
+// NewAdmin registers the admin routes on the monitoring server.
+// It returns an error if the routes are not protected by credentials.
+func NewAdmin(config AdminConfig, logger log.Logger, monitor *monitoring.HttpMonitoring, publishers Publishers, rules Rules, counter TxCounter, nodes Nodes) (*Admin, error) {
+	if len(config.Path) == 0 {
+		config.Path = "/admin"
+	}
+	config.Path = strings.TrimSuffix(config.Path, "/")
+	if monitor == nil {
+		return nil, errors.New("the admin API requires monitoring to be enabled")
+	} else if !monitor.RequiresAuth(config.Path + "/") {
+		return nil, errors.Errorf("the admin API requires credentials for %s in Monitoring.Auth", config.Path)
+	}
+
+	admin := &Admin{
+		config: config,
+		logger: logger.WithFields(log.Fields{
+			"module": "admin",
+		}),
+		monitor:    monitor,
+		publishers: publishers,
+		rules:      rules,
+		counter:    counter,
+		nodes:      nodes,
+	}
+	admin.handle("/publishers/pause", admin.pausePublisher)
+	admin.handle("/publishers/resume", admin.resumePublisher)
+	admin.handle("/thresholds", admin.setThresholds)
+	admin.handle("/tx/resend", admin.resendTransaction)
+	admin.handle("/tx/suppress", admin.suppressTransaction)
+	admin.handle("/txcounter/flush", admin.flushTxCounter)
+	admin.handle("/nodes/failover", admin.failover)
+	return admin, nil
+}
+
+// An admin action with the request body parsed. It returns the result to respond with.
+type adminAction func(body json.RawMessage) (interface{}, error)
+
+// Register a POST route. Every call is logged and emitted as event.
+func (a *Admin) handle(path string, action adminAction) {
+	name := strings.TrimPrefix(path, "/")
+	fullPath := a.config.Path + path
+	a.monitor.HandleFunc(fullPath, func(writer http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != fullPath {
+			a.monitor.RespondJSON(writer, http.StatusNotFound, "not found")
+			return
+		} else if req.Method != "POST" {
+			a.monitor.RespondJSON(writer, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+
+		var body json.RawMessage
+		if req.ContentLength != 0 {
+			if err := json.NewDecoder(http.MaxBytesReader(writer, req.Body, 64*1024)).Decode(&body); err != nil {
+				a.monitor.RespondJSON(writer, http.StatusBadRequest, "invalid JSON body")
+				return
+			}
+		}
+
+		result, err := action(body)
+		event := monitoring.D{
+			"action": name,
+			"params": body,
+			"remote": req.RemoteAddr,
+		}
+		if err != nil {
+			event["error"] = err.Error()
+			a.logger.Warnf("Admin action %s from %s failed: %v", name, req.RemoteAddr, err)
+			a.monitor.AddEvent(AdminActionEvent, event)
+			a.monitor.RespondJSON(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+		event["result"] = result
+		a.logger.Infof("Admin action %s from %s: %s", name, req.RemoteAddr, string(body))
+		a.monitor.AddEvent(AdminActionEvent, event)
+		a.monitor.RespondJSON(writer, http.StatusOK, result)
+	})
+}
+
+func (a *Admin) pausePublisher(body json.RawMessage) (interface{}, error) {
+	return a.setPublisherPaused(body, true)
+}
+
+func (a *Admin) resumePublisher(body json.RawMessage) (interface{}, error) {
+	return a.setPublisherPaused(body, false)
+}
+
+func (a *Admin) setPublisherPaused(body json.RawMessage, paused bool) (interface{}, error) {
+	var req publisherRequest
+	if err := unmarshalBody(body, &req); err != nil {
+		return nil, err
+	} else if len(req.Publisher) == 0 {
+		return nil, errors.New("publisher is required")
+	}
+	if err := a.publishers.SetPublisherPaused(req.Publisher, paused); err != nil {
+		return nil, err
+	}
+	return monitoring.D{"publisher": req.Publisher, "paused": paused}, nil
+}
+
+func (a *Admin) setThresholds(body json.RawMessage) (interface{}, error) {
+	var req ThresholdsRequest
+	if err := unmarshalBody(body, &req); err != nil {
+		return nil, err
+	}
+	thresholds := a.rules.GetThresholds()
+	if req.WhaleBch != nil {
+		thresholds.WhaleBch = *req.WhaleBch
+	}
+	if req.UpperTxPercent != nil {
+		thresholds.UpperTxPercent = *req.UpperTxPercent
+	}
+	if req.MinTxCount != nil {
+		thresholds.MinTxCount = *req.MinTxCount
+	}
+	if err := a.rules.SetThresholds(thresholds); err != nil {
+		return nil, err
+	}
+	return thresholds, nil
+}
+
+func (a *Admin) resendTransaction(body json.RawMessage) (interface{}, error) {
+	txID, err := parseTxID(body)
+	if err != nil {
+		return nil, err
+	}
+	if err = a.publishers.ResendTransaction(txID); err != nil {
+		return nil, err
+	}
+	return monitoring.D{"txid": txID, "resent": true}, nil
+}
+
+func (a *Admin) suppressTransaction(body json.RawMessage) (interface{}, error) {
+	txID, err := parseTxID(body)
+	if err != nil {
+		return nil, err
+	}
+	a.publishers.SuppressTransaction(txID)
+	return monitoring.D{"txid": txID, "suppressed": true}, nil
+}
+
+func (a *Admin) flushTxCounter(body json.RawMessage) (interface{}, error) {
+	if err := a.counter.Flush(); err != nil {
+		return nil, err
+	}
+	return monitoring.D{"flushed": true}, nil
+}
+
+func (a *Admin) failover(body json.RawMessage) (interface{}, error) {
+	var req failoverRequest
+	if err := unmarshalBody(body, &req); err != nil {
+		return nil, err
+	}
+	address, err := a.nodes.Failover(req.Address)
+	if err != nil {
+		return nil, err
+	}
+	return monitoring.D{"node": address}, nil
+}
+
+func unmarshalBody(body json.RawMessage, v interface{}) error {
+	if len(body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return errors.Wrap(err, "invalid request")
+	}
+	return nil
+}
+
+func parseTxID(body json.RawMessage) (string, error) {
+	var req txRequest
+	if err := unmarshalBody(body, &req); err != nil {
+		return "", err
+	}
+	if _, err := hex.DecodeString(req.TxID); err != nil || len(req.TxID) != 64 {
+		return "", errors.New("txid must be a 64 character hex string")
+	}
+	return strings.ToLower(req.TxID), nil
+}
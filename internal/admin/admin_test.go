@@ -0,0 +1,150 @@
+package admin
+
+import (
+	"encoding/json"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/internal/watcher"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testTxID = "a5f3b8bb0c2d4cf6d7e60e0f7d3f9c6b0e8a1b2c3d4e5f60718293a4b5c6d7e8"
+
+type testBot struct {
+	paused     map[string]bool
+	resent     []string
+	suppressed []string
+	thresholds watcher.Thresholds
+	flushed    int
+	failover   string
+}
+
+func (b *testBot) SetPublisherPaused(name string, paused bool) error {
+	if name != "twitter" {
+		return errors.Errorf("unknown publisher %s", name)
+	}
+	b.paused[name] = paused
+	return nil
+}
+
+func (b *testBot) ResendTransaction(txHash string) error {
+	b.resent = append(b.resent, txHash)
+	return nil
+}
+
+func (b *testBot) SuppressTransaction(txHash string) {
+	b.suppressed = append(b.suppressed, txHash)
+}
+
+func (b *testBot) GetThresholds() watcher.Thresholds {
+	return b.thresholds
+}
+
+func (b *testBot) SetThresholds(thresholds watcher.Thresholds) error {
+	if thresholds.WhaleBch <= 0 {
+		return errors.New("whale threshold must be positive")
+	}
+	b.thresholds = thresholds
+	return nil
+}
+
+func (b *testBot) Flush() error {
+	b.flushed++
+	return nil
+}
+
+func (b *testBot) Failover(address string) (string, error) {
+	b.failover = address
+	return "node2:8332", nil
+}
+
+func newTestAdmin(t *testing.T, auth monitoring.HttpAuthConfig) (*monitoring.HttpMonitoring, *testBot, error) {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	monitor, err := monitoring.NewHttpMonitoring(monitoring.HttpMonitoringConfig{
+		Events: []string{AdminActionEvent},
+		Auth:   auth,
+	}, logger)
+	if err != nil {
+		t.Fatalf("Error creating monitoring: %+v", err)
+	}
+	bot := &testBot{
+		paused:     make(map[string]bool),
+		thresholds: watcher.Thresholds{WhaleBch: 20000, UpperTxPercent: 0.1, MinTxCount: 1000},
+	}
+	_, err = NewAdmin(AdminConfig{}, logger, monitor, bot, bot, bot, bot)
+	return monitor, bot, err
+}
+
+func postAdmin(monitor *monitoring.HttpMonitoring, path string, body string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestAdminRequiresAuth(t *testing.T) {
+	if _, _, err := newTestAdmin(t, monitoring.HttpAuthConfig{}); err == nil {
+		t.Errorf("Expected error creating admin API without credentials")
+	}
+}
+
+func TestAdminActions(t *testing.T) {
+	monitor, bot, err := newTestAdmin(t, monitoring.HttpAuthConfig{Tokens: []string{"token"}})
+	if err != nil {
+		t.Fatalf("Error creating admin API: %+v", err)
+	}
+
+	if res := postAdmin(monitor, "/admin/publishers/pause", `{"publisher":"twitter"}`, "wrong"); res.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unauthorized, got %d", res.Code)
+	}
+	tests := []struct {
+		path     string
+		body     string
+		expected int
+	}{
+		{"/admin/publishers/pause", `{"publisher":"twitter"}`, http.StatusOK},
+		{"/admin/publishers/pause", `{"publisher":"myspace"}`, http.StatusBadRequest},
+		{"/admin/thresholds", `{"whale_bch":15000}`, http.StatusOK},
+		{"/admin/thresholds", `{"whale_bch":-1}`, http.StatusBadRequest},
+		{"/admin/tx/resend", `{"txid":"` + testTxID + `"}`, http.StatusOK},
+		{"/admin/tx/suppress", `{"txid":"abc"}`, http.StatusBadRequest},
+		{"/admin/tx/suppress", `{"txid":"` + testTxID + `"}`, http.StatusOK},
+		{"/admin/txcounter/flush", ``, http.StatusOK},
+		{"/admin/nodes/failover", `{}`, http.StatusOK},
+		{"/admin/thresholds", `not json`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		if res := postAdmin(monitor, test.path, test.body, "token"); res.Code != test.expected {
+			t.Errorf("Expected %d for %s %s, got %d: %s", test.expected, test.path, test.body, res.Code, res.Body.String())
+		}
+	}
+
+	if !bot.paused["twitter"] || bot.thresholds.WhaleBch != 15000 || bot.thresholds.MinTxCount != 1000 {
+		t.Errorf("Unexpected bot state: %+v", bot)
+	}
+	if len(bot.resent) != 1 || len(bot.suppressed) != 1 || bot.flushed != 1 || bot.failover != "" {
+		t.Errorf("Unexpected bot state: %+v", bot)
+	}
+
+	event := monitor.GetEvent(AdminActionEvent)
+	data, _ := json.Marshal(event.Data)
+	if !strings.Contains(string(data), `"action":"nodes/failover"`) || !strings.Contains(string(data), "node2:8332") {
+		t.Errorf("Unexpected admin event: %s", data)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/txcounter/flush", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	recorder := httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET to be rejected, got %d", recorder.Code)
+	}
+}
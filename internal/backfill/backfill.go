@@ -0,0 +1,206 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// the expected time between blocks to estimate when historical blocks were mined
+const blockInterval = 10 * time.Minute
+
+// BlockSource provides historical blocks (implemented by bch.Bch).
+type BlockSource interface {
+	GetBlock(height uint32) (*parser.Block, error)
+	GetBestBlockHeight() uint32
+}
+
+// BlockChecker checks all transactions of a block for whales (implemented by watcher.Watcher).
+type BlockChecker interface {
+	CheckBlockAt(block *parser.Block, when time.Time)
+}
+
+// Backfill scans a range of historical blocks for whales.
+// Progress is stored in a checkpoint file so that an interrupted scan can be resumed.
+type Backfill struct {
+	config  BackfillConfig
+	logger  log.Logger
+	source  BlockSource
+	checker BlockChecker
+}
+
+type BackfillConfig struct {
+	From             uint32 // first block height to scan
+	To               uint32 // last block height to scan (inclusive) - 0 for the current best block
+	CheckpointFile   string // defaults to "backfill.json"
+	CheckpointBlocks int    // how often to write the checkpoint and log progress - defaults to 10
+	Restart          bool   // ignore an existing checkpoint
+}
+
+// Checkpoint is the progress of a backfill stored on disk.
+type Checkpoint struct {
+	From         uint32    `json:"from"`
+	To           uint32    `json:"to"`
+	Next         uint32    `json:"next"` // the next block height to scan
+	Transactions int       `json:"transactions"`
+	Updated      time.Time `json:"updated"`
+}
+
+func NewBackfill(config BackfillConfig, logger log.Logger, source BlockSource, checker BlockChecker) (*Backfill, error) {
+	if len(config.CheckpointFile) == 0 {
+		config.CheckpointFile = "backfill.json"
+	}
+	if config.CheckpointBlocks <= 0 {
+		config.CheckpointBlocks = 10
+	}
+	if config.To != 0 && config.To < config.From {
+		return nil, errors.Errorf("invalid block range: from %d is after to %d", config.From, config.To)
+	}
+	return &Backfill{
+		config: config,
+		logger: logger.WithFields(log.Fields{
+			"module": "backfill",
+		}),
+		source:  source,
+		checker: checker,
+	}, nil
+}
+
+// Run scans all blocks of the range until it is done, ctx is cancelled or fetching a block fails.
+// The checkpoint is written before returning, so calling Run again resumes the scan.
+// This call is blocking.
+func (b *Backfill) Run(ctx context.Context) error {
+	best := b.source.GetBestBlockHeight()
+	to := b.config.To
+	if to == 0 {
+		to = best
+	}
+	if to > best {
+		return errors.Errorf("block %d is above the best block height %d", to, best)
+	} else if to < b.config.From {
+		return errors.Errorf("invalid block range: from %d is after to %d", b.config.From, to)
+	}
+
+	checkpoint, err := b.loadCheckpoint(b.config.From, to)
+	if err != nil {
+		return err
+	}
+	checkpoint.To = to // scan up to the current best block if "to" is omitted
+	if checkpoint.Next > b.config.From {
+		b.logger.Infof("Resuming backfill of blocks %d to %d at %d", checkpoint.From, checkpoint.To, checkpoint.Next)
+	} else {
+		b.logger.Infof("Starting backfill of blocks %d to %d", checkpoint.From, checkpoint.To)
+	}
+
+	start := time.Now()
+	startHeight := checkpoint.Next
+	for checkpoint.Next <= to {
+		select {
+		case <-ctx.Done():
+			b.logger.Infof("Backfill interrupted at block %d", checkpoint.Next)
+			return b.writeCheckpoint(checkpoint)
+		default:
+		}
+
+		block, err := b.source.GetBlock(checkpoint.Next)
+		if err != nil {
+			if checkpointErr := b.writeCheckpoint(checkpoint); checkpointErr != nil {
+				b.logger.Errorf("Error writing backfill checkpoint: %+v", checkpointErr)
+			}
+			return errors.Wrapf(err, "error getting block %d", checkpoint.Next)
+		}
+		b.checker.CheckBlockAt(block, BlockTime(block, checkpoint.Next, best))
+		checkpoint.Transactions += len(block.Tx)
+		checkpoint.Next++
+
+		if scanned := checkpoint.Next - startHeight; scanned%uint32(b.config.CheckpointBlocks) == 0 {
+			if err = b.writeCheckpoint(checkpoint); err != nil {
+				return err
+			}
+			b.logProgress(checkpoint, scanned, time.Since(start))
+		}
+	}
+
+	b.logger.Infof("Backfill of blocks %d to %d completed with %d transactions", checkpoint.From, checkpoint.To, checkpoint.Transactions)
+	if err = os.Remove(b.config.CheckpointFile); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "error removing backfill checkpoint")
+	}
+	return nil
+}
+
+func (b *Backfill) logProgress(checkpoint *Checkpoint, scanned uint32, elapsed time.Duration) {
+	total := checkpoint.To - checkpoint.From + 1
+	done := checkpoint.Next - checkpoint.From
+	blocksPerSec := float64(scanned) / elapsed.Seconds()
+	eta := time.Duration(float64(checkpoint.To+1-checkpoint.Next)/blocksPerSec) * time.Second
+	b.logger.Infof("Backfilled block %d/%d (%.1f%%), %d transactions, %.2f blocks/s, ETA %s",
+		checkpoint.Next-1, checkpoint.To, 100.0*float64(done)/float64(total), checkpoint.Transactions, blocksPerSec, eta)
+}
+
+// Loads the checkpoint of this block range or returns a new one.
+func (b *Backfill) loadCheckpoint(from uint32, to uint32) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{
+		From: from,
+		To:   to,
+		Next: from,
+	}
+	if b.config.Restart {
+		return checkpoint, nil
+	}
+	data, err := ioutil.ReadFile(b.config.CheckpointFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return checkpoint, nil
+		}
+		return nil, errors.Wrap(err, "error reading backfill checkpoint")
+	}
+	stored := &Checkpoint{}
+	if err = json.Unmarshal(data, stored); err != nil {
+		return nil, errors.Wrap(err, "error decoding backfill checkpoint")
+	}
+	// with "to" omitted the best block may have changed since the last run
+	if stored.From != from || (b.config.To != 0 && stored.To != to) {
+		return nil, errors.Errorf("checkpoint %s is for blocks %d to %d - use restart to scan %d to %d",
+			b.config.CheckpointFile, stored.From, stored.To, from, to)
+	}
+	return stored, nil
+}
+
+// Writes the checkpoint to a temporary file first, so that it is never corrupted if we get killed.
+func (b *Backfill) writeCheckpoint(checkpoint *Checkpoint) error {
+	checkpoint.Updated = time.Now()
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error encoding backfill checkpoint")
+	}
+	tempFile := b.config.CheckpointFile + ".tmp"
+	if err = ioutil.WriteFile(tempFile, data, 0644); err != nil {
+		return errors.Wrap(err, "error writing backfill checkpoint")
+	}
+	if err = os.Rename(tempFile, b.config.CheckpointFile); err != nil {
+		return errors.Wrap(err, "error replacing backfill checkpoint")
+	}
+	return nil
+}
+
+// BlockTime returns the time of the block header or the estimated time if the block has none.
+func BlockTime(block *parser.Block, height uint32, best uint32) time.Time {
+	if !block.Time.IsZero() {
+		return block.Time
+	}
+	return EstimateBlockTime(height, best)
+}
+
+// EstimateBlockTime returns the estimated time a block was mined, based on the expected block interval.
+// This is precise enough to decide which TX are within the average window of TxCounter.
+func EstimateBlockTime(height uint32, best uint32) time.Time {
+	if height >= best {
+		return time.Now()
+	}
+	return time.Now().Add(-time.Duration(best-height) * blockInterval)
+}
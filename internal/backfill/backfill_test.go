@@ -0,0 +1,99 @@
+package backfill
+
+import (
+	"context"
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testChain struct {
+	best    uint32
+	failAt  uint32 // GetBlock fails once at this height
+	checked []uint32
+}
+
+func (c *testChain) GetBlock(height uint32) (*parser.Block, error) {
+	if height == c.failAt {
+		c.failAt = 0
+		return nil, errors.New("connection refused")
+	}
+	return &parser.Block{
+		Tx: []*parser.Transaction{{BlockHeight: height}},
+	}, nil
+}
+
+func (c *testChain) GetBestBlockHeight() uint32 {
+	return c.best
+}
+
+func (c *testChain) CheckBlockAt(block *parser.Block, when time.Time) {
+	c.checked = append(c.checked, block.Tx[0].BlockHeight)
+}
+
+func TestBackfillResume(t *testing.T) {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	checkpointFile := filepath.Join(t.TempDir(), "backfill.json")
+	chain := &testChain{best: 120, failAt: 107}
+	backfill, err := NewBackfill(BackfillConfig{
+		From:             100,
+		To:               110,
+		CheckpointFile:   checkpointFile,
+		CheckpointBlocks: 3,
+	}, logger, chain, chain)
+	if err != nil {
+		t.Fatalf("Error creating backfill: %+v", err)
+	}
+
+	if err = backfill.Run(context.Background()); err == nil {
+		t.Fatalf("Expected error getting block 107")
+	}
+	checkpoint, err := backfill.loadCheckpoint(100, 110)
+	if err != nil || checkpoint.Next != 107 || checkpoint.Transactions != 7 {
+		t.Fatalf("Unexpected checkpoint %+v: %v", checkpoint, err)
+	}
+
+	if err = backfill.Run(context.Background()); err != nil {
+		t.Fatalf("Error resuming backfill: %+v", err)
+	}
+	if len(chain.checked) != 11 || chain.checked[7] != 107 || chain.checked[10] != 110 {
+		t.Errorf("Expected every block to be checked once, got %v", chain.checked)
+	}
+	if _, err = os.Stat(checkpointFile); !os.IsNotExist(err) {
+		t.Errorf("Expected checkpoint to be removed after completion: %v", err)
+	}
+
+	// a checkpoint of another range must not be resumed
+	backfill.writeCheckpoint(&Checkpoint{From: 50, To: 60, Next: 55})
+	if err = backfill.Run(context.Background()); err == nil {
+		t.Errorf("Expected error resuming checkpoint of another block range")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	backfill.config.Restart = true
+	if err = backfill.Run(ctx); err != nil {
+		t.Errorf("Error interrupting backfill: %+v", err)
+	}
+	backfill.config.Restart = false
+	if checkpoint, err = backfill.loadCheckpoint(100, 110); err != nil || checkpoint.Next != 100 {
+		t.Errorf("Expected restarted checkpoint, got %+v: %v", checkpoint, err)
+	}
+}
+
+func TestBlockTime(t *testing.T) {
+	mined := time.Unix(1600000000, 0)
+	if when := BlockTime(&parser.Block{Time: mined}, 100, 110); !when.Equal(mined) {
+		t.Errorf("Expected the time of the block header, got %s", when)
+	}
+	estimated := BlockTime(&parser.Block{}, 100, 110)
+	if age := time.Since(estimated); age < 99*time.Minute || age > 101*time.Minute {
+		t.Errorf("Expected block time estimated 10 blocks ago, got %s", age)
+	}
+}
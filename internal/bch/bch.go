@@ -3,39 +3,94 @@ package bch
 import (
 	"context"
 	"github.com/Ekliptor/cashwhale/internal/bch/chaintools"
+	"github.com/Ekliptor/cashwhale/internal/bch/network"
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"github.com/Ekliptor/cashwhale/internal/config"
 	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
 	"github.com/checksum0/go-electrum/electrum"
 	"github.com/pkg/errors"
 	"github.com/prompt-cash/go-bitcoin"
-	"github.com/spf13/viper"
 	"net"
 	"strconv"
+	"sync"
 	"time"
 )
 
 const DustLimit = 546
 
+const (
+	// new blocks we couldn't fetch are retried in this interval
+	blockRetryInterval = time.Minute
+
+	// give up fetching a new block after this many attempts
+	maxBlockAttempts = 5
+)
+
 type Bch struct {
-	Nodes *Nodes
-	tools *chaintools.ChainTools
+	Nodes  *Nodes
+	tools  *chaintools.ChainTools
+	config BchConfig
+
+	logger  log.Logger
+	ctx     context.Context
+	monitor *monitoring.HttpMonitoring
 
-	logger log.Logger
-	ctx    context.Context
+	nodeHeight *monitoring.Gauge
+	nodeLag    *monitoring.Gauge
+
+	// health of our connections
+	healthLock       sync.Mutex
+	lastBlock        time.Time // when we received the last block (or started)
+	lastRpcSuccess   time.Time
+	lastFulcrumAlive time.Time        // last header or successful ping
+	subscribedClient *electrum.Client // the client we subscribed to new headers on
+	activeNode       *Node            // the node we receive new block headers from
+
+	failoverCh    chan *Node    // switch the header subscription to another node
+	resubscribeCh chan struct{} // subscribe to new headers again after a Fulcrum reconnect
 }
 
-func NewBch(ctx context.Context, logger log.Logger) (*Bch, error) {
+type BchConfig struct {
+	Nodes       []*config.NodeConfig
+	Network     string        // mainnet|testnet|testnet4|chipnet|regtest, defaults to mainnet
+	ChunkSize   int           // TX per chunk of fetched blocks, defaults to DefaultChunkSize
+	MaxBlockAge time.Duration // the node is unhealthy if there was no block for this long, defaults to 60min
+
+	MempoolInterval time.Duration // poll the mempool for unconfirmed TX in this interval, 0 = disabled
+}
+
+func NewBch(ctx context.Context, config BchConfig, logger log.Logger, monitor *monitoring.HttpMonitoring) (*Bch, error) {
+	if config.MaxBlockAge <= 0 {
+		config.MaxBlockAge = 60 * time.Minute // 6x the expected block interval
+	}
+	chain, err := network.Get(config.Network)
+	if err != nil {
+		return nil, err
+	}
+	metrics := monitor.Metrics()
 	bch := &Bch{
-		Nodes: nil,
+		Nodes:  nil,
+		config: config,
 		logger: logger.WithFields(log.Fields{
 			"module": "bch",
 		}),
-		ctx: ctx,
+		ctx:     ctx,
+		monitor: monitor,
+
+		nodeHeight: metrics.Gauge("cashwhale_node_block_height", "Best block height of each node.", "node"),
+		nodeLag:    metrics.Gauge("cashwhale_node_lag_blocks", "Number of blocks each node is behind the best node.", "node"),
+
+		lastBlock:     time.Now(),
+		failoverCh:    make(chan *Node, 1),
+		resubscribeCh: make(chan struct{}, 1),
 	}
-	err := bch.loadNodeConfig()
+	err = bch.loadNodeConfig()
 	if err != nil {
 		return nil, err
 	}
 
+	txParser := parser.NewParser(chain.Params)
 	for _, node := range bch.Nodes.Nodes {
 		host, port, err := net.SplitHostPort(node.Address)
 		if err != nil {
@@ -48,14 +103,30 @@ func NewBch(ctx context.Context, logger log.Logger) (*Bch, error) {
 			logger.Fatalf("Error creating bitcoin client: %v", err)
 		}
 
-		node.electrumClient, err = electrum.NewClientTCP(bch.ctx, node.Fulcrum)
+		electrumClient, err := electrum.NewClientTCP(bch.ctx, node.Fulcrum)
 		if err != nil {
 			logger.Fatalf("Error creating electrum client: %v", err)
 		}
+		node.setElectrumClient(electrumClient)
+
+		fulcrumNode := node
+		node.fetcher = newBlockFetcher(newRpcClient(node), func() rawTransactionSource {
+			if client := fulcrumNode.GetElectrumClient(); client != nil {
+				return client
+			}
+			return nil
+		}, txParser, config.ChunkSize, bch.logger)
 	}
 
 	bch.updateNodeStats()
-	bch.tools, err = chaintools.NewChainTools()
+	monitor.AddHealthCheck("node_rpc", monitoring.PROBE_READINESS, bch.checkNodeRpcHealth)
+	monitor.AddHealthCheck("fulcrum", monitoring.PROBE_LIVENESS, bch.checkFulcrumHealth)
+	monitor.AddHealthCheck("last_block", monitoring.PROBE_LIVENESS, bch.checkLastBlockHealth)
+	monitor.HandleJSON("/nodes", func() interface{} {
+		return bch.GetNodeStatus()
+	})
+
+	bch.tools, err = chaintools.NewChainTools(chain.Params)
 	if err != nil {
 		logger.Errorf("Error creating chaintools: %v", err)
 	}
@@ -73,12 +144,59 @@ func (b *Bch) updateNodeStats() {
 		info, err := node.bchClient.GetBlockchainInfo()
 		if err != nil {
 			b.logger.Errorf("Error getting chain info: %v", err)
+			node.AddConnectError("rpc", err)
 			continue
 		}
 
 		node.SetBlockHeight(uint32(info.Blocks), time.Now())
 		node.SetConnected()
+		b.nodeHeight.Set(float64(info.Blocks), node.Address)
+		b.healthLock.Lock()
+		b.lastRpcSuccess = time.Now()
+		b.healthLock.Unlock()
+	}
+
+	best := b.Nodes.GetBestBlockNode()
+	if best == nil {
+		return
+	}
+	for _, node := range b.Nodes.Nodes {
+		lag := best.GetBlockHeight() - node.GetBlockHeight()
+		b.nodeLag.Set(float64(lag), node.Address)
+	}
+}
+
+// GetNodeStatus returns the status of all configured nodes with secrets redacted.
+func (b *Bch) GetNodeStatus() []*NodeStatus {
+	best := b.Nodes.GetBestBlockNode()
+	b.healthLock.Lock()
+	activeNode, subscribedClient := b.activeNode, b.subscribedClient
+	b.healthLock.Unlock()
+
+	status := make([]*NodeStatus, 0, len(b.Nodes.Nodes))
+	for _, node := range b.Nodes.Nodes {
+		nodeStatus := &NodeStatus{
+			Address:       node.Address,
+			User:          node.User,
+			SSL:           node.SSL,
+			Fulcrum:       node.Fulcrum,
+			FulcrumStatus: "disconnected",
+			Active:        node == activeNode,
+			LagBlocks:     best.GetBlockHeight() - node.GetBlockHeight(),
+			Stats:         node.GetStats(),
+		}
+		if len(node.Password) != 0 {
+			nodeStatus.Password = redactedSecret
+		}
+		if electrumClient := node.GetElectrumClient(); electrumClient != nil {
+			nodeStatus.FulcrumStatus = "connected"
+			if node == activeNode && electrumClient == subscribedClient {
+				nodeStatus.FulcrumStatus = "subscribed"
+			}
+		}
+		status = append(status, nodeStatus)
 	}
+	return status
 }
 
 // StartNodeTimer pulls data from nodes.
@@ -101,45 +219,66 @@ func (b *Bch) StartNodeTimer() {
 }
 
 // WatchNewBlocks is a blocking call to wait for new block headers.
-func (b *Bch) WatchNewBlocks(ctx context.Context) (<-chan *bitcoin.BlockHeaderAndCoinbase, error) {
+// The transactions of new blocks are sent in chunks. Blocks that fail are retried without sending
+// their TX twice. If we give up, a last chunk with Aborted is sent.
+func (b *Bch) WatchNewBlocks(ctx context.Context) (<-chan *BlockChunk, error) {
 	best := b.Nodes.GetBestBlockNode()
-
-	// https://electrum.readthedocs.io/en/latest/protocol.html#blockchain-headers-subscribe
-	// https://docs.bitcoincashnode.org/doc/json-rpc/getblock/
-	headerCh, err := best.electrumClient.SubscribeHeaders(b.ctx)
+	headerCh, err := b.subscribeHeaders(best)
 	if err != nil {
-		return nil, errors.Wrap(err, "error opening channel to read new blocks")
+		return nil, err
 	}
 
-	respChan := make(chan *bitcoin.BlockHeaderAndCoinbase, 1)
+	respChan := make(chan *BlockChunk, 1)
+	sendChunk := func(chunk *BlockChunk) error {
+		select {
+		case respChan <- chunk:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 	go (func() {
 		var pingTicker = time.NewTicker(time.Minute * time.Duration(best.FulcrumPingMin))
+		retryTicker := time.NewTicker(blockRetryInterval)
+		defer retryTicker.Stop()
+		pending := make([]*pendingBlock, 0, 1) // blocks to retry
 		terminating := false
 		for !terminating {
 			select {
-			case header := <-headerCh:
-				b.logger.Debugf("Found new block at height %d", header.Height)
-
-				blockHash, err := best.bchClient.GetBlockHash(int(header.Height))
+			case node := <-b.failoverCh:
+				nodeHeaderCh, err := b.subscribeHeaders(node)
 				if err != nil {
-					b.logger.Errorf("Error getting block hash: %v", err)
+					b.logger.Errorf("Error failing over to node %s, keeping %s: %+v", node.Address, best.Address, err)
 					continue
 				}
+				b.logger.Infof("Failed over from node %s to %s", best.Address, node.Address)
+				best, headerCh = node, nodeHeaderCh
+				pingTicker.Stop()
+				pingTicker = time.NewTicker(time.Minute * time.Duration(best.FulcrumPingMin))
 
-				// header.Hex is len 160, we expect len 64. both are HEX. So header.Hex is the raw header data?
-				//block, err := best.bchClient.GetBlock(blockHash) // doesn't include full TX
-				block, err := best.bchClient.GetBlockHeaderAndCoinbase(blockHash)
-				if err != nil {
-					b.logger.Errorf("Error getting block: %v", err)
-					continue
+			case <-b.resubscribeCh:
+				headerCh = b.resubscribeHeaders(best, headerCh)
+
+			case header := <-headerCh:
+				b.logger.Debugf("Found new block at height %d", header.Height)
+				b.setFulcrumAlive()
+				pending = b.fetchNewBlock(ctx, best, &pendingBlock{height: uint32(header.Height)}, sendChunk, pending)
+
+			case <-retryTicker.C:
+				retries := pending
+				pending = make([]*pendingBlock, 0, len(retries))
+				for _, block := range retries {
+					pending = b.fetchNewBlock(ctx, best, block, sendChunk, pending)
 				}
-				b.logger.Debugf("Block %d has %d transactions", header.Height, len(block.Tx))
-				respChan <- block
 
 			case <-pingTicker.C:
 				// ping fulcrum to keep connection alive
-				err := best.electrumClient.Ping(ctx)
-				b.reconnectElectrumOnError(err)
+				err := b.pingFulcrum(ctx, best)
+				if err == nil {
+					b.setFulcrumAlive()
+					headerCh = b.resubscribeHeaders(best, headerCh) // if it failed after the last reconnect
+				}
+				b.reconnectElectrumOnError(best, err)
 
 			case <-ctx.Done():
 				terminating = true
@@ -150,6 +289,190 @@ func (b *Bch) WatchNewBlocks(ctx context.Context) (<-chan *bitcoin.BlockHeaderAn
 	return respChan, nil
 }
 
+// Fetches a new block from the node and returns the blocks to retry, including this block if it failed.
+func (b *Bch) fetchNewBlock(ctx context.Context, node *Node, block *pendingBlock, send ChunkHandler, pending []*pendingBlock) []*pendingBlock {
+	blockHash, err := node.bchClient.GetBlockHash(int(block.height))
+	if err != nil {
+		err = errors.Wrap(err, "error getting block hash")
+	} else {
+		err = block.fetch(ctx, node.fetcher, blockHash, send)
+	}
+	if err == nil {
+		b.healthLock.Lock()
+		b.lastBlock = time.Now()
+		b.healthLock.Unlock()
+		return pending
+	} else if ctx.Err() != nil {
+		return pending // shutting down
+	}
+
+	block.attempts++
+	if block.attempts < maxBlockAttempts {
+		b.logger.Errorf("Error getting block %d (attempt %d of %d), retrying: %+v", block.height, block.attempts, maxBlockAttempts, err)
+		return append(pending, block)
+	}
+	b.logger.Errorf("Giving up on block %d after %d attempts with %d TX checked: %+v", block.height, block.attempts, block.sent, err)
+	send(&BlockChunk{
+		Hash:    block.hash,
+		Height:  block.height,
+		Last:    true,
+		Aborted: true,
+	})
+	return pending
+}
+
+// GetBlock returns the block at this height with all transactions from the best node.
+func (b *Bch) GetBlock(height uint32) (*parser.Block, error) {
+	best := b.Nodes.GetBestBlockNode()
+	if best == nil {
+		return nil, errors.New("no BCH node configured")
+	}
+	blockHash, err := best.bchClient.GetBlockHash(int(height))
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting block hash")
+	}
+	block := &parser.Block{
+		Hash:   blockHash,
+		Height: height,
+	}
+	err = best.fetcher.FetchBlock(b.ctx, blockHash, height, func(chunk *BlockChunk) error {
+		block.Tx = append(block.Tx, chunk.Tx...)
+		block.Time = chunk.Time
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting block")
+	}
+	return block, nil
+}
+
+// GetBestBlockHeight returns the highest block height of all nodes.
+func (b *Bch) GetBestBlockHeight() uint32 {
+	best := b.Nodes.GetBestBlockNode()
+	if best == nil {
+		return 0
+	}
+	return best.GetBlockHeight()
+}
+
+// Subscribe to new block headers of the node's Fulcrum server.
+func (b *Bch) subscribeHeaders(node *Node) (<-chan *electrum.SubscribeHeadersResult, error) {
+	// https://electrum.readthedocs.io/en/latest/protocol.html#blockchain-headers-subscribe
+	// https://docs.bitcoincashnode.org/doc/json-rpc/getblock/
+	electrumClient := node.GetElectrumClient()
+	if electrumClient == nil {
+		return nil, errors.Errorf("Fulcrum of node %s is not connected", node.Address)
+	}
+	headerCh, err := electrumClient.SubscribeHeaders(b.ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening channel to read new blocks")
+	}
+	b.healthLock.Lock()
+	b.subscribedClient = electrumClient
+	b.activeNode = node
+	b.lastFulcrumAlive = time.Now()
+	b.healthLock.Unlock()
+	return headerCh, nil
+}
+
+// Subscribes to new headers of the node again if its Fulcrum client was replaced by a reconnect.
+// Returns the new channel or headerCh if the client didn't change or subscribing failed.
+func (b *Bch) resubscribeHeaders(node *Node, headerCh <-chan *electrum.SubscribeHeadersResult) <-chan *electrum.SubscribeHeadersResult {
+	b.healthLock.Lock()
+	subscribedClient := b.subscribedClient
+	b.healthLock.Unlock()
+	if node.GetElectrumClient() == subscribedClient {
+		return headerCh
+	}
+	nodeHeaderCh, err := b.subscribeHeaders(node)
+	if err != nil {
+		b.logger.Errorf("Error subscribing to new blocks of node %s after Fulcrum reconnect, retrying on next ping: %+v", node.Address, err)
+		return headerCh
+	}
+	b.logger.Infof("Subscribed to new blocks of node %s after Fulcrum reconnect", node.Address)
+	return nodeHeaderCh
+}
+
+// Failover switches the subscription of new blocks to the node with this address.
+// If address is empty the next node after the active one is used.
+// Returns the address of the node we switch to.
+func (b *Bch) Failover(address string) (string, error) {
+	b.healthLock.Lock()
+	activeNode := b.activeNode
+	b.healthLock.Unlock()
+	if activeNode == nil {
+		return "", errors.New("not watching new blocks")
+	}
+
+	var target *Node
+	for i, node := range b.Nodes.Nodes {
+		if len(address) == 0 && node == activeNode {
+			target = b.Nodes.Nodes[(i+1)%len(b.Nodes.Nodes)]
+			break
+		} else if len(address) != 0 && node.Address == address {
+			target = node
+			break
+		}
+	}
+	if target == nil {
+		return "", errors.Errorf("unknown node %s", address)
+	} else if target == activeNode {
+		return "", errors.Errorf("node %s is already active", target.Address)
+	}
+
+	select {
+	case b.failoverCh <- target:
+		return target.Address, nil
+	default:
+		return "", errors.New("another failover is in progress")
+	}
+}
+
+func (b *Bch) setFulcrumAlive() {
+	b.healthLock.Lock()
+	b.lastFulcrumAlive = time.Now()
+	b.healthLock.Unlock()
+}
+
+func (b *Bch) checkNodeRpcHealth() error {
+	b.healthLock.Lock()
+	defer b.healthLock.Unlock()
+	if b.lastRpcSuccess.IsZero() {
+		return errors.New("no node RPC reachable")
+	}
+	// node stats are updated every minute
+	if since := time.Since(b.lastRpcSuccess); since > 3*time.Minute {
+		return errors.Errorf("no node RPC reachable since %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+func (b *Bch) checkFulcrumHealth() error {
+	b.healthLock.Lock()
+	defer b.healthLock.Unlock()
+	if b.subscribedClient == nil || b.activeNode == nil {
+		return errors.New("not subscribed to new block headers")
+	} else if b.activeNode.GetElectrumClient() != b.subscribedClient {
+		return errors.New("header subscription lost after Fulcrum reconnect")
+	}
+
+	pingInterval := time.Duration(b.activeNode.FulcrumPingMin) * time.Minute
+	if since := time.Since(b.lastFulcrumAlive); since > 2*pingInterval+time.Minute {
+		return errors.Errorf("no response from Fulcrum since %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+func (b *Bch) checkLastBlockHealth() error {
+	maxAge := b.config.MaxBlockAge
+	b.healthLock.Lock()
+	defer b.healthLock.Unlock()
+	if age := time.Since(b.lastBlock); age > maxAge {
+		return errors.Errorf("last block received %s ago (max %s)", age.Round(time.Second), maxAge)
+	}
+	return nil
+}
+
 func (b *Bch) GetBestAddress() string {
 	best := b.Nodes.GetBestBlockNode()
 	protocol := "http"
@@ -160,15 +483,26 @@ func (b *Bch) GetBestAddress() string {
 }
 
 func (b *Bch) loadNodeConfig() error {
-	b.Nodes = &Nodes{}
-	err := viper.UnmarshalKey("BCH", b.Nodes)
-	if err != nil {
-		return errors.Wrap(err, "error loading BCH nodes from config")
+	if len(b.config.Nodes) == 0 {
+		return errors.New("at least 1 BCH node is required")
 	}
-
-	for _, node := range b.Nodes.Nodes {
-		//node.monitor = b.monitor
-		node.stats = &NodeStats{}
+	b.Nodes = &Nodes{
+		Nodes: make([]*Node, 0, len(b.config.Nodes)),
+	}
+	for _, nodeConfig := range b.config.Nodes {
+		node := &Node{
+			Address:        nodeConfig.Address,
+			User:           nodeConfig.User,
+			Password:       nodeConfig.Password,
+			SSL:            nodeConfig.SSL,
+			Fulcrum:        nodeConfig.Fulcrum,
+			FulcrumPingMin: nodeConfig.FulcrumPingMin,
+			stats:          &NodeStats{},
+		}
+		if node.FulcrumPingMin <= 0 {
+			node.FulcrumPingMin = config.DefaultFulcrumPingMin
+		}
+		b.Nodes.Nodes = append(b.Nodes.Nodes, node)
 	}
 
 	return nil
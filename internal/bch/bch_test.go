@@ -1 +1,108 @@
 package bch
+
+import (
+	"context"
+	"errors"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/checksum0/go-electrum/electrum"
+	"testing"
+	"time"
+)
+
+func TestGetNodeStatus(t *testing.T) {
+	nodes := &Nodes{Nodes: []*Node{
+		{Address: "node1:8332", User: "user", Password: "secret", stats: &NodeStats{}},
+		{Address: "node2:8332", User: "user", stats: &NodeStats{}},
+	}}
+	nodes.Nodes[0].SetBlockHeight(700005, time.Now())
+	nodes.Nodes[1].SetBlockHeight(700002, time.Now())
+	b := &Bch{Nodes: nodes, activeNode: nodes.Nodes[0]}
+
+	status := b.GetNodeStatus()
+	if len(status) != 2 {
+		t.Fatalf("Expected status of 2 nodes, got %d", len(status))
+	}
+	if status[0].Password != redactedSecret || status[1].Password != "" {
+		t.Errorf("Passwords are not redacted: %q %q", status[0].Password, status[1].Password)
+	}
+	if !status[0].Active || status[1].Active {
+		t.Errorf("Expected only node1 to be active")
+	}
+	if status[0].LagBlocks != 0 || status[1].LagBlocks != 3 {
+		t.Errorf("Unexpected lag: %d %d", status[0].LagBlocks, status[1].LagBlocks)
+	}
+	if status[0].FulcrumStatus != "disconnected" {
+		t.Errorf("Unexpected Fulcrum status: %s", status[0].FulcrumStatus)
+	}
+}
+
+func TestAddConnectError(t *testing.T) {
+	node := &Node{stats: &NodeStats{}}
+	node.SetConnected()
+	for i := 0; i < maxNodeConnectErrors+5; i++ {
+		node.AddConnectError("fulcrum", errors.New("connection closed"))
+	}
+	stats := node.GetStats()
+	if len(stats.LostConnections) != maxNodeConnectErrors {
+		t.Errorf("Expected %d connect errors, got %d", maxNodeConnectErrors, len(stats.LostConnections))
+	}
+	if stats.Connected.IsZero() {
+		t.Errorf("Fulcrum errors must not reset the RPC connection time")
+	}
+
+	node.AddConnectError("rpc", errors.New("connection refused"))
+	if stats = node.GetStats(); !stats.Connected.IsZero() || stats.LostConnections[maxNodeConnectErrors-1].Service != "rpc" {
+		t.Errorf("Unexpected stats after RPC error: %+v", stats)
+	}
+}
+
+func TestWithFulcrumNotConnected(t *testing.T) {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	node := &Node{Address: "node1:8332", Fulcrum: "127.0.0.1:1", stats: &NodeStats{}} // a failed reconnect left no client
+	b := &Bch{Nodes: &Nodes{Nodes: []*Node{node}}, logger: logger, ctx: context.Background()}
+
+	if err := b.pingFulcrum(b.ctx, node); err != errFulcrumNotConnected {
+		t.Errorf("Expected ping without client to fail, got %v", err)
+	}
+	calls := 0
+	err = b.withFulcrum(func(client *electrum.Client) error {
+		calls++
+		return electrum.ErrServerShutdown
+	})
+	if err == nil || calls >= maxFulcrumAttempts {
+		t.Errorf("Expected request to fail after %d attempts, got %v with %d calls", maxFulcrumAttempts, err, calls)
+	}
+	if stats := node.GetStats(); len(stats.LostConnections) == 0 {
+		t.Errorf("Expected failed reconnects to be recorded")
+	}
+}
+
+func TestResubscribeHeaders(t *testing.T) {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	node := &Node{Address: "node1:8332", Fulcrum: "127.0.0.1:1", stats: &NodeStats{}}
+	b := &Bch{Nodes: &Nodes{Nodes: []*Node{node}}, logger: logger, ctx: context.Background(), resubscribeCh: make(chan struct{}, 1)}
+	headerCh := make(<-chan *electrum.SubscribeHeadersResult)
+	if ch := b.resubscribeHeaders(node, headerCh); ch != headerCh {
+		t.Errorf("Expected subscription to be kept with the same client")
+	}
+
+	// a reconnect replaces the client we subscribed on
+	b.subscribedClient = &electrum.Client{}
+	b.reconnectElectrumOnError(node, electrum.ErrServerShutdown)
+	select {
+	case <-b.resubscribeCh:
+	default:
+		t.Errorf("Expected reconnect to request a new header subscription")
+	}
+	if node.GetElectrumClient() == nil {
+		if ch := b.resubscribeHeaders(node, headerCh); ch != headerCh {
+			t.Errorf("Expected old subscription to be kept if subscribing fails")
+		}
+	}
+}
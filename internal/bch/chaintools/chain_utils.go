@@ -2,7 +2,10 @@ package chaintools
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/txscript"
 	"github.com/gcash/bchutil"
 	"github.com/gcash/bchutil/hdkeychain"
 	"google.golang.org/grpc/codes"
@@ -36,10 +39,14 @@ type ChainTools struct {
 	//enableSlpIndex bool
 }
 
-func NewChainTools() (tools *ChainTools, err error) {
+// NewChainTools creates chain tools for the network of chainParams. nil defaults to mainnet.
+func NewChainTools(chainParams *chaincfg.Params) (tools *ChainTools, err error) {
+	if chainParams == nil {
+		chainParams = &chaincfg.MainNetParams
+	}
 	tools = &ChainTools{
 		//App: app,
-		chainParams: &chaincfg.MainNetParams,
+		chainParams: chainParams,
 		//enableSlpIndex: viper.GetBool("BitcoinCash.EnableSlpIndex"),
 	}
 
@@ -115,3 +122,20 @@ func (s *ChainTools) NewToOldAddress(newAddress string) (string, error) {
 	}
 	return addr2.EncodeAddress(), nil
 }
+
+// ElectrumScriptHash returns the script hash of a cash address used by electrum servers to query the address.
+func (s *ChainTools) ElectrumScriptHash(newAddress string) (string, error) {
+	addr, err := bchutil.DecodeAddress(newAddress, s.chainParams)
+	if err != nil {
+		return "", err
+	}
+	script, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(script)
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return hex.EncodeToString(hash[:]), nil
+}
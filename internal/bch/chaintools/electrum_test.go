@@ -21,7 +21,7 @@ func TestElectrum(t *testing.T) {
 	}
 	log.Printf("Server version: %s [Protocol %s]", serverVer, protocolVer)
 
-	tools, err := NewChainTools()
+	tools, err := NewChainTools(nil)
 	addr1, err := tools.NewToOldAddress("qpkjwn82pz3uj2jdzhv43tmaej2ftzyp8qe0er6ld4")
 	scripthash, _ := electrum.AddressToElectrumScriptHash(addr1)
 	unspent, err := client.ListUnspent(context.Background(), scripthash)
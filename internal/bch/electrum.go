@@ -3,51 +3,93 @@ package bch
 import (
 	"context"
 	"github.com/checksum0/go-electrum/electrum"
+	"github.com/pkg/errors"
 )
 
+// how often we reconnect Fulcrum and retry a request if the connection was closed
+const maxFulcrumAttempts = 3
+
+// errFulcrumNotConnected is returned if the last reconnect of the Fulcrum client of a node failed.
+var errFulcrumNotConnected = errors.New("Fulcrum is not connected")
+
 func (b *Bch) ListUnspent(ctx context.Context, newAddress string) ([]*electrum.ListUnspentResult, error) {
-	addr, err := b.tools.NewToOldAddress(newAddress)
-	if err != nil {
-		return nil, err
-	}
-	scripthash, err := electrum.AddressToElectrumScriptHash(addr)
+	scripthash, err := b.tools.ElectrumScriptHash(newAddress) // electrum.AddressToElectrumScriptHash only decodes mainnet addresses
 	if err != nil {
 		return nil, err
 	}
 
-	best := b.Nodes.GetBestBlockNode()
-	out, err := best.GetElectrumClient().ListUnspent(ctx, scripthash)
-	if err == electrum.ErrServerShutdown {
-		b.reconnectElectrumOnError(err)
-		return b.ListUnspent(ctx, newAddress)
-	}
+	var out []*electrum.ListUnspentResult
+	err = b.withFulcrum(func(client *electrum.Client) (err error) {
+		out, err = client.ListUnspent(ctx, scripthash)
+		return err
+	})
 	return out, err
 }
 
 func (b *Bch) GetTransaction(ctx context.Context, txHash string) (*electrum.GetTransactionResult, error) {
-	best := b.Nodes.GetBestBlockNode()
-	res, err := best.GetElectrumClient().GetTransaction(ctx, txHash)
-	if err == electrum.ErrServerShutdown {
-		b.reconnectElectrumOnError(err)
-		return b.GetTransaction(ctx, txHash)
+	var res *electrum.GetTransactionResult
+	err := b.withFulcrum(func(client *electrum.Client) (err error) {
+		res, err = client.GetTransaction(ctx, txHash)
+		return err
+	})
+	return res, err
+}
+
+// Calls fn with the Fulcrum client of the best node. Reconnects and retries up to maxFulcrumAttempts
+// if the connection is closed.
+func (b *Bch) withFulcrum(fn func(client *electrum.Client) error) error {
+	var err error
+	for attempt := 1; attempt <= maxFulcrumAttempts; attempt++ {
+		best := b.Nodes.GetBestBlockNode()
+		if client := best.GetElectrumClient(); client == nil {
+			err = errFulcrumNotConnected
+		} else {
+			err = fn(client)
+		}
+		if !isFulcrumClosed(err) {
+			return err
+		}
+		b.reconnectElectrumOnError(best, err)
 	}
+	return errors.Wrapf(err, "Fulcrum request failed after %d attempts", maxFulcrumAttempts)
+}
 
-	return res, err
+// Pings the Fulcrum server of the node. Returns errFulcrumNotConnected if the node has no client.
+func (b *Bch) pingFulcrum(ctx context.Context, node *Node) error {
+	client := node.GetElectrumClient()
+	if client == nil {
+		return errFulcrumNotConnected
+	}
+	return client.Ping(ctx)
 }
 
-func (b *Bch) reconnectElectrumOnError(err error) {
-	if err == nil || err != electrum.ErrServerShutdown {
+// Reconnects the Fulcrum clients of all nodes if the connection of the failed node was closed.
+func (b *Bch) reconnectElectrumOnError(failed *Node, err error) {
+	if !isFulcrumClosed(err) {
 		return
 	}
 
-	b.logger.Errorf("Fulcrum connection closed, reconnecting: %v", err)
+	b.logger.Errorf("Fulcrum connection of node %s closed, reconnecting: %v", failed.Address, err)
+	failed.AddConnectError("fulcrum", err)
 
 	// easy way: simple re-connect all
 	for _, node := range b.Nodes.Nodes {
-		node.electrumClient, err = electrum.NewClientTCP(b.ctx, node.Fulcrum)
+		electrumClient, err := electrum.NewClientTCP(b.ctx, node.Fulcrum)
 		if err != nil {
 			b.logger.Errorf("Error re-connecting electrum client: %v", err)
-			// we will try to re-connect again on next failed ping
+			node.AddConnectError("fulcrum", err)
+			electrumClient = nil // we will try to re-connect again on next ping or request
 		}
+		node.setElectrumClient(electrumClient)
 	}
+
+	select {
+	case b.resubscribeCh <- struct{}{}: // the header subscription was on the old client
+	default:
+	}
+}
+
+// Returns true if the error means we have to reconnect to Fulcrum.
+func isFulcrumClosed(err error) bool {
+	return err == electrum.ErrServerShutdown || err == errFulcrumNotConnected
 }
@@ -0,0 +1,500 @@
+package bch
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"github.com/pkg/errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultChunkSize is the number of TX per chunk of a block.
+const DefaultChunkSize = 1000
+
+const (
+	// the outputs of TX of this many chunks are kept to look up outputs spent in the same block,
+	// outputs of older TX are fetched from Fulcrum again
+	blockOutputChunks = 10
+
+	// how many previous TX to fetch from Fulcrum at the same time
+	prevoutWorkers = 8
+)
+
+// returned if a node accepts getblock verbosity 3 but doesn't include prevouts
+var errPrevoutsMissing = errors.New("block TX have no prevouts")
+
+// BlockChunk is a part of the transactions of a block in block order.
+// Blocks are split into chunks, so large blocks don't have to be kept in memory.
+type BlockChunk struct {
+	Hash   string
+	Height uint32
+	Time   time.Time // the timestamp of the block header, always set on the last chunk (verbose blocks have it after their TX)
+	Tx     []*parser.Transaction
+	Last   bool // the last chunk of the block (may have no TX)
+
+	// we gave up fetching the block, this is the last chunk and the previous chunks are all TX we got
+	Aborted bool
+}
+
+// ChunkHandler processes a chunk of a block. Returning an error stops fetching the block.
+type ChunkHandler func(chunk *BlockChunk) error
+
+// A new block that is fetched again if it failed. TX sent by a previous attempt are not sent again.
+type pendingBlock struct {
+	height   uint32
+	hash     string
+	sent     int // TX sent in chunks so far
+	attempts int
+}
+
+// Returns raw TX to look up the values of spent outputs, implemented by electrum.Client.
+type rawTransactionSource interface {
+	GetRawTransaction(ctx context.Context, txHash string) (string, error)
+}
+
+// BlockFetcher fetches full blocks including the values of all spent outputs from a node.
+// It requests getblock verbosity 3 from BCHN and falls back to raw blocks with prevout
+// lookups via Fulcrum if the node doesn't support it.
+type BlockFetcher struct {
+	rpc       *rpcClient
+	prevouts  func() rawTransactionSource // the current Fulcrum connection, nil if not connected
+	parser    *parser.Parser
+	chunkSize int
+	logger    log.Logger
+
+	lock      sync.Mutex
+	rawBlocks bool // the node doesn't support verbosity 3
+}
+
+// a TX of getblock verbosity 3
+type verboseTx struct {
+	Txid string          `json:"txid"`
+	Size int             `json:"size"`
+	Vin  []verboseInput  `json:"vin"`
+	Vout []verboseOutput `json:"vout"`
+}
+
+type verboseInput struct {
+	Coinbase  string         `json:"coinbase"`
+	Txid      string         `json:"txid"`
+	Vout      uint32         `json:"vout"`
+	ScriptSig verboseScript  `json:"scriptSig"`
+	Prevout   *verboseOutput `json:"prevout"`
+}
+
+type verboseOutput struct {
+	Value        float64       `json:"value"`
+	ScriptPubKey verboseScript `json:"scriptPubKey"`
+}
+
+type verboseScript struct {
+	Hex string `json:"hex"`
+}
+
+func newBlockFetcher(rpc *rpcClient, prevouts func() rawTransactionSource, txParser *parser.Parser, chunkSize int, logger log.Logger) *BlockFetcher {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	return &BlockFetcher{
+		rpc:       rpc,
+		prevouts:  prevouts,
+		parser:    txParser,
+		chunkSize: chunkSize,
+		logger:    logger,
+	}
+}
+
+// FetchBlock calls handle with the transactions of the block in chunks of at most chunkSize TX.
+func (f *BlockFetcher) FetchBlock(ctx context.Context, hash string, height uint32, handle ChunkHandler) error {
+	f.lock.Lock()
+	rawBlocks := f.rawBlocks
+	f.lock.Unlock()
+	if !rawBlocks {
+		delivered, err := f.fetchVerboseBlock(ctx, hash, height, handle)
+		if delivered || !isVerbosityUnsupported(err) {
+			return err
+		}
+		f.logger.Warnf("Node doesn't support blocks with prevouts, fetching raw blocks with prevouts from Fulcrum: %v", err)
+		f.lock.Lock()
+		f.rawBlocks = true
+		f.lock.Unlock()
+	}
+	return f.fetchRawBlock(ctx, hash, height, handle)
+}
+
+// Fetches the block with this hash and sends all TX that were not sent by a previous attempt.
+func (p *pendingBlock) fetch(ctx context.Context, fetcher *BlockFetcher, hash string, send ChunkHandler) error {
+	if hash != p.hash {
+		p.hash, p.sent = hash, 0 // the block was replaced by a reorg
+	}
+	skip := p.sent
+	return fetcher.FetchBlock(ctx, hash, p.height, func(chunk *BlockChunk) error {
+		if skip >= len(chunk.Tx) {
+			skip -= len(chunk.Tx)
+			chunk.Tx = chunk.Tx[:0]
+		} else {
+			chunk.Tx = chunk.Tx[skip:]
+			skip = 0
+		}
+		if len(chunk.Tx) == 0 && !chunk.Last {
+			return nil
+		}
+		if err := send(chunk); err != nil {
+			return err
+		}
+		p.sent += len(chunk.Tx)
+		return nil
+	})
+}
+
+// Streams the TX of a verbosity 3 block. Returns true if any chunk was passed to handle.
+func (f *BlockFetcher) fetchVerboseBlock(ctx context.Context, hash string, height uint32, handle ChunkHandler) (bool, error) {
+	body, err := f.rpc.call(ctx, "getblock", hash, 3)
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+	dec := json.NewDecoder(body)
+	if err = streamResult(dec); err != nil {
+		return false, err
+	}
+	token, err := dec.Token()
+	if err != nil {
+		return false, errors.Wrap(err, "error reading block")
+	} else if token == nil {
+		return false, streamError(dec)
+	} else if token != json.Delim('{') {
+		return false, errors.Errorf("unexpected block JSON %v", token)
+	}
+
+	delivered := false
+	var blockTime time.Time
+	chunk := f.newChunk(hash, height)
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return delivered, errors.Wrap(err, "error reading block")
+		} else if key == "time" {
+			var unix int64
+			if err = dec.Decode(&unix); err != nil {
+				return delivered, errors.Wrap(err, "error reading block time")
+			}
+			blockTime = time.Unix(unix, 0)
+			continue
+		} else if key != "tx" {
+			var skip json.RawMessage
+			if err = dec.Decode(&skip); err != nil {
+				return delivered, errors.Wrap(err, "error reading block")
+			}
+			continue
+		}
+
+		if token, err = dec.Token(); err != nil || token != json.Delim('[') {
+			return delivered, errors.Errorf("unexpected block TX JSON %v: %v", token, err)
+		}
+		for dec.More() {
+			var verbose verboseTx
+			if err = dec.Decode(&verbose); err != nil {
+				return delivered, errors.Wrap(err, "error decoding block TX")
+			}
+			tx, err := f.toTransaction(&verbose, height)
+			if err != nil {
+				return delivered, err
+			} else if !tx.HasPrevouts() {
+				return delivered, errPrevoutsMissing
+			}
+			chunk.Tx = append(chunk.Tx, tx)
+			if len(chunk.Tx) >= f.chunkSize {
+				chunk.Time = blockTime
+				if err = handle(chunk); err != nil {
+					return true, err
+				}
+				delivered = true
+				chunk = f.newChunk(hash, height)
+			}
+		}
+		if _, err = dec.Token(); err != nil { // ]
+			return delivered, errors.Wrap(err, "error reading block")
+		}
+	}
+	chunk.Time = blockTime
+	chunk.Last = true
+	return true, handle(chunk)
+}
+
+// Streams the TX of a serialized block and looks up the values of all spent outputs.
+func (f *BlockFetcher) fetchRawBlock(ctx context.Context, hash string, height uint32, handle ChunkHandler) error {
+	body, err := f.rpc.call(ctx, "getblock", hash, 0)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	hexReader, err := newHexResultReader(body)
+	if err != nil {
+		return err
+	}
+	reader, err := f.parser.NewBlockReader(hex.NewDecoder(hexReader), height)
+	if err != nil {
+		return err
+	}
+
+	outputs := newBlockOutputs(blockOutputChunks * f.chunkSize)
+	chunk := f.newChunk(hash, height)
+	for {
+		tx, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		outputs.add(tx)
+		chunk.Tx = append(chunk.Tx, tx)
+		if len(chunk.Tx) >= f.chunkSize {
+			if err = f.addPrevouts(ctx, chunk.Tx, outputs); err != nil {
+				return err
+			}
+			chunk.Time = reader.Time()
+			if err = handle(chunk); err != nil {
+				return err
+			}
+			chunk = f.newChunk(hash, height)
+		}
+	}
+	if err = f.addPrevouts(ctx, chunk.Tx, outputs); err != nil {
+		return err
+	}
+	chunk.Time = reader.Time()
+	chunk.Last = true
+	return handle(chunk)
+}
+
+func (f *BlockFetcher) newChunk(hash string, height uint32) *BlockChunk {
+	return &BlockChunk{
+		Hash:   hash,
+		Height: height,
+		Tx:     make([]*parser.Transaction, 0, f.chunkSize),
+	}
+}
+
+// Sets the spent outputs of all inputs of the TX. Outputs of the same block are taken from outputs,
+// all other previous TX are fetched from Fulcrum in parallel.
+func (f *BlockFetcher) addPrevouts(ctx context.Context, txs []*parser.Transaction, outputs *blockOutputs) error {
+	prevTxs := make(map[string][]*parser.Output) // txid -> outputs of TX we need from Fulcrum
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			if in.Prevout = outputs.spend(in); in.Prevout == nil {
+				prevTxs[in.PrevHash] = nil
+			}
+		}
+	}
+	if err := f.fetchPrevTransactions(ctx, prevTxs); err != nil {
+		return err
+	}
+
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			if in.Prevout != nil {
+				continue
+			}
+			prevOutputs := prevTxs[in.PrevHash]
+			if int(in.PrevIndex) >= len(prevOutputs) {
+				return errors.Errorf("previous TX %s of TX %s has no output %d", in.PrevHash, tx.Hash, in.PrevIndex)
+			}
+			in.Prevout = prevOutputs[in.PrevIndex]
+		}
+	}
+	return nil
+}
+
+// Fetches the outputs of all previous TX (the keys of prevTxs) from Fulcrum with up to prevoutWorkers requests at a time.
+func (f *BlockFetcher) fetchPrevTransactions(ctx context.Context, prevTxs map[string][]*parser.Output) error {
+	if len(prevTxs) == 0 {
+		return nil
+	}
+	source := f.prevouts()
+	if source == nil {
+		return errors.New("Fulcrum is not connected")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	hashes := make(chan string, len(prevTxs))
+	for txHash := range prevTxs {
+		hashes <- txHash
+	}
+	close(hashes)
+	workers := prevoutWorkers
+	if len(prevTxs) < workers {
+		workers = len(prevTxs)
+	}
+
+	var lock sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for txHash := range hashes {
+				outputs, err := f.fetchOutputs(ctx, source, txHash)
+				lock.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = errors.Wrapf(err, "error getting previous TX %s", txHash)
+					cancel() // stop the other requests
+				} else if err == nil {
+					prevTxs[txHash] = outputs
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// Returns the outputs of a TX from Fulcrum.
+func (f *BlockFetcher) fetchOutputs(ctx context.Context, source rawTransactionSource, txHash string) ([]*parser.Output, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rawTx, err := source.GetRawTransaction(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(rawTx)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding previous TX")
+	}
+	prev, err := f.parser.ParseTransaction(data)
+	if err != nil {
+		return nil, err
+	}
+	return prev.Outputs, nil
+}
+
+// The unspent outputs of TX of the block being fetched for TX spending outputs of the same block.
+// Outputs are removed once they are spent. If there are more than limit TX, the outputs of the
+// oldest TX are removed.
+type blockOutputs struct {
+	limit   int
+	outputs map[string]*blockTxOutputs // txid -> outputs
+	order   []string                   // txids in the order they were added to remove old ones
+}
+
+type blockTxOutputs struct {
+	outputs []*parser.Output // nil if spent
+	unspent int
+}
+
+func newBlockOutputs(limit int) *blockOutputs {
+	return &blockOutputs{
+		limit:   limit,
+		outputs: make(map[string]*blockTxOutputs, limit),
+		order:   make([]string, 0, limit),
+	}
+}
+
+// Adds the outputs of the TX that can be spent.
+func (b *blockOutputs) add(tx *parser.Transaction) {
+	txOutputs := &blockTxOutputs{outputs: make([]*parser.Output, len(tx.Outputs))}
+	for i, out := range tx.Outputs {
+		if out.ScriptType != parser.SCRIPT_NULLDATA { // OP_RETURN outputs can't be spent
+			txOutputs.outputs[i] = out
+			txOutputs.unspent++
+		}
+	}
+	if txOutputs.unspent == 0 {
+		return
+	}
+	if len(b.order) >= b.limit {
+		delete(b.outputs, b.order[0])
+		b.order = b.order[1:]
+	}
+	b.outputs[tx.Hash] = txOutputs
+	b.order = append(b.order, tx.Hash)
+}
+
+// Returns the output spent by the input and removes it or nil if it's not an output of this block.
+func (b *blockOutputs) spend(in *parser.Input) *parser.Output {
+	txOutputs, ok := b.outputs[in.PrevHash]
+	if !ok || int(in.PrevIndex) >= len(txOutputs.outputs) || txOutputs.outputs[in.PrevIndex] == nil {
+		return nil
+	}
+	out := txOutputs.outputs[in.PrevIndex]
+	txOutputs.outputs[in.PrevIndex] = nil
+	txOutputs.unspent--
+	if txOutputs.unspent == 0 {
+		delete(b.outputs, in.PrevHash)
+	}
+	return out
+}
+
+// Converts a TX of getblock verbosity 3.
+func (f *BlockFetcher) toTransaction(verbose *verboseTx, height uint32) (*parser.Transaction, error) {
+	tx := &parser.Transaction{
+		Hash:        verbose.Txid,
+		BlockHeight: height,
+		Size:        verbose.Size,
+		Inputs:      make([]*parser.Input, len(verbose.Vin)),
+		Outputs:     make([]*parser.Output, len(verbose.Vout)),
+	}
+	for i, in := range verbose.Vin {
+		if len(in.Coinbase) != 0 {
+			script, err := hex.DecodeString(in.Coinbase)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid coinbase of TX %s", tx.Hash)
+			}
+			tx.Inputs[i] = parser.NewCoinbaseInput(script)
+			continue
+		}
+		script, err := hex.DecodeString(in.ScriptSig.Hex)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid input script of TX %s", tx.Hash)
+		}
+		tx.Inputs[i] = &parser.Input{
+			PrevHash:  in.Txid,
+			PrevIndex: in.Vout,
+			Script:    script,
+		}
+		if in.Prevout != nil {
+			if tx.Inputs[i].Prevout, err = f.toOutput(in.Prevout); err != nil {
+				return nil, errors.Wrapf(err, "invalid prevout of TX %s", tx.Hash)
+			}
+		}
+	}
+	for i := range verbose.Vout {
+		out, err := f.toOutput(&verbose.Vout[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid output of TX %s", tx.Hash)
+		}
+		tx.Outputs[i] = out
+	}
+	return tx, nil
+}
+
+func (f *BlockFetcher) toOutput(out *verboseOutput) (*parser.Output, error) {
+	script, err := hex.DecodeString(out.ScriptPubKey.Hex)
+	if err != nil {
+		return nil, err
+	}
+	return f.parser.NewOutput(price.NewAmount(out.Value), script), nil
+}
+
+// Returns true if the error means the node doesn't support getblock verbosity 3.
+func isVerbosityUnsupported(err error) bool {
+	if err == errPrevoutsMissing {
+		return true
+	}
+	rpcErr, ok := errors.Cause(err).(*RpcError)
+	return ok && rpcErr.Code == rpcInvalidParameter
+}
@@ -0,0 +1,302 @@
+package bch
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a getblock response per verbosity, an RPC error if the value is an *RpcError
+type fakeBlockRpc map[int]interface{}
+
+func (f fakeBlockRpc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Params) != 2 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var verbosity int
+	json.Unmarshal(req.Params[1], &verbosity)
+	res := map[string]interface{}{"id": 1, "result": nil, "error": nil}
+	switch result := f[verbosity].(type) {
+	case *RpcError:
+		res["error"] = result
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		res["result"] = result
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+type fakePrevouts map[string]*wire.MsgTx
+
+func (f fakePrevouts) GetRawTransaction(ctx context.Context, txHash string) (string, error) {
+	tx, ok := f[txHash]
+	if !ok {
+		return "", errors.Errorf("unknown TX %s", txHash)
+	}
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf.Bytes()), nil
+}
+
+func newTestFetcher(t *testing.T, rpc fakeBlockRpc, prevouts fakePrevouts, chunkSize int) *BlockFetcher {
+	server := httptest.NewServer(rpc)
+	t.Cleanup(server.Close)
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	node := &Node{Address: strings.TrimPrefix(server.URL, "http://")}
+	return newBlockFetcher(newRpcClient(node), func() rawTransactionSource {
+		return prevouts
+	}, parser.NewParser(nil), chunkSize, logger)
+}
+
+func fetchChunks(t *testing.T, fetcher *BlockFetcher) []*BlockChunk {
+	chunks := make([]*BlockChunk, 0, 3)
+	err := fetcher.FetchBlock(context.Background(), "blockhash", 100, func(chunk *BlockChunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error fetching block: %+v", err)
+	}
+	return chunks
+}
+
+func TestFetchVerboseBlock(t *testing.T) {
+	output := func(value float64, script string) map[string]interface{} {
+		return map[string]interface{}{"value": value, "scriptPubKey": map[string]interface{}{"hex": script}}
+	}
+	p2pkh := "76a914f5bf48b397dae70be82b3cca4793f8eb2b6cdac988ac"
+	block := map[string]interface{}{
+		"hash":   "blockhash",
+		"height": 100,
+		"tx": []interface{}{
+			map[string]interface{}{"txid": "coinbase", "vin": []interface{}{map[string]interface{}{"coinbase": "0164"}}, "vout": []interface{}{output(6.25, p2pkh)}},
+			map[string]interface{}{"txid": "tx1", "fee": 0.00001, "vin": []interface{}{map[string]interface{}{"txid": "prev", "vout": 1, "prevout": output(2.0, p2pkh)}}, "vout": []interface{}{output(1.5, ""), output(0.49999, p2pkh)}},
+			map[string]interface{}{"txid": "tx2", "fee": 0.00001, "vin": []interface{}{map[string]interface{}{"txid": "tx1", "vout": 0, "prevout": output(1.5, "")}}, "vout": []interface{}{output(1.49999, "")}},
+		},
+		"time": 1600000000, // after the TX in responses of BCHN
+		"nTx":  3,
+	}
+	fetcher := newTestFetcher(t, fakeBlockRpc{3: block}, nil, 2)
+	chunks := fetchChunks(t, fetcher)
+	if len(chunks) != 2 || len(chunks[0].Tx) != 2 || len(chunks[1].Tx) != 1 {
+		t.Fatalf("Expected chunks of 2 and 1 TX, got %d chunks", len(chunks))
+	}
+	if chunks[0].Last || !chunks[1].Last || chunks[1].Height != 100 || !chunks[1].Time.Equal(time.Unix(1600000000, 0)) {
+		t.Errorf("Unexpected chunks %+v %+v", chunks[0], chunks[1])
+	}
+	coinbase, tx := chunks[0].Tx[0], chunks[0].Tx[1]
+	if !coinbase.IsCoinbase() || coinbase.Inputs[0].Script[1] != 0x64 || coinbase.OutputValue() != 625000000 {
+		t.Errorf("Unexpected coinbase TX %+v", coinbase)
+	}
+	if tx.Hash != "tx1" || tx.Fee() != 1000 || tx.Inputs[0].Prevout.Value != 200000000 || len(tx.Outputs) != 2 || tx.BlockHeight != 100 {
+		t.Errorf("Unexpected TX %+v", tx)
+	}
+	if tx.Inputs[0].PrevHash != "prev" || tx.Inputs[0].PrevIndex != 1 || tx.Outputs[1].Value != 49999000 {
+		t.Errorf("Unexpected TX inputs or outputs %+v", tx)
+	}
+	if tx.Outputs[1].Address != "bitcoincash:qr6m7j9njldwwzlg9v7v53unlr4jkmx6eylep8ekg2" || tx.Outputs[0].ScriptType != parser.SCRIPT_NONSTANDARD {
+		t.Errorf("Unexpected output addresses %+v %+v", tx.Outputs[0], tx.Outputs[1])
+	}
+	if fetcher.rawBlocks {
+		t.Errorf("Fetcher should not fall back to raw blocks")
+	}
+}
+
+func TestRetryPendingBlock(t *testing.T) {
+	tx := func(txid string) map[string]interface{} {
+		return map[string]interface{}{"txid": txid, "vin": []interface{}{map[string]interface{}{"coinbase": "0164"}}, "vout": []interface{}{}}
+	}
+	block := map[string]interface{}{"tx": []interface{}{tx("a"), tx("b"), tx("c")}, "time": 1600000000}
+	fetcher := newTestFetcher(t, fakeBlockRpc{3: block}, nil, 1)
+
+	// the first attempt fails after 2 chunks
+	pending := &pendingBlock{height: 100}
+	received := make([]string, 0, 3)
+	err := pending.fetch(context.Background(), fetcher, "blockhash", func(chunk *BlockChunk) error {
+		if len(received) == 2 {
+			return errors.New("connection lost")
+		}
+		received = append(received, chunk.Tx[0].Hash)
+		return nil
+	})
+	if err == nil || pending.sent != 2 {
+		t.Fatalf("Expected error after 2 TX, got %v with %d TX", err, pending.sent)
+	}
+
+	// the retry only sends the remaining TX
+	var last *BlockChunk
+	err = pending.fetch(context.Background(), fetcher, "blockhash", func(chunk *BlockChunk) error {
+		for _, tx := range chunk.Tx {
+			received = append(received, tx.Hash)
+		}
+		last = chunk
+		return nil
+	})
+	if err != nil || strings.Join(received, ",") != "a,b,c" || !last.Last || pending.sent != 3 {
+		t.Errorf("Expected the remaining TX on retry, got %v: %v", received, err)
+	}
+
+	// a different block after a reorg is sent completely
+	received = received[:0]
+	pending.fetch(context.Background(), fetcher, "otherhash", func(chunk *BlockChunk) error {
+		for _, tx := range chunk.Tx {
+			received = append(received, tx.Hash)
+		}
+		return nil
+	})
+	if len(received) != 3 {
+		t.Errorf("Expected all TX of the new block, got %v", received)
+	}
+}
+
+func TestFetchRawBlock(t *testing.T) {
+	// an external TX of a previous block
+	prev := wire.NewMsgTx(1)
+	prev.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil))
+	prev.AddTxOut(wire.NewTxOut(500000000, nil))
+	prev.AddTxOut(wire.NewTxOut(300000000, nil))
+	prevHash := prev.TxHash()
+
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0xffffffff), []byte{0x01, 0x64}))
+	coinbase.AddTxOut(wire.NewTxOut(625000000, nil))
+
+	spend := wire.NewMsgTx(1)
+	spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 1), nil))
+	spend.AddTxOut(wire.NewTxOut(299999000, nil))
+	spendHash := spend.TxHash()
+
+	// spends an output of the same block
+	child := wire.NewMsgTx(1)
+	child.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&spendHash, 0), nil))
+	child.AddTxOut(wire.NewTxOut(299998000, nil))
+
+	msgBlock := wire.MsgBlock{
+		Header:       wire.BlockHeader{Timestamp: time.Unix(1600000000, 0)},
+		Transactions: []*wire.MsgTx{coinbase, spend, child},
+	}
+	var buf bytes.Buffer
+	if err := msgBlock.Serialize(&buf); err != nil {
+		t.Fatalf("Error serializing block: %+v", err)
+	}
+
+	rpc := fakeBlockRpc{
+		0: hex.EncodeToString(buf.Bytes()),
+		3: &RpcError{Code: rpcInvalidParameter, Message: "Verbosity must be in range 0..2"},
+	}
+	fetcher := newTestFetcher(t, rpc, fakePrevouts{prevHash.String(): prev}, 10)
+	chunks := fetchChunks(t, fetcher)
+	if len(chunks) != 1 || len(chunks[0].Tx) != 3 || !chunks[0].Last || !chunks[0].Time.Equal(time.Unix(1600000000, 0)) {
+		t.Fatalf("Expected 1 chunk with 3 TX, got %d chunks", len(chunks))
+	}
+	if !fetcher.rawBlocks {
+		t.Errorf("Fetcher should fall back to raw blocks")
+	}
+
+	txs := chunks[0].Tx
+	if !txs[0].IsCoinbase() || txs[0].OutputValue() != 625000000 || txs[0].Fee() != 0 {
+		t.Errorf("Unexpected coinbase TX %+v", txs[0])
+	}
+	if txs[1].Hash != spendHash.String() || txs[1].Inputs[0].Prevout.Value != 300000000 || txs[1].Fee() != 1000 {
+		t.Errorf("Unexpected TX %+v", txs[1])
+	}
+	if txs[2].Inputs[0].Prevout.Value != 299999000 || txs[2].Fee() != 1000 || txs[2].BlockHeight != 100 {
+		t.Errorf("Unexpected TX spending an output of the same block %+v", txs[2])
+	}
+	// with the canonical TX order children can come before their parents
+	msgBlock.Transactions = []*wire.MsgTx{coinbase, child, spend}
+	buf.Reset()
+	if err := msgBlock.Serialize(&buf); err != nil {
+		t.Fatalf("Error serializing block: %+v", err)
+	}
+	rpc[0] = hex.EncodeToString(buf.Bytes())
+	fetcher = newTestFetcher(t, rpc, fakePrevouts{prevHash.String(): prev}, 10)
+	txs = fetchChunks(t, fetcher)[0].Tx
+	if txs[1].Inputs[0].Prevout.Value != 299999000 || txs[2].Inputs[0].Prevout.Value != 300000000 {
+		t.Errorf("Unexpected TX spending an output of a later TX %+v", txs[1])
+	}
+}
+
+func TestFetchBlockRpcError(t *testing.T) {
+	rpc := fakeBlockRpc{
+		0: &RpcError{Code: -5, Message: "Block not found"},
+		3: &RpcError{Code: -5, Message: "Block not found"},
+	}
+	fetcher := newTestFetcher(t, rpc, nil, 10)
+	err := fetcher.FetchBlock(context.Background(), "blockhash", 100, func(chunk *BlockChunk) error {
+		t.Errorf("Unexpected chunk %+v", chunk)
+		return nil
+	})
+	rpcErr, ok := errors.Cause(err).(*RpcError)
+	if !ok || rpcErr.Code != -5 {
+		t.Errorf("Expected RPC error -5, got %v", err)
+	}
+
+	// raw block requests return the error of a null result too
+	fetcher.rawBlocks = true
+	err = fetcher.FetchBlock(context.Background(), "blockhash", 100, func(chunk *BlockChunk) error {
+		return nil
+	})
+	if rpcErr, ok = errors.Cause(err).(*RpcError); !ok || rpcErr.Code != -5 {
+		t.Errorf("Expected RPC error -5 of raw block, got %v", err)
+	}
+}
+
+func TestBlockOutputs(t *testing.T) {
+	p2pkh, _ := hex.DecodeString("76a914f5bf48b397dae70be82b3cca4793f8eb2b6cdac988ac")
+	txParser := parser.NewParser(nil)
+	newTx := func(hash string, scripts ...[]byte) *parser.Transaction {
+		tx := &parser.Transaction{Hash: hash}
+		for _, script := range scripts {
+			tx.Outputs = append(tx.Outputs, txParser.NewOutput(1000, script))
+		}
+		return tx
+	}
+	spend := func(hash string, index uint32) *parser.Input {
+		return &parser.Input{PrevHash: hash, PrevIndex: index}
+	}
+
+	outputs := newBlockOutputs(2)
+	outputs.add(newTx("a", p2pkh, p2pkh))
+	outputs.add(newTx("b", p2pkh, []byte{0x6a, 0x01, 0x01}))
+	outputs.add(newTx("c", []byte{0x6a, 0x01, 0x01})) // OP_RETURN only
+	if _, ok := outputs.outputs["c"]; ok || len(outputs.outputs) != 2 {
+		t.Errorf("Expected TX without spendable outputs to be skipped, got %v", outputs.order)
+	}
+	if outputs.spend(spend("a", 0)) == nil || outputs.spend(spend("a", 0)) != nil {
+		t.Errorf("Expected output to be removed once spent")
+	}
+	if outputs.spend(spend("a", 1)) == nil || outputs.outputs["a"] != nil {
+		t.Errorf("Expected TX to be removed once all outputs are spent")
+	}
+	if outputs.spend(spend("b", 1)) != nil || outputs.spend(spend("b", 5)) != nil {
+		t.Errorf("Expected no OP_RETURN or missing output")
+	}
+
+	// the oldest TX are removed and must be fetched from Fulcrum
+	outputs.add(newTx("d", p2pkh))
+	outputs.add(newTx("e", p2pkh))
+	if outputs.spend(spend("b", 0)) != nil || outputs.spend(spend("e", 0)) == nil {
+		t.Errorf("Expected outputs of the oldest TX to be removed, got %v", outputs.order)
+	}
+}
@@ -0,0 +1,141 @@
+package bch
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"time"
+)
+
+// bitcoind returns this error code for TX that are neither in the mempool nor in a block
+const rpcInvalidAddressOrKey = -5
+
+// WatchMempool polls the mempool of the best node in MempoolInterval and sends the TX that were added
+// since the previous poll including the values of their spent outputs. TX that are in the mempool
+// when we start are skipped. Returns a nil channel if watching the mempool is disabled.
+func (b *Bch) WatchMempool(ctx context.Context) <-chan []*parser.Transaction {
+	if b.config.MempoolInterval <= 0 {
+		return nil
+	}
+	respChan := make(chan []*parser.Transaction, 1)
+	go (func() {
+		ticker := time.NewTicker(b.config.MempoolInterval)
+		defer ticker.Stop()
+		known := b.pollMempool(ctx, nil, respChan)
+		for {
+			select {
+			case <-ticker.C:
+				known = b.pollMempool(ctx, known, respChan)
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	})()
+	return respChan
+}
+
+// Sends the TX of the mempool that are not in known and returns the txids of the current mempool.
+// If known is nil, no TX are sent. If fetching TX fails, they are fetched again on the next poll.
+func (b *Bch) pollMempool(ctx context.Context, known map[string]struct{}, send chan<- []*parser.Transaction) map[string]struct{} {
+	node := b.Nodes.GetBestBlockNode()
+	if node == nil {
+		return known
+	}
+	txids, err := node.fetcher.getMempool(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			b.logger.Errorf("Error getting mempool of node %s: %+v", node.Address, err)
+		}
+		return known
+	}
+	current := make(map[string]struct{}, len(txids))
+	added := make([]string, 0, 100)
+	for _, txid := range txids {
+		current[txid] = struct{}{}
+		if _, ok := known[txid]; !ok && known != nil {
+			added = append(added, txid)
+		}
+	}
+	if len(added) == 0 {
+		return current
+	}
+
+	txs, err := node.fetcher.FetchMempoolTransactions(ctx, added)
+	if err != nil {
+		if ctx.Err() == nil {
+			b.logger.Errorf("Error getting %d new mempool TX of node %s: %+v", len(added), node.Address, err)
+		}
+		return known
+	}
+	b.logger.Debugf("Found %d new mempool TX", len(txs))
+	select {
+	case send <- txs:
+	case <-ctx.Done():
+	}
+	return current
+}
+
+// Returns the txids of all TX in the mempool of the node.
+func (f *BlockFetcher) getMempool(ctx context.Context) ([]string, error) {
+	body, err := f.rpc.call(ctx, "getrawmempool", false)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	dec := json.NewDecoder(body)
+	if err = streamResult(dec); err != nil {
+		return nil, err
+	}
+	var txids []string
+	if err = dec.Decode(&txids); err != nil {
+		return nil, errors.Wrap(err, "error decoding mempool")
+	} else if txids == nil {
+		return nil, streamError(dec)
+	}
+	return txids, nil
+}
+
+// FetchMempoolTransactions returns the unconfirmed TX with these txids including the values of all spent outputs.
+// TX that left the mempool in the meantime are skipped.
+func (f *BlockFetcher) FetchMempoolTransactions(ctx context.Context, txids []string) ([]*parser.Transaction, error) {
+	txs := make([]*parser.Transaction, 0, len(txids))
+	outputs := newBlockOutputs(len(txids) + 1)
+	for _, txid := range txids {
+		tx, err := f.fetchMempoolTransaction(ctx, txid)
+		if err != nil {
+			if rpcErr, ok := errors.Cause(err).(*RpcError); ok && rpcErr.Code == rpcInvalidAddressOrKey {
+				f.logger.Debugf("Skipping TX %s that left the mempool: %v", txid, err)
+				continue
+			}
+			return nil, err
+		}
+		outputs.add(tx) // TX can spend outputs of other new TX
+		txs = append(txs, tx)
+	}
+	if err := f.addPrevouts(ctx, txs, outputs); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+// Returns the TX with this txid from the node.
+func (f *BlockFetcher) fetchMempoolTransaction(ctx context.Context, txid string) (*parser.Transaction, error) {
+	body, err := f.rpc.call(ctx, "getrawtransaction", txid, false)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	hexReader, err := newHexResultReader(body)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(hex.NewDecoder(hexReader))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading TX %s", txid)
+	}
+	return f.parser.ParseTransaction(data)
+}
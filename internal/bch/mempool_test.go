@@ -0,0 +1,121 @@
+package bch
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// a node with a mempool of these TX
+type fakeMempoolRpc struct {
+	txids []string
+	txs   map[string]*wire.MsgTx
+}
+
+func (f *fakeMempoolRpc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	res := map[string]interface{}{"id": 1, "result": nil, "error": nil}
+	switch req.Method {
+	case "getrawmempool":
+		res["result"] = f.txids
+	case "getrawtransaction":
+		var txid string
+		json.Unmarshal(req.Params[0], &txid)
+		tx, ok := f.txs[txid]
+		if !ok {
+			res["error"] = &RpcError{Code: rpcInvalidAddressOrKey, Message: "No such mempool or blockchain transaction"}
+			w.WriteHeader(http.StatusInternalServerError)
+			break
+		}
+		var buf bytes.Buffer
+		tx.Serialize(&buf)
+		res["result"] = hex.EncodeToString(buf.Bytes())
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func TestPollMempool(t *testing.T) {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	// an output of a confirmed TX
+	prev := wire.NewMsgTx(1)
+	prev.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 0), nil))
+	prev.AddTxOut(wire.NewTxOut(500000000, nil))
+	prevHash := prev.TxHash()
+
+	old := wire.NewMsgTx(1)
+	old.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{2}, 0), nil))
+	old.AddTxOut(wire.NewTxOut(1000, nil))
+
+	spend := wire.NewMsgTx(1)
+	spend.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), nil))
+	spend.AddTxOut(wire.NewTxOut(499999000, nil))
+	spendHash := spend.TxHash()
+
+	// spends an output of another new TX
+	child := wire.NewMsgTx(1)
+	child.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&spendHash, 0), nil))
+	child.AddTxOut(wire.NewTxOut(499998000, nil))
+
+	rpc := &fakeMempoolRpc{
+		txids: []string{old.TxHash().String()},
+		txs: map[string]*wire.MsgTx{
+			old.TxHash().String():   old,
+			spendHash.String():      spend,
+			child.TxHash().String(): child,
+		},
+	}
+	server := httptest.NewServer(rpc)
+	defer server.Close()
+	node := &Node{Address: strings.TrimPrefix(server.URL, "http://"), stats: &NodeStats{}}
+	node.fetcher = newBlockFetcher(newRpcClient(node), func() rawTransactionSource {
+		return fakePrevouts{prevHash.String(): prev}
+	}, parser.NewParser(nil), 10, logger)
+	b := &Bch{Nodes: &Nodes{Nodes: []*Node{node}}, logger: logger}
+
+	// TX in the mempool when we start are skipped
+	send := make(chan []*parser.Transaction, 1)
+	known := b.pollMempool(context.Background(), nil, send)
+	if len(known) != 1 || len(send) != 0 {
+		t.Fatalf("Expected 1 known TX and nothing sent, got %d known and %d sent", len(known), len(send))
+	}
+
+	// a TX that left the mempool before we fetched it is skipped
+	rpc.txids = []string{old.TxHash().String(), child.TxHash().String(), spendHash.String(), "evicted"}
+	known = b.pollMempool(context.Background(), known, send)
+	if len(known) != 4 || len(send) != 1 {
+		t.Fatalf("Expected 4 known TX and 1 batch sent, got %d known and %d sent", len(known), len(send))
+	}
+	txs := <-send
+	if len(txs) != 2 || txs[0].Hash != child.TxHash().String() || txs[1].Hash != spendHash.String() {
+		t.Fatalf("Expected the 2 new TX, got %+v", txs)
+	}
+	if txs[0].Fee() != 1000 || txs[1].Inputs[0].Prevout.Value != 500000000 || txs[1].Fee() != 1000 || txs[0].BlockHeight != 0 {
+		t.Errorf("Unexpected prevouts of mempool TX %+v %+v", txs[0], txs[1])
+	}
+
+	// nothing new
+	if b.pollMempool(context.Background(), known, send); len(send) != 0 {
+		t.Errorf("Expected no TX to be sent again, got %d", len(send))
+	}
+}
@@ -0,0 +1,85 @@
+package network
+
+import (
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// Names of the supported networks.
+const (
+	MAINNET  = "mainnet"
+	TESTNET  = "testnet" // testnet3
+	TESTNET4 = "testnet4"
+	CHIPNET  = "chipnet"
+	REGTEST  = "regtest"
+)
+
+// Network are the chain params of a BCH network and how it is shown in messages.
+type Network struct {
+	Name          string
+	Params        *chaincfg.Params
+	BlockExplorer string // default URL with %s for the TX hash
+	Currency      string // the hashtag of the coin in messages
+	Symbol        string
+}
+
+var networks = map[string]*Network{
+	MAINNET: {
+		Name:          MAINNET,
+		Params:        &chaincfg.MainNetParams,
+		BlockExplorer: "https://explorer.bitcoin.com/bch/tx/%s",
+		Currency:      "BitcoinCash",
+		Symbol:        "BCH",
+	},
+	TESTNET: {
+		Name:          TESTNET,
+		Params:        &chaincfg.TestNet3Params,
+		BlockExplorer: "https://tbch.loping.net/tx/%s",
+		Currency:      "BitcoinCashTestnet",
+		Symbol:        "tBCH",
+	},
+	TESTNET4: {
+		Name:          TESTNET4,
+		Params:        &chaincfg.TestNet4Params,
+		BlockExplorer: "https://tbch4.loping.net/tx/%s",
+		Currency:      "BitcoinCashTestnet",
+		Symbol:        "tBCH",
+	},
+	CHIPNET: {
+		Name:          CHIPNET,
+		Params:        &chaincfg.TestNet4Params, // same address encoding as testnet4 (bchtest: prefix)
+		BlockExplorer: "https://chipnet.imaginary.cash/tx/%s",
+		Currency:      "BitcoinCashChipnet",
+		Symbol:        "tBCH",
+	},
+	REGTEST: {
+		Name:          REGTEST,
+		Params:        &chaincfg.RegressionNetParams,
+		BlockExplorer: "%s", // no public explorer, show the TX hash
+		Currency:      "BitcoinCashRegtest",
+		Symbol:        "rBCH",
+	},
+}
+
+// Get returns the network with this name. An empty name returns mainnet.
+func Get(name string) (*Network, error) {
+	if len(name) == 0 {
+		name = MAINNET
+	}
+	net, ok := networks[name]
+	if !ok {
+		return nil, errors.Errorf("unknown network %s (supported: %v)", name, Names())
+	}
+	return net, nil
+}
+
+// Names returns the names of all supported networks.
+func Names() []string {
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,23 @@
+package network
+
+import (
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	net, err := Get("")
+	if err != nil || net.Name != MAINNET {
+		t.Fatalf("Expected mainnet as default, got %+v %v", net, err)
+	}
+	for _, name := range Names() {
+		net, err = Get(name)
+		if err != nil {
+			t.Fatalf("Error getting network %s: %+v", name, err)
+		} else if net.Params == nil || len(net.Symbol) == 0 || len(net.Currency) == 0 {
+			t.Errorf("Incomplete network %s: %+v", name, net)
+		}
+	}
+	if _, err = Get("signet"); err == nil {
+		t.Errorf("Expected error for unknown network")
+	}
+}
@@ -3,9 +3,16 @@ package bch
 import (
 	"github.com/checksum0/go-electrum/electrum"
 	"github.com/prompt-cash/go-bitcoin"
+	"sync"
 	"time"
 )
 
+// how many lost connections to keep per node
+const maxNodeConnectErrors = 20
+
+// shown instead of secrets in the HTTP API
+const redactedSecret = "***"
+
 type Nodes struct {
 	Nodes []*Node
 }
@@ -13,7 +20,7 @@ type Nodes struct {
 func (nodes *Nodes) GetBestBlockNode() *Node {
 	var best *Node
 	for _, node := range nodes.Nodes {
-		if best == nil || best.stats == nil || node.stats.BlockHeight.BlockNumber > best.stats.BlockHeight.BlockNumber {
+		if best == nil || best.stats == nil || node.GetBlockHeight() > best.GetBlockHeight() {
 			best = node
 		}
 	}
@@ -31,10 +38,14 @@ type Node struct {
 	Fulcrum        string `mapstructure:"Fulcrum"`
 	FulcrumPingMin int    `mapstructure:"FulcrumPingMin"`
 
-	bchClient      *bitcoin.Bitcoind
-	electrumClient *electrum.Client
+	bchClient *bitcoin.Bitcoind
+	fetcher   *BlockFetcher
 
-	stats *NodeStats
+	clientLock     sync.Mutex
+	electrumClient *electrum.Client // replaced on reconnect
+
+	statsLock sync.Mutex
+	stats     *NodeStats
 }
 
 // Node stats available via HTTP API as JSON
@@ -52,11 +63,27 @@ type BestBlockHeight struct {
 }
 
 type NodeConnectError struct {
-	When  time.Time `json:"when"`
-	Error error     `json:"error"`
+	When    time.Time `json:"when"`
+	Service string    `json:"service"` // rpc|fulcrum
+	Error   string    `json:"error"`
+}
+
+// NodeStatus is the status of a node with its config (without secrets) served via HTTP API as JSON.
+type NodeStatus struct {
+	Address       string    `json:"address"`
+	User          string    `json:"user"`
+	Password      string    `json:"password"` // redacted
+	SSL           bool      `json:"ssl"`
+	Fulcrum       string    `json:"fulcrum"`
+	FulcrumStatus string    `json:"fulcrum_status"` // subscribed|connected|disconnected
+	Active        bool      `json:"active"`         // the node we receive new block headers from
+	LagBlocks     uint32    `json:"lag_blocks"`     // how many blocks this node is behind the best node
+	Stats         NodeStats `json:"stats"`
 }
 
 func (n *Node) SetConnected() {
+	n.statsLock.Lock()
+	defer n.statsLock.Unlock()
 	if n.stats.Connected.IsZero() {
 		n.stats.Connected = time.Now()
 	}
@@ -64,6 +91,8 @@ func (n *Node) SetConnected() {
 }
 
 func (n *Node) SetBlockHeight(blockHeight uint32, timestamp time.Time) {
+	n.statsLock.Lock()
+	defer n.statsLock.Unlock()
 	n.stats.BlockHeight = BestBlockHeight{
 		BlockNumber: blockHeight,
 		BlockTime:   timestamp,
@@ -72,10 +101,52 @@ func (n *Node) SetBlockHeight(blockHeight uint32, timestamp time.Time) {
 	//n.updateStats()
 }
 
+// AddConnectError adds an error to the history of lost connections.
+// service is the name of the connection (rpc or fulcrum).
+func (n *Node) AddConnectError(service string, err error) {
+	n.statsLock.Lock()
+	defer n.statsLock.Unlock()
+	if service == "rpc" {
+		n.stats.Connected = time.Time{} // reset so we see when it connected again
+	}
+	if len(n.stats.LostConnections) >= maxNodeConnectErrors {
+		n.stats.LostConnections = n.stats.LostConnections[1:]
+	}
+	n.stats.LostConnections = append(n.stats.LostConnections, &NodeConnectError{
+		When:    time.Now(),
+		Service: service,
+		Error:   err.Error(),
+	})
+}
+
+func (n *Node) GetBlockHeight() uint32 {
+	n.statsLock.Lock()
+	defer n.statsLock.Unlock()
+	return n.stats.BlockHeight.BlockNumber
+}
+
+// GetStats returns a copy of the current node stats.
+func (n *Node) GetStats() NodeStats {
+	n.statsLock.Lock()
+	defer n.statsLock.Unlock()
+	stats := *n.stats
+	stats.LostConnections = make([]*NodeConnectError, len(n.stats.LostConnections))
+	copy(stats.LostConnections, n.stats.LostConnections)
+	return stats
+}
+
 func (n *Node) GetBchClient() *bitcoin.Bitcoind {
 	return n.bchClient
 }
 
 func (n *Node) GetElectrumClient() *electrum.Client {
+	n.clientLock.Lock()
+	defer n.clientLock.Unlock()
 	return n.electrumClient
 }
+
+func (n *Node) setElectrumClient(client *electrum.Client) {
+	n.clientLock.Lock()
+	defer n.clientLock.Unlock()
+	n.electrumClient = client
+}
@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/txscript"
+	"github.com/gcash/bchd/wire"
+	"github.com/pkg/errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Parser decodes serialized blocks and transactions of a network.
+type Parser struct {
+	params *chaincfg.Params
+}
+
+// BlockReader reads the transactions of a serialized block one by one,
+// so large blocks don't have to be kept in memory.
+type BlockReader struct {
+	parser *Parser
+	r      io.Reader
+	height uint32
+	header wire.BlockHeader
+	count  uint64
+	read   uint64
+}
+
+// NewParser creates a parser decoding addresses of the network of params. nil defaults to mainnet.
+func NewParser(params *chaincfg.Params) *Parser {
+	if params == nil {
+		params = &chaincfg.MainNetParams
+	}
+	return &Parser{params: params}
+}
+
+// ParseTransaction decodes a serialized TX. The values of spent outputs are unknown.
+func (p *Parser) ParseTransaction(data []byte) (*Transaction, error) {
+	var msg wire.MsgTx
+	if err := msg.Deserialize(bytes.NewReader(data)); err != nil {
+		return nil, errors.Wrap(err, "error decoding TX")
+	}
+	return p.NewTransaction(&msg), nil
+}
+
+// ParseBlock decodes a serialized block with all transactions.
+func (p *Parser) ParseBlock(data []byte, height uint32) (*Block, error) {
+	reader, err := p.NewBlockReader(bytes.NewReader(data), height)
+	if err != nil {
+		return nil, err
+	}
+	block := &Block{
+		Hash:   reader.Hash(),
+		Height: height,
+		Time:   reader.Time(),
+		Tx:     make([]*Transaction, 0, 100), // don't trust the TX count for memory allocation
+	}
+	for {
+		tx, err := reader.Next()
+		if err == io.EOF {
+			return block, nil
+		} else if err != nil {
+			return nil, err
+		}
+		block.Tx = append(block.Tx, tx)
+	}
+}
+
+// NewBlockReader reads the header of a serialized block from r.
+// The transactions can then be read with Next.
+func (p *Parser) NewBlockReader(r io.Reader, height uint32) (*BlockReader, error) {
+	reader := &BlockReader{
+		parser: p,
+		r:      bufio.NewReader(r),
+		height: height,
+	}
+	if err := reader.header.Deserialize(reader.r); err != nil {
+		return nil, errors.Wrap(err, "error reading block header")
+	}
+	var err error
+	reader.count, err = wire.ReadVarInt(reader.r, wire.ProtocolVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading block TX count")
+	}
+	return reader, nil
+}
+
+// NewTransaction converts a TX of the wire package.
+func (p *Parser) NewTransaction(msg *wire.MsgTx) *Transaction {
+	tx := &Transaction{
+		Hash:    msg.TxHash().String(),
+		Size:    msg.SerializeSize(),
+		Inputs:  make([]*Input, len(msg.TxIn)),
+		Outputs: make([]*Output, len(msg.TxOut)),
+	}
+	for i, in := range msg.TxIn {
+		tx.Inputs[i] = &Input{
+			PrevHash:  in.PreviousOutPoint.Hash.String(),
+			PrevIndex: in.PreviousOutPoint.Index,
+			Script:    in.SignatureScript,
+		}
+	}
+	for i, out := range msg.TxOut {
+		tx.Outputs[i] = p.NewOutput(price.Amount(out.Value), out.PkScript)
+	}
+	return tx
+}
+
+// NewOutput creates an output and decodes the type and address of its script.
+func (p *Parser) NewOutput(value price.Amount, script []byte) *Output {
+	out := &Output{
+		Value:      value,
+		Script:     script,
+		ScriptType: SCRIPT_NONSTANDARD,
+	}
+	class, addresses, _, err := txscript.ExtractPkScriptAddrs(script, p.params)
+	if err != nil {
+		return out
+	}
+	switch class {
+	case txscript.PubKeyHashTy:
+		out.ScriptType = SCRIPT_P2PKH
+	case txscript.ScriptHashTy:
+		out.ScriptType = SCRIPT_P2SH
+	case txscript.PubKeyTy:
+		out.ScriptType = SCRIPT_P2PK
+	case txscript.MultiSigTy:
+		out.ScriptType = SCRIPT_MULTISIG
+	case txscript.NullDataTy:
+		out.ScriptType = SCRIPT_NULLDATA
+	}
+	if len(addresses) == 1 && out.ScriptType != SCRIPT_MULTISIG {
+		out.Address = p.withPrefix(addresses[0].EncodeAddress())
+	}
+	return out
+}
+
+// Returns the cash address with the prefix of the network.
+func (p *Parser) withPrefix(address string) string {
+	if strings.Contains(address, ":") {
+		return address
+	}
+	return p.params.CashAddressPrefix + ":" + address
+}
+
+// Hash returns the hash of the block.
+func (b *BlockReader) Hash() string {
+	return b.header.BlockHash().String()
+}
+
+// Time returns the timestamp of the block header.
+func (b *BlockReader) Time() time.Time {
+	return b.header.Timestamp
+}
+
+// Count returns the number of TX in the block.
+func (b *BlockReader) Count() uint64 {
+	return b.count
+}
+
+// Next returns the next TX of the block or io.EOF after the last TX.
+func (b *BlockReader) Next() (*Transaction, error) {
+	if b.read >= b.count {
+		return nil, io.EOF
+	}
+	var msg wire.MsgTx
+	if err := msg.Deserialize(b.r); err != nil {
+		return nil, errors.Wrapf(err, "error reading TX %d of block", b.read)
+	}
+	b.read++
+	tx := b.parser.NewTransaction(&msg)
+	tx.BlockHeight = b.height
+	return tx, nil
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/gcash/bchd/chaincfg"
+	"github.com/gcash/bchd/chaincfg/chainhash"
+	"github.com/gcash/bchd/wire"
+	"io"
+	"testing"
+	"time"
+)
+
+const testHash160 = "f5bf48b397dae70be82b3cca4793f8eb2b6cdac9"
+
+func testScript(t *testing.T, prefix string, suffix string) []byte {
+	script, err := hex.DecodeString(prefix + testHash160 + suffix)
+	if err != nil {
+		t.Fatalf("Invalid script: %+v", err)
+	}
+	return script
+}
+
+func newTestBlock(t *testing.T) (*wire.MsgBlock, []byte) {
+	coinbase := wire.NewMsgTx(1)
+	coinbase.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{}, 0xffffffff), []byte{0x01, 0x64}))
+	coinbase.AddTxOut(wire.NewTxOut(625000000, testScript(t, "76a914", "88ac")))
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{1}, 3), []byte{0x00}))
+	tx.AddTxOut(wire.NewTxOut(100000000, testScript(t, "a914", "87")))
+	tx.AddTxOut(wire.NewTxOut(0, []byte{0x6a, 0x02, 0x01, 0x02}))
+	tx.AddTxOut(wire.NewTxOut(1234, []byte{0x51}))
+
+	block := &wire.MsgBlock{
+		Header:       wire.BlockHeader{Timestamp: time.Unix(1600000000, 0)},
+		Transactions: []*wire.MsgTx{coinbase, tx},
+	}
+	var buf bytes.Buffer
+	if err := block.Serialize(&buf); err != nil {
+		t.Fatalf("Error serializing block: %+v", err)
+	}
+	return block, buf.Bytes()
+}
+
+func TestParseBlock(t *testing.T) {
+	msgBlock, data := newTestBlock(t)
+	block, err := NewParser(nil).ParseBlock(data, 100)
+	if err != nil {
+		t.Fatalf("Error parsing block: %+v", err)
+	}
+	if block.Hash != msgBlock.BlockHash().String() || block.Height != 100 || !block.Time.Equal(time.Unix(1600000000, 0)) || len(block.Tx) != 2 {
+		t.Fatalf("Unexpected block %+v", block)
+	}
+
+	coinbase, tx := block.Tx[0], block.Tx[1]
+	if !coinbase.IsCoinbase() || coinbase.Fee() != 0 || coinbase.OutputValue() != 625000000 {
+		t.Errorf("Unexpected coinbase TX %+v", coinbase)
+	}
+	if coinbase.Outputs[0].ScriptType != SCRIPT_P2PKH || coinbase.Outputs[0].Address != "bitcoincash:qr6m7j9njldwwzlg9v7v53unlr4jkmx6eylep8ekg2" {
+		t.Errorf("Unexpected P2PKH output %+v", coinbase.Outputs[0])
+	}
+
+	if tx.IsCoinbase() || tx.Hash != msgBlock.Transactions[1].TxHash().String() || tx.BlockHeight != 100 {
+		t.Errorf("Unexpected TX %+v", tx)
+	}
+	if tx.Size != msgBlock.Transactions[1].SerializeSize() || tx.OutputValue() != 100001234 {
+		t.Errorf("Unexpected TX size %d or value %d", tx.Size, tx.OutputValue())
+	}
+	if in := tx.Inputs[0]; in.PrevHash != (chainhash.Hash{1}).String() || in.PrevIndex != 3 || in.Prevout != nil {
+		t.Errorf("Unexpected input %+v", in)
+	}
+	if tx.Outputs[0].ScriptType != SCRIPT_P2SH || tx.Outputs[0].Address != "bitcoincash:pr6m7j9njldwwzlg9v7v53unlr4jkmx6eyguug74nh" {
+		t.Errorf("Unexpected P2SH output %+v", tx.Outputs[0])
+	}
+	if tx.Outputs[1].ScriptType != SCRIPT_NULLDATA || tx.Outputs[1].Address != "" {
+		t.Errorf("Unexpected OP_RETURN output %+v", tx.Outputs[1])
+	}
+	if tx.Outputs[2].ScriptType != SCRIPT_NONSTANDARD || tx.Outputs[2].Address != "" {
+		t.Errorf("Unexpected nonstandard output %+v", tx.Outputs[2])
+	}
+}
+
+func TestBlockReader(t *testing.T) {
+	_, data := newTestBlock(t)
+	reader, err := NewParser(nil).NewBlockReader(bytes.NewReader(data), 100)
+	if err != nil {
+		t.Fatalf("Error reading block: %+v", err)
+	}
+	if reader.Count() != 2 {
+		t.Fatalf("Expected 2 TX, got %d", reader.Count())
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = reader.Next(); err != nil {
+			t.Fatalf("Error reading TX %d: %+v", i, err)
+		}
+	}
+	if _, err = reader.Next(); err != io.EOF {
+		t.Errorf("Expected EOF after the last TX, got %v", err)
+	}
+
+	// truncated blocks return an error instead of EOF
+	reader, err = NewParser(nil).NewBlockReader(bytes.NewReader(data[:len(data)-10]), 100)
+	if err != nil {
+		t.Fatalf("Error reading block: %+v", err)
+	}
+	reader.Next()
+	if _, err = reader.Next(); err == nil || err == io.EOF {
+		t.Errorf("Expected error reading truncated TX, got %v", err)
+	}
+}
+
+func TestTransactionFee(t *testing.T) {
+	p := NewParser(&chaincfg.TestNet4Params)
+	tx := &Transaction{
+		Inputs: []*Input{
+			{PrevHash: "a", Prevout: p.NewOutput(200000000, testScript(t, "76a914", "88ac"))},
+			{PrevHash: "b"},
+		},
+		Outputs: []*Output{p.NewOutput(150000000, nil), p.NewOutput(49999000, nil)},
+	}
+	if tx.HasPrevouts() || tx.Fee() != 0 {
+		t.Errorf("Expected no fee with unknown prevouts, got %d", tx.Fee())
+	}
+	tx.Inputs[1].Prevout = p.NewOutput(1000, nil)
+	if !tx.HasPrevouts() || tx.InputValue() != 200001000 || tx.Fee() != 2000 {
+		t.Errorf("Unexpected input value %d or fee %d", tx.InputValue(), tx.Fee())
+	}
+	if address := tx.Inputs[0].Prevout.Address; address != "bchtest:qr6m7j9njldwwzlg9v7v53unlr4jkmx6eymt9qmp0k" {
+		t.Errorf("Unexpected testnet address %s", address)
+	}
+}
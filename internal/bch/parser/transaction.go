@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"math"
+	"time"
+)
+
+// Types of output scripts.
+type ScriptType string
+
+const (
+	SCRIPT_P2PKH       ScriptType = "p2pkh"
+	SCRIPT_P2SH        ScriptType = "p2sh"
+	SCRIPT_P2PK        ScriptType = "p2pk"
+	SCRIPT_MULTISIG    ScriptType = "multisig"
+	SCRIPT_NULLDATA    ScriptType = "nulldata" // OP_RETURN
+	SCRIPT_NONSTANDARD ScriptType = "nonstandard"
+)
+
+// the previous output of coinbase inputs
+const (
+	coinbaseHash  = "0000000000000000000000000000000000000000000000000000000000000000"
+	coinbaseIndex = math.MaxUint32
+)
+
+// Block is a block with all transactions.
+type Block struct {
+	Hash   string         `json:"hash"`
+	Height uint32         `json:"height"`
+	Time   time.Time      `json:"time"` // the timestamp of the block header
+	Tx     []*Transaction `json:"tx"`
+}
+
+// Transaction is a BCH transaction.
+type Transaction struct {
+	Hash        string    `json:"hash"`
+	BlockHeight uint32    `json:"block_height"`
+	Size        int       `json:"size"` // bytes, 0 if unknown
+	Inputs      []*Input  `json:"inputs"`
+	Outputs     []*Output `json:"outputs"`
+}
+
+// Input spends a previous output.
+type Input struct {
+	PrevHash  string  `json:"prev_hash"`
+	PrevIndex uint32  `json:"prev_index"`
+	Script    []byte  `json:"script"`            // the signature script or coinbase data
+	Prevout   *Output `json:"prevout,omitempty"` // the spent output, nil if unknown
+}
+
+// Output is a TX output with the decoded address of its script.
+type Output struct {
+	Value      price.Amount `json:"value"`
+	Script     []byte       `json:"script"`
+	ScriptType ScriptType   `json:"script_type"`
+	Address    string       `json:"address,omitempty"` // cash address with prefix, empty for scripts without (single) address
+}
+
+// NewCoinbaseInput creates the input of a coinbase TX with the coinbase data.
+func NewCoinbaseInput(script []byte) *Input {
+	return &Input{
+		PrevHash:  coinbaseHash,
+		PrevIndex: coinbaseIndex,
+		Script:    script,
+	}
+}
+
+// IsCoinbase returns true if this is the coinbase TX of a block.
+func (tx *Transaction) IsCoinbase() bool {
+	return len(tx.Inputs) == 1 && tx.Inputs[0].IsCoinbase()
+}
+
+// HasPrevouts returns true if the values of all spent outputs are known.
+func (tx *Transaction) HasPrevouts() bool {
+	if tx.IsCoinbase() {
+		return true
+	}
+	for _, in := range tx.Inputs {
+		if in.Prevout == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// InputValue returns the sum of all spent outputs. Unknown prevouts are counted as 0.
+func (tx *Transaction) InputValue() price.Amount {
+	var total price.Amount
+	for _, in := range tx.Inputs {
+		if in.Prevout != nil {
+			total += in.Prevout.Value
+		}
+	}
+	return total
+}
+
+// OutputValue returns the sum of all outputs.
+func (tx *Transaction) OutputValue() price.Amount {
+	var total price.Amount
+	for _, out := range tx.Outputs {
+		total += out.Value
+	}
+	return total
+}
+
+// Fee returns the fee of the TX, 0 for coinbase TX and TX with unknown prevouts.
+func (tx *Transaction) Fee() price.Amount {
+	if tx.IsCoinbase() || !tx.HasPrevouts() {
+		return 0
+	}
+	return tx.InputValue() - tx.OutputValue()
+}
+
+// IsCoinbase returns true if this is the input of a coinbase TX.
+func (in *Input) IsCoinbase() bool {
+	return in.PrevIndex == coinbaseIndex && in.PrevHash == coinbaseHash
+}
@@ -0,0 +1,208 @@
+package bch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// bitcoind returns this error code for unsupported getblock verbosity levels
+const rpcInvalidParameter = -8
+
+// RpcError is an error returned by the JSON-RPC API of a node.
+type RpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RpcError) Error() string {
+	return fmt.Sprintf("RPC error %d: %s", e.Code, e.Message)
+}
+
+// Calls JSON-RPC methods go-bitcoin doesn't support. Responses are streamed instead of
+// being read into memory, so we can process large blocks.
+type rpcClient struct {
+	url      string
+	user     string
+	password string
+	client   *http.Client
+}
+
+type rpcRequest struct {
+	JsonRpc string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+func newRpcClient(node *Node) *rpcClient {
+	protocol := "http"
+	if node.SSL {
+		protocol = "https"
+	}
+	return &rpcClient{
+		url:      protocol + "://" + node.Address,
+		user:     node.User,
+		password: node.Password,
+		client:   &http.Client{}, // no timeout, large blocks can take long. requests are canceled via context
+	}
+}
+
+// call sends the request and returns the response body. The caller must close it.
+func (c *rpcClient) call(ctx context.Context, method string, params ...interface{}) (io.ReadCloser, error) {
+	body, err := json.Marshal(&rpcRequest{
+		JsonRpc: "1.0",
+		ID:      1,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding RPC request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating RPC request")
+	}
+	req.SetBasicAuth(c.user, c.password)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error calling RPC %s", method)
+	}
+	// bitcoind returns errors with status 404 and 500 and a JSON body
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound && res.StatusCode != http.StatusInternalServerError {
+		res.Body.Close()
+		return nil, errors.Errorf("RPC %s returned HTTP status %d", method, res.StatusCode)
+	}
+	return res.Body, nil
+}
+
+// streamResult positions dec at the value of the result, so it can be decoded token by token.
+// Returns the RPC error if it comes before the result.
+func streamResult(dec *json.Decoder) error {
+	if token, err := dec.Token(); err != nil || token != json.Delim('{') {
+		return errors.Errorf("invalid RPC response: %v %v", token, err)
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return errors.Wrap(err, "error reading RPC response")
+		}
+		if key == "result" {
+			return nil
+		} else if key == "error" {
+			var rpcErr *RpcError
+			if err = dec.Decode(&rpcErr); err != nil {
+				return errors.Wrap(err, "error decoding RPC error")
+			} else if rpcErr != nil {
+				return rpcErr
+			}
+			continue
+		}
+		var skip json.RawMessage
+		if err = dec.Decode(&skip); err != nil {
+			return errors.Wrap(err, "error reading RPC response")
+		}
+	}
+	return errors.New("RPC response has no result")
+}
+
+// Returns the RPC error following a null result. dec must be positioned at the result.
+func streamError(dec *json.Decoder) error {
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return errors.Wrap(err, "error reading RPC response")
+		}
+		if key == "error" {
+			var rpcErr *RpcError
+			if err = dec.Decode(&rpcErr); err != nil {
+				return errors.Wrap(err, "error decoding RPC error")
+			} else if rpcErr != nil {
+				return rpcErr
+			}
+			continue
+		}
+		var skip json.RawMessage
+		if err = dec.Decode(&skip); err != nil {
+			return errors.Wrap(err, "error reading RPC response")
+		}
+	}
+	return errors.New("RPC response has neither result nor error")
+}
+
+// hexResultReader reads the hex string of a result without reading the whole response into memory.
+// It returns io.EOF at the closing quote of the string.
+type hexResultReader struct {
+	r    *bufio.Reader
+	done bool
+}
+
+// newHexResultReader returns a reader of the hex string result of the response body.
+// Returns the RPC error if the result is not a string.
+func newHexResultReader(body io.Reader) (*hexResultReader, error) {
+	dec := json.NewDecoder(body)
+	if err := streamResult(dec); err != nil {
+		return nil, err
+	}
+	// continue after the "result" key with the bytes the decoder didn't consume yet
+	r := bufio.NewReader(io.MultiReader(dec.Buffered(), body))
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading RPC result")
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n', ':':
+			continue
+		case '"':
+			return &hexResultReader{r: r}, nil
+		}
+		// not a string, so the result is null and there is an error
+		rest, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading RPC response")
+		}
+		dec = json.NewDecoder(strings.NewReader(`{"result":` + string(c) + string(rest)))
+		if err = streamResult(dec); err != nil {
+			return nil, err
+		}
+		var skip json.RawMessage
+		if err = dec.Decode(&skip); err != nil {
+			return nil, errors.Wrap(err, "error reading RPC response")
+		}
+		return nil, streamError(dec)
+	}
+}
+
+func (h *hexResultReader) Read(p []byte) (int, error) {
+	if h.done {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) {
+		c, err := h.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF // the string must end with a quote
+			}
+			return n, err
+		} else if c == '"' {
+			h.done = true
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n, nil
+		}
+		p[n] = c
+		n++
+	}
+	return n, nil
+}
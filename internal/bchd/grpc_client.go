@@ -12,7 +12,6 @@ import (
 	"github.com/Ekliptor/cashwhale/pkg/notification"
 	"github.com/Ekliptor/cashwhale/pkg/price"
 	"github.com/Ekliptor/cashwhale/pkg/txcounter"
-	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
@@ -23,14 +22,32 @@ import (
 type GRPCClient struct {
 	Client pb.BchrpcClient
 
+	config  GrpcClientConfig
 	counter *txcounter.TxCounter
 	logger  log.Logger
 	monitor *monitoring.HttpMonitoring
 	conn    *grpc.ClientConn
 }
 
-func NewGrpcClient(logger log.Logger, monitor *monitoring.HttpMonitoring, counter *txcounter.TxCounter) (grpcClient *GRPCClient, err error) {
+type GrpcClientConfig struct {
+	Address             string
+	AuthenticationToken string
+	RootCertFile        string
+	CaDomain            string
+	AllowSelfSigned     bool
+
+	WhaleThresholdBch float64
+	UpperTxPercent    float64
+	MinTxCount        int
+
+	Notify         []*notification.NotificationReceiver
+	Notifier       notification.NotifierConfig
+	TweetThreshold time.Duration
+}
+
+func NewGrpcClient(config GrpcClientConfig, logger log.Logger, monitor *monitoring.HttpMonitoring, counter *txcounter.TxCounter) (grpcClient *GRPCClient, err error) {
 	grpcClient = &GRPCClient{
+		config:  config,
 		counter: counter,
 		logger: logger.WithFields(log.Fields{
 			"module": "bchd_grpc",
@@ -40,21 +57,21 @@ func NewGrpcClient(logger log.Logger, monitor *monitoring.HttpMonitoring, counte
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	target := viper.GetString("BCHD.Address")
+	target := config.Address
 	logger.Infof("Connecting to BCHD at: %s", target)
 	var opts []grpc.DialOption
-	if viper.GetString("BCHD.RootCertFile") != "" {
-		creds, err := credentials.NewClientTLSFromFile(viper.GetString("BCHD.RootCertFile"), viper.GetString("BCHD.CaDomain"))
+	if config.RootCertFile != "" {
+		creds, err := credentials.NewClientTLSFromFile(config.RootCertFile, config.CaDomain)
 		if err != nil {
 			logger.Errorf("Failed to create gRPC TLS credentials %v", err)
 			return nil, err
 		}
 		opts = append(opts, grpc.WithTransportCredentials(creds))
 	} else {
-		config := &tls.Config{
-			InsecureSkipVerify: viper.GetBool("BCHD.AllowSelfSigned"),
+		tlsConfig := &tls.Config{
+			InsecureSkipVerify: config.AllowSelfSigned,
 		}
-		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
 	}
 	opts = append(opts, grpc.WithBlock())
 	grpcClient.conn, err = grpc.DialContext(ctx, target, opts...)
@@ -82,10 +99,10 @@ func (gc *GRPCClient) Close() error {
 	return gc.conn.Close()
 }
 
-func NewReqContext() context.Context {
+func NewReqContext(authenticationToken string) context.Context {
 	reqCtx := context.Background()
-	if viper.GetString("BCHD.AuthenticationToken") != "" {
-		reqCtx = metadata.AppendToOutgoingContext(reqCtx, "AuthenticationToken", viper.GetString("BCHD.AuthenticationToken"))
+	if authenticationToken != "" {
+		reqCtx = metadata.AppendToOutgoingContext(reqCtx, "AuthenticationToken", authenticationToken)
 	}
 	return reqCtx
 }
@@ -152,9 +169,9 @@ func (gc *GRPCClient) ReadTransactionStream(reqCtx context.Context, cancel conte
 				amountBCH += price.SatoshiToBitcoin(out.GetValue())
 			}
 			gc.counter.AddTransaction(float32(amountBCH))
-			if amountBCH < viper.GetFloat64("Message.WahleThresholdBCH") {
+			if amountBCH < gc.config.WhaleThresholdBch {
 				//if gc.counter.GetTransactionCount() < viper.GetInt("Average.MinTxCount") || amountBCH < float64(gc.counter.GetAverageTransactionSize()) * viper.GetFloat64("Average.AverageTxFactor") {
-				if gc.counter.GetTransactionCount() < viper.GetInt("Average.MinTxCount") || amountBCH < float64(gc.counter.GetUpperTransactionSizePercent(float32(viper.GetFloat64("Average.UpperTxPercent")))) {
+				if gc.counter.GetTransactionCount() < gc.config.MinTxCount || amountBCH < float64(gc.counter.GetUpperTransactionSizePercent(float32(gc.config.UpperTxPercent))) {
 					continue
 				}
 			}
@@ -195,24 +212,15 @@ func (gc *GRPCClient) checkLastTweetTime() {
 	}
 
 	lastTweetTime := time.Unix(lastTweet.When, 0)
-	threshold := time.Duration(viper.GetInt("Monitoring.TweetThresholdH"))
-	if lastTweetTime.Add(threshold * time.Hour).After(time.Now()) {
-		return
-	}
-
-	// TODO move config loading to a better place. Errors won't happen often though
-	notifier := make([]*notification.NotificationReceiver, 0, 5)
-	err := viper.UnmarshalKey("Notify", &notifier)
-	if err != nil {
-		gc.logger.Errorf("Error reading notifier config %+v", err)
+	if lastTweetTime.Add(gc.config.TweetThreshold).After(time.Now()) {
 		return
 	}
 
-	sendData := notification.NewNotification(fmt.Sprintf("%s tweets stopped", viper.GetString("App.Name")),
+	sendData := notification.NewNotification(fmt.Sprintf("%s tweets stopped", gc.config.Notifier.AppName),
 		fmt.Sprintf("Last tweet: %s ago", time.Since(lastTweetTime)))
 
-	for _, notify := range notifier {
-		_, err = notification.CreateAndSendNotification(sendData, notify)
+	for _, notify := range gc.config.Notify {
+		_, err := notification.CreateAndSendNotification(sendData, notify, gc.config.Notifier)
 		if err != nil {
 			gc.logger.Errorf("Error sending 'tweets stopped' notification %+v", err)
 			return
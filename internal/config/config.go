@@ -0,0 +1,311 @@
+package config
+
+import (
+	"github.com/Ekliptor/cashwhale/internal/bch/network"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/pkg/notification"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// shown instead of secrets when printing the config
+const redactedSecret = "***"
+
+// DefaultFulcrumPingMin is the ping interval of nodes without FulcrumPingMin.
+const DefaultFulcrumPingMin = 5
+
+// Config is the schema of config.yaml with all settings used by the bot.
+type Config struct {
+	App        AppConfig                            `mapstructure:"App"`
+	Log        LogConfig                            `mapstructure:"Log"`
+	BCH        BchConfig                            `mapstructure:"BCH"`
+	BCHD       BchdConfig                           `mapstructure:"BCHD"`
+	Message    MessageConfig                        `mapstructure:"Message"`
+	Average    AverageConfig                        `mapstructure:"Average"`
+	HTTP       HttpConfig                           `mapstructure:"HTTP"`
+	Email      EmailConfig                          `mapstructure:"Email"`
+	Monitoring MonitoringConfig                     `mapstructure:"Monitoring"`
+	Admin      AdminConfig                          `mapstructure:"Admin"`
+	Store      StoreConfig                          `mapstructure:"Store"`
+	Twitter    TwitterConfig                        `mapstructure:"Twitter"`
+	Telegram   TelegramConfig                       `mapstructure:"Telegram"`
+	Price      PriceConfig                          `mapstructure:"Price"`
+	Miner      MinerConfig                          `mapstructure:"Miner"`
+	Classifier ClassifierConfig                     `mapstructure:"Classifier"`
+	Notify     []*notification.NotificationReceiver `mapstructure:"Notify"`
+}
+
+type AppConfig struct {
+	Name string `mapstructure:"Name"`
+}
+
+type LogConfig struct {
+	Level      string `mapstructure:"Level"` // debug|info|warn|error
+	Color      bool   `mapstructure:"Color"`
+	JSON       bool   `mapstructure:"JSON"`
+	EnableFile bool   `mapstructure:"EnableFile"`
+}
+
+type BchConfig struct {
+	Network        string        `mapstructure:"Network"` // mainnet|testnet|testnet4|chipnet|regtest
+	Nodes          []*NodeConfig `mapstructure:"Nodes"`
+	MempoolPollSec int           `mapstructure:"MempoolPollSec"` // 0 = only watch TX in blocks
+}
+
+type NodeConfig struct {
+	Address        string `mapstructure:"Address"` // RPC host:port
+	User           string `mapstructure:"User"`
+	Password       string `mapstructure:"Password"`
+	SSL            bool   `mapstructure:"SSL"`
+	Fulcrum        string `mapstructure:"Fulcrum"` // host:port
+	FulcrumPingMin int    `mapstructure:"FulcrumPingMin"`
+}
+
+type BchdConfig struct {
+	Address             string `mapstructure:"Address"`
+	AuthenticationToken string `mapstructure:"AuthenticationToken"`
+	RootCertFile        string `mapstructure:"RootCertFile"`
+	CaDomain            string `mapstructure:"CaDomain"`
+	AllowSelfSigned     bool   `mapstructure:"AllowSelfSigned"`
+}
+
+type MessageConfig struct {
+	Text              string  `mapstructure:"Text"`          // text/template with TransactionData
+	BlockExplorer     string  `mapstructure:"BlockExplorer"` // URL with %s for the TX hash, defaults to an explorer of BCH.Network
+	FiatCurrency      string  `mapstructure:"FiatCurrency"`  // must have a Price.API URL
+	WahleThresholdBCH float64 `mapstructure:"WahleThresholdBCH"`
+}
+
+type AverageConfig struct {
+	TransactionAverageTimeH int     `mapstructure:"TransactionAverageTimeH"`
+	AverageTxCleanupTimeMin int     `mapstructure:"AverageTxCleanupTimeMin"`
+	TxHistoryFile           string  `mapstructure:"TxHistoryFile"`
+	UpperTxPercent          float64 `mapstructure:"UpperTxPercent"`
+	MinTxCount              int     `mapstructure:"MinTxCount"`
+}
+
+type HttpConfig struct {
+	RequestTimeoutSec int `mapstructure:"RequestTimeoutSec"`
+}
+
+type EmailConfig struct {
+	ConnectTimeoutSec int `mapstructure:"ConnectTimeoutSec"`
+}
+
+type MonitoringConfig struct {
+	Enable          bool                      `mapstructure:"Enable"`
+	Address         string                    `mapstructure:"Address"`
+	EventHistory    int                       `mapstructure:"EventHistory"`
+	StreamReplay    int                       `mapstructure:"StreamReplay"`
+	Dashboard       bool                      `mapstructure:"Dashboard"`
+	TLSCertFile     string                    `mapstructure:"TLSCertFile"`
+	TLSKeyFile      string                    `mapstructure:"TLSKeyFile"`
+	Auth            monitoring.HttpAuthConfig `mapstructure:"Auth"`
+	TweetThresholdH int                       `mapstructure:"TweetThresholdH"`
+	MaxBlockAgeMin  int                       `mapstructure:"MaxBlockAgeMin"`
+}
+
+type AdminConfig struct {
+	Enable bool   `mapstructure:"Enable"`
+	Path   string `mapstructure:"Path"`
+}
+
+type StoreConfig struct {
+	Enable bool   `mapstructure:"Enable"`
+	Path   string `mapstructure:"Path"`
+}
+
+type TwitterConfig struct {
+	Enable         bool   `mapstructure:"Enable"`
+	ConsumerKey    string `mapstructure:"ConsumerKey"`
+	ConsumerSecret string `mapstructure:"ConsumerSecret"`
+	AccessToken    string `mapstructure:"AccessToken"`
+	AccessSecret   string `mapstructure:"AccessSecret"`
+}
+
+type TelegramConfig struct {
+	Enable          bool   `mapstructure:"Enable"`
+	Token           string `mapstructure:"Token"`
+	Channel         string `mapstructure:"Channel"`
+	Text            string `mapstructure:"Text"` // html/template - empty for the default
+	PinDailySummary bool   `mapstructure:"PinDailySummary"`
+}
+
+type PriceConfig struct {
+	UpdateIntervalMin int               `mapstructure:"UpdateIntervalMin"`
+	API               map[string]string `mapstructure:"API"` // fiat currency -> URL
+}
+
+type MinerConfig struct {
+	Enable             bool          `mapstructure:"Enable"`
+	AnnounceBlocks     bool          `mapstructure:"AnnounceBlocks"`
+	BlockText          string        `mapstructure:"BlockText"`          // text/template - empty for the default
+	PayoutText         string        `mapstructure:"PayoutText"`         // text/template - empty for the default
+	PayoutThresholdBCH float64       `mapstructure:"PayoutThresholdBCH"` // 0 = don't post payouts
+	Pools              []*PoolConfig `mapstructure:"Pools"`
+}
+
+type PoolConfig struct {
+	Name      string   `mapstructure:"Name"`
+	Tags      []string `mapstructure:"Tags"`      // text in the coinbase script
+	Addresses []string `mapstructure:"Addresses"` // cash addresses with prefix
+}
+
+type ClassifierConfig struct {
+	ConsolidationMinInputs    int                         `mapstructure:"ConsolidationMinInputs"`
+	BatchMinOutputs           int                         `mapstructure:"BatchMinOutputs"`
+	CoinJoinMinEqualOutputs   int                         `mapstructure:"CoinJoinMinEqualOutputs"`
+	PeelChainMinChangePercent float64                     `mapstructure:"PeelChainMinChangePercent"`
+	Rules                     map[string]*RuleTypesConfig `mapstructure:"Rules"` // rule name -> TX types
+}
+
+type RuleTypesConfig struct {
+	Include []string `mapstructure:"Include"` // empty = all types
+	Exclude []string `mapstructure:"Exclude"`
+}
+
+// Defaults of all settings that must not be zero. Keys missing in the config file get these values.
+var defaults = map[string]interface{}{
+	"App.Name": "cashwhale",
+
+	"Log.Level": "debug",
+	"Log.Color": true,
+
+	"BCH.Network":        network.MAINNET,
+	"BCH.MempoolPollSec": 0,
+
+	"Message.Text":              "{{.Amount}} #{{.Currency}} #{{.Symbol}} ({{.FiatAmount}} {{.FiatSymbol}}) transferred with {{.FiatFee}} {{.FiatSymbol}} TX fee\n\nTX: {{.TxLink}}",
+	"Message.BlockExplorer":     "", // set by Load() depending on the network
+	"Message.FiatCurrency":      "USD",
+	"Message.WahleThresholdBCH": 20000.0,
+
+	"Average.TransactionAverageTimeH": 24,
+	"Average.AverageTxCleanupTimeMin": 60,
+	"Average.TxHistoryFile":           "txhistory.gob",
+	"Average.UpperTxPercent":          0.1,
+	"Average.MinTxCount":              5000,
+
+	"HTTP.RequestTimeoutSec":  10,
+	"Email.ConnectTimeoutSec": 10,
+
+	"Monitoring.Address":         ":8686",
+	"Monitoring.EventHistory":    monitoring.DefaultEventHistory,
+	"Monitoring.StreamReplay":    10,
+	"Monitoring.Dashboard":       true,
+	"Monitoring.TweetThresholdH": 24,
+	"Monitoring.MaxBlockAgeMin":  60,
+
+	"Admin.Path": "/admin",
+
+	"Store.Enable": true,
+	"Store.Path":   "whales.db",
+
+	"Telegram.PinDailySummary": true,
+
+	// secrets are empty by default, but must be known to be read from environment variables
+	"BCHD.AuthenticationToken": "",
+	"Twitter.ConsumerKey":      "",
+	"Twitter.ConsumerSecret":   "",
+	"Twitter.AccessToken":      "",
+	"Twitter.AccessSecret":     "",
+	"Telegram.Token":           "",
+
+	"Price.UpdateIntervalMin": 5,
+	"Price.API.USD":           "https://index-api.bitcoin.com/api/v0/cash/price/usd",
+
+	"Miner.Enable": true,
+
+	"Classifier.ConsolidationMinInputs":    20,
+	"Classifier.BatchMinOutputs":           20,
+	"Classifier.CoinJoinMinEqualOutputs":   5,
+	"Classifier.PeelChainMinChangePercent": 90.0,
+}
+
+// SetDefaults sets the default values of all settings that must not be zero.
+// Call this before reading the config file.
+func SetDefaults(v *viper.Viper) {
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+}
+
+// Load returns the typed config with defaults applied.
+// Returns ValidationErrors if any setting is invalid (the config is returned too).
+func Load(v *viper.Viper) (*Config, error) {
+	config := &Config{}
+	if err := v.Unmarshal(config); err != nil {
+		return nil, errors.Wrap(err, "error decoding config")
+	}
+	for _, node := range config.BCH.Nodes {
+		if node.FulcrumPingMin == 0 {
+			node.FulcrumPingMin = DefaultFulcrumPingMin
+		}
+	}
+	if net, err := network.Get(config.BCH.Network); err == nil && len(config.Message.BlockExplorer) == 0 {
+		config.Message.BlockExplorer = net.BlockExplorer
+	}
+	if errs := config.Validate(); len(errs) != 0 {
+		return config, errs
+	}
+	return config, nil
+}
+
+// Masked returns a copy of the config with all secrets replaced, to print or log it.
+func (c *Config) Masked() *Config {
+	masked := *c
+	mask := func(secret string) string {
+		if len(secret) == 0 {
+			return "" // show that it is not set
+		}
+		return redactedSecret
+	}
+	maskAll := func(secrets []string) []string {
+		masked := make([]string, len(secrets))
+		for i, secret := range secrets {
+			masked[i] = mask(secret)
+		}
+		return masked
+	}
+	maskUsers := func(users []monitoring.HttpAuthUser) []monitoring.HttpAuthUser {
+		masked := make([]monitoring.HttpAuthUser, len(users))
+		for i, user := range users {
+			masked[i] = monitoring.HttpAuthUser{User: user.User, Password: mask(user.Password)}
+		}
+		return masked
+	}
+
+	masked.BCH.Nodes = make([]*NodeConfig, len(c.BCH.Nodes))
+	for i, node := range c.BCH.Nodes {
+		nodeCopy := *node
+		nodeCopy.Password = mask(node.Password)
+		masked.BCH.Nodes[i] = &nodeCopy
+	}
+	masked.BCHD.AuthenticationToken = mask(c.BCHD.AuthenticationToken)
+
+	masked.Monitoring.Auth.Tokens = maskAll(c.Monitoring.Auth.Tokens)
+	masked.Monitoring.Auth.Users = maskUsers(c.Monitoring.Auth.Users)
+	masked.Monitoring.Auth.Routes = make([]monitoring.HttpRouteAuth, len(c.Monitoring.Auth.Routes))
+	for i, route := range c.Monitoring.Auth.Routes {
+		masked.Monitoring.Auth.Routes[i] = monitoring.HttpRouteAuth{
+			Path:   route.Path,
+			Tokens: maskAll(route.Tokens),
+			Users:  maskUsers(route.Users),
+		}
+	}
+
+	masked.Twitter.ConsumerKey = mask(c.Twitter.ConsumerKey)
+	masked.Twitter.ConsumerSecret = mask(c.Twitter.ConsumerSecret)
+	masked.Twitter.AccessToken = mask(c.Twitter.AccessToken)
+	masked.Twitter.AccessSecret = mask(c.Twitter.AccessSecret)
+	masked.Telegram.Token = mask(c.Telegram.Token)
+
+	masked.Notify = make([]*notification.NotificationReceiver, len(c.Notify))
+	for i, notify := range c.Notify {
+		notifyCopy := *notify
+		notifyCopy.FromPassword = mask(notify.FromPassword)
+		notifyCopy.AppToken = mask(notify.AppToken)
+		notifyCopy.Token = mask(notify.Token)
+		masked.Notify[i] = &notifyCopy
+	}
+	return &masked
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+BCH:
+  Nodes:
+    - Address: "127.0.0.1:8332"
+      Password: "node-password"
+      Fulcrum: "127.0.0.1:50001"
+Average:
+  AverageTxCleanupTimeMin: 0
+Monitoring:
+  Enable: true
+  Auth:
+    Tokens: ["secret-token"]
+Twitter:
+  Enable: true
+  ConsumerKey: "key"
+Notify:
+  - Method: "sms"
+Miner:
+  Pools:
+    - Name: "Solo"
+Classifier:
+  Rules:
+    threshold:
+      Exclude: ["swap"]
+`
+
+func loadTestConfig(t *testing.T, yaml string) (*Config, error) {
+	v := viper.New()
+	SetDefaults(v)
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewBufferString(yaml)); err != nil {
+		t.Fatalf("Error reading config: %+v", err)
+	}
+	return Load(v)
+}
+
+func TestValidate(t *testing.T) {
+	config, err := loadTestConfig(t, testConfig)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	expected := []string{
+		"Average.AverageTxCleanupTimeMin: must be positive (got 0)",
+		"Twitter.ConsumerSecret: must not be empty",
+		"Twitter.AccessSecret: must not be empty",
+		"Notify[0].Method: must be pushover, telegram or email (got 'sms')",
+		"Miner.Pools[0]: must have Tags or Addresses",
+		"Classifier.Rules.threshold.Exclude[0]: must be one of",
+	}
+	for _, message := range expected {
+		if !strings.Contains(errs.Error(), message) {
+			t.Errorf("Expected %q in validation errors:\n%s", message, errs.Error())
+		}
+	}
+	if len(errs) != len(expected)+1 { // + Twitter.AccessToken
+		t.Errorf("Expected %d validation errors, got %s", len(expected)+1, errs.Error())
+	}
+
+	// defaults
+	if config.BCH.Nodes[0].FulcrumPingMin != DefaultFulcrumPingMin || config.Average.TransactionAverageTimeH != 24 || config.Price.UpdateIntervalMin != 5 {
+		t.Errorf("Expected defaults for missing settings: %+v", config)
+	}
+
+	config, err = loadTestConfig(t, `
+BCH:
+  Nodes:
+    - Address: "127.0.0.1:8332"
+      Fulcrum: "127.0.0.1:50001"
+Notify:
+  - Method: ""
+`)
+	if err != nil {
+		t.Errorf("Expected minimal config to be valid: %v", err)
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	config, err := loadTestConfig(t, `
+BCH:
+  Network: "chipnet"
+  Nodes:
+    - Address: "127.0.0.1:48334"
+      Fulcrum: "127.0.0.1:62001"
+`)
+	if err != nil {
+		t.Fatalf("Expected chipnet config to be valid: %v", err)
+	}
+	if config.Message.BlockExplorer != "https://chipnet.imaginary.cash/tx/%s" {
+		t.Errorf("Expected block explorer of chipnet, got %s", config.Message.BlockExplorer)
+	}
+
+	config, err = loadTestConfig(t, `
+BCH:
+  Network: "signet"
+  Nodes:
+    - Address: "127.0.0.1:8332"
+      Fulcrum: "127.0.0.1:50001"
+Message:
+  BlockExplorer: "https://example.com/tx/%s"
+`)
+	if err == nil || !strings.Contains(err.Error(), "BCH.Network: must be one of") {
+		t.Errorf("Expected error for unknown network, got %v", err)
+	}
+	if config.Message.BlockExplorer != "https://example.com/tx/%s" {
+		t.Errorf("Expected configured block explorer, got %s", config.Message.BlockExplorer)
+	}
+}
+
+func TestMasked(t *testing.T) {
+	config, _ := loadTestConfig(t, testConfig)
+	data, err := json.Marshal(config.Masked())
+	if err != nil {
+		t.Fatalf("Error encoding config: %+v", err)
+	}
+	for _, secret := range []string{"node-password", "secret-token", `"key"`} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Secret %s not masked: %s", secret, data)
+		}
+	}
+	if config.BCH.Nodes[0].Password != "node-password" || config.Monitoring.Auth.Tokens[0] != "secret-token" {
+		t.Errorf("Masking changed the original config: %+v", config)
+	}
+}
+
+func TestAdminCredentials(t *testing.T) {
+	const adminConfig = `
+BCH:
+  Nodes:
+    - Address: "127.0.0.1:8332"
+      Fulcrum: "127.0.0.1:50001"
+Monitoring:
+  Enable: true
+  Auth:
+    Routes:
+      - Path: "%s"
+        Tokens: ["admin-token"]
+Admin:
+  Enable: true
+  Path: "/control"
+`
+	// same as the monitoring server checking the route of "/control/"
+	for _, path := range []string{"/control", "/control/", "/"} {
+		if _, err := loadTestConfig(t, fmt.Sprintf(adminConfig, path)); err != nil {
+			t.Errorf("Expected admin API with credentials for route %s to be valid: %v", path, err)
+		}
+	}
+	for _, path := range []string{"/admin/", "/control/thresholds"} {
+		_, err := loadTestConfig(t, fmt.Sprintf(adminConfig, path))
+		if err == nil || !strings.Contains(err.Error(), "Admin.Enable: requires credentials") {
+			t.Errorf("Expected error for admin API without credentials for route %s, got %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"context"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ConfigReloadEvent is the monitoring event of the last config reload.
+const ConfigReloadEvent = "ConfigReload"
+
+// editors write files in multiple steps, wait for more changes before reloading
+const reloadDelay = time.Second
+
+// ReloadHandler applies the next config to a component. previous is the config currently running.
+// It returns a function restoring the state the component had before, nil if nothing changed.
+// If a handler returns an error the reload is rolled back: the restore functions of all handlers
+// that already applied next are called in reverse order.
+type ReloadHandler func(previous *Config, next *Config) (restore func() error, err error)
+
+// Reloader reads the config file again when it changes or on SIGHUP and applies
+// valid configs to all registered handlers. Invalid configs are rejected and the
+// previous config keeps running.
+type Reloader struct {
+	file    string
+	logger  log.Logger
+	monitor *monitoring.HttpMonitoring
+
+	lock     sync.Mutex // held during a reload, so only 1 reload runs at a time
+	current  *Config
+	handlers []ReloadHandler
+
+	reloadCount *monitoring.Counter
+}
+
+// NewReloader creates a reloader for the config file. current is the config the app was started with.
+func NewReloader(file string, current *Config, logger log.Logger, monitor *monitoring.HttpMonitoring) (*Reloader, error) {
+	if len(file) == 0 {
+		return nil, errors.New("config file path is required to reload the config")
+	} else if current == nil {
+		return nil, errors.New("current config is required to reload the config")
+	}
+	return &Reloader{
+		file: file,
+		logger: logger.WithFields(
+			log.Fields{
+				"module": "config",
+			},
+		),
+		monitor:  monitor,
+		current:  current,
+		handlers: make([]ReloadHandler, 0, 5),
+
+		reloadCount: monitor.Metrics().Counter("cashwhale_config_reloads_total", "Number of config reloads.", "result"),
+	}, nil
+}
+
+// OnReload adds a handler to apply new configs. Handlers are called in the order they were added.
+func (r *Reloader) OnReload(handler ReloadHandler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.handlers = append(r.handlers, handler)
+}
+
+// Current returns the config that is currently running.
+func (r *Reloader) Current() *Config {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.current
+}
+
+// Reload reads and validates the config file and applies it to all handlers.
+// Returns ValidationErrors if the config is invalid. The previous config keeps running on errors.
+func (r *Reloader) Reload() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	next, err := r.read()
+	if err == nil {
+		err = r.apply(next)
+	}
+	if err != nil {
+		r.reloadCount.Inc("failure")
+		r.monitor.AddEvent(ConfigReloadEvent, monitoring.D{
+			"file":  r.file,
+			"error": err.Error(),
+		})
+		r.logger.Errorf("Rejected config reload from %s, keeping the previous config: %+v", r.file, err)
+		return err
+	}
+
+	if restart := RestartRequired(r.current, next); len(restart) != 0 {
+		r.logger.Warnf("Config changes of %v require a restart to take effect", restart)
+	}
+	r.current = next
+	r.reloadCount.Inc("success")
+	r.monitor.AddEvent(ConfigReloadEvent, monitoring.D{
+		"file": r.file,
+	})
+	r.logger.Infof("Reloaded config from %s", r.file)
+	return nil
+}
+
+// Run reloads the config on file changes and SIGHUP until ctx is done.
+// This call is blocking.
+func (r *Reloader) Run(ctx context.Context) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+
+	changed := make(chan struct{}, 1)
+	watch := viper.New()
+	watch.SetConfigFile(r.file)
+	watch.OnConfigChange(func(event fsnotify.Event) {
+		select {
+		case changed <- struct{}{}:
+		default: // a reload is already pending
+		}
+	})
+	watch.WatchConfig()
+
+	var delay <-chan time.Time
+	for {
+		select {
+		case <-c:
+			r.Reload()
+
+		case <-changed:
+			delay = time.After(reloadDelay)
+
+		case <-delay:
+			delay = nil
+			r.Reload()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Reads the config file into a new viper instance, so the running config is not modified.
+func (r *Reloader) read() (*Config, error) {
+	v := viper.New()
+	SetDefaults(v)
+	UseEnv(v)
+	v.SetConfigFile(r.file)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, errors.Wrap(err, "error reading config")
+	} else if err = ResolveSecrets(v); err != nil {
+		return nil, err
+	}
+	return Load(v)
+}
+
+// Applies next to all handlers and restores the state of the handlers that already applied it on errors.
+func (r *Reloader) apply(next *Config) error {
+	restores := make([]func() error, 0, len(r.handlers))
+	for _, handler := range r.handlers {
+		restore, err := handler(r.current, next)
+		if err == nil {
+			if restore != nil {
+				restores = append(restores, restore)
+			}
+			continue
+		}
+		for i := len(restores) - 1; i >= 0; i-- {
+			if rollbackErr := restores[i](); rollbackErr != nil {
+				r.logger.Errorf("Error rolling back config reload: %+v", rollbackErr)
+			}
+		}
+		return errors.Wrap(err, "error applying config")
+	}
+	return nil
+}
+
+// RestartRequired returns the keys of all changed settings that can not be reloaded at runtime.
+func RestartRequired(previous *Config, next *Config) []string {
+	a, b := previous.withoutReloadable(), next.withoutReloadable()
+	changed := make([]string, 0, 5)
+	sectionsA, sectionsB := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < sectionsA.NumField(); i++ {
+		if !reflect.DeepEqual(sectionsA.Field(i).Interface(), sectionsB.Field(i).Interface()) {
+			changed = append(changed, sectionsA.Type().Field(i).Name)
+		}
+	}
+	return changed
+}
+
+// Returns a copy without all settings that are applied by the reload handlers of the watch command.
+func (c *Config) withoutReloadable() Config {
+	static := *c
+	static.Message.Text = ""
+	static.Message.BlockExplorer = ""
+	static.Message.WahleThresholdBCH = 0.0
+	static.Average.UpperTxPercent = 0.0
+	static.Average.MinTxCount = 0
+	static.Twitter = TwitterConfig{}
+	static.Telegram = TelegramConfig{}
+	static.Notify = nil
+	static.Classifier.Rules = nil
+	return static
+}
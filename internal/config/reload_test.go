@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const reloadTestConfig = `
+BCH:
+  Nodes:
+    - Address: "127.0.0.1:8332"
+      Fulcrum: "127.0.0.1:50001"
+Message:
+  WahleThresholdBCH: %s
+`
+
+func newTestReloader(t *testing.T) (*Reloader, string) {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	dir, err := ioutil.TempDir("", "cashwhale-config")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %+v", err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	file := filepath.Join(dir, "config.yaml")
+	writeTestConfig(t, file, "1000")
+
+	current, err := loadTestConfig(t, readTestConfig(t, file))
+	if err != nil {
+		t.Fatalf("Error loading config: %+v", err)
+	}
+	reloader, err := NewReloader(file, current, logger, nil)
+	if err != nil {
+		t.Fatalf("Error creating reloader: %+v", err)
+	}
+	return reloader, file
+}
+
+func writeTestConfig(t *testing.T, file string, threshold string) {
+	data := []byte(fmt.Sprintf(reloadTestConfig, threshold))
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatalf("Error writing config: %+v", err)
+	}
+}
+
+func readTestConfig(t *testing.T, file string) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Error reading config: %+v", err)
+	}
+	return string(data)
+}
+
+func TestReload(t *testing.T) {
+	reloader, file := newTestReloader(t)
+	applied := make([]float64, 0, 5)
+	reloader.OnReload(func(previous *Config, next *Config) (func() error, error) {
+		applied = append(applied, next.Message.WahleThresholdBCH)
+		return nil, nil
+	})
+
+	writeTestConfig(t, file, "2000")
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Error reloading config: %+v", err)
+	}
+	if reloader.Current().Message.WahleThresholdBCH != 2000.0 || len(applied) != 1 || applied[0] != 2000.0 {
+		t.Errorf("Expected new threshold to be applied: %v", applied)
+	}
+
+	writeTestConfig(t, file, "-1")
+	if _, ok := reloader.Reload().(ValidationErrors); !ok {
+		t.Errorf("Expected validation errors for invalid config")
+	}
+	if reloader.Current().Message.WahleThresholdBCH != 2000.0 || len(applied) != 1 {
+		t.Errorf("Invalid config must not be applied: %v", applied)
+	}
+}
+
+func TestReloadRollback(t *testing.T) {
+	reloader, file := newTestReloader(t)
+	applied := 1500.0 // changed at runtime since the config was loaded
+	reloader.OnReload(func(previous *Config, next *Config) (func() error, error) {
+		live := applied
+		applied = next.Message.WahleThresholdBCH
+		return func() error {
+			applied = live
+			return nil
+		}, nil
+	})
+	reloader.OnReload(func(previous *Config, next *Config) (func() error, error) {
+		if next.Message.WahleThresholdBCH == 3000.0 {
+			return nil, errors.New("can not apply")
+		}
+		return nil, nil
+	})
+
+	writeTestConfig(t, file, "3000")
+	if err := reloader.Reload(); err == nil {
+		t.Fatalf("Expected error applying config")
+	}
+	if applied != 1500.0 || reloader.Current().Message.WahleThresholdBCH != 1000.0 {
+		t.Errorf("Expected rollback to the state before the reload, got threshold %v", applied)
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	previous, _ := loadTestConfig(t, testConfig)
+	next, _ := loadTestConfig(t, testConfig)
+	next.Message.WahleThresholdBCH = 1.0
+	next.Twitter.Enable = false
+	if changed := RestartRequired(previous, next); len(changed) != 0 {
+		t.Errorf("Expected no restart for reloadable settings, got %v", changed)
+	}
+	next.Monitoring.Address = ":9000"
+	next.Message.FiatCurrency = "EUR"
+	if changed := RestartRequired(previous, next); len(changed) != 2 || changed[0] != "Message" || changed[1] != "Monitoring" {
+		t.Errorf("Expected restart for Message and Monitoring, got %v", changed)
+	}
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// references to secrets in config values, for example ${ENV:TWITTER_SECRET} or ${FILE:/run/secrets/twitter}
+var secretReference = regexp.MustCompile(`\$\{([A-Z]+):([^}]+)\}`)
+
+// SecretProvider returns the secret with this name from a secret store.
+type SecretProvider func(name string) (string, error)
+
+var secretProviders = map[string]SecretProvider{
+	"ENV":  envSecret,
+	"FILE": fileSecret,
+}
+
+// RegisterSecretProvider adds a secret store for references of the form ${SCHEME:name}.
+// Call this before loading the config.
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretProviders[scheme] = provider
+}
+
+// UseEnv reads all settings from environment variables with dots replaced by underscores,
+// for example Twitter.AccessSecret from TWITTER_ACCESSSECRET.
+func UseEnv(v *viper.Viper) {
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+}
+
+// ResolveSecrets replaces all secret references in config values with the secrets.
+// Resolved secrets are redacted in all logs. Call this after reading the config file.
+func ResolveSecrets(v *viper.Viper) error {
+	for _, key := range v.AllKeys() {
+		value, changed, err := resolveValue(v.Get(key))
+		if err != nil {
+			return errors.Wrapf(err, "error resolving secret of %s", key)
+		} else if changed {
+			v.Set(key, value)
+		}
+	}
+	return nil
+}
+
+// Resolves references in strings, lists and maps. Returns true if the value changed.
+func resolveValue(value interface{}) (interface{}, bool, error) {
+	switch value := value.(type) {
+	case string:
+		return resolveString(value)
+
+	case []interface{}:
+		resolved := make([]interface{}, len(value))
+		changed := false
+		for i, element := range value {
+			resolvedElement, elementChanged, err := resolveValue(element)
+			if err != nil {
+				return nil, false, err
+			}
+			resolved[i] = resolvedElement
+			changed = changed || elementChanged
+		}
+		return resolved, changed, nil
+
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(value))
+		changed := false
+		for key, element := range value {
+			resolvedElement, elementChanged, err := resolveValue(element)
+			if err != nil {
+				return nil, false, err
+			}
+			resolved[key] = resolvedElement
+			changed = changed || elementChanged
+		}
+		return resolved, changed, nil
+
+	case map[interface{}]interface{}: // maps in YAML lists
+		resolved := make(map[interface{}]interface{}, len(value))
+		changed := false
+		for key, element := range value {
+			resolvedElement, elementChanged, err := resolveValue(element)
+			if err != nil {
+				return nil, false, err
+			}
+			resolved[key] = resolvedElement
+			changed = changed || elementChanged
+		}
+		return resolved, changed, nil
+	}
+	return value, false, nil
+}
+
+func resolveString(value string) (string, bool, error) {
+	if !strings.Contains(value, "${") {
+		return value, false, nil
+	}
+	var resolveErr error
+	resolved := secretReference.ReplaceAllStringFunc(value, func(reference string) string {
+		match := secretReference.FindStringSubmatch(reference)
+		provider, ok := secretProviders[match[1]]
+		if !ok {
+			resolveErr = errors.Errorf("unknown secret store %s", match[1])
+			return reference
+		}
+		secret, err := provider(match[2])
+		if err != nil {
+			resolveErr = err
+			return reference
+		}
+		log.AddSecrets(secret)
+		return secret
+	})
+	if resolveErr != nil {
+		return "", false, resolveErr
+	}
+	return resolved, resolved != value, nil
+}
+
+func envSecret(name string) (string, error) {
+	secret, ok := os.LookupEnv(name)
+	if !ok {
+		return "", errors.Errorf("environment variable %s is not set", name)
+	}
+	return secret, nil
+}
+
+func fileSecret(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading secret file")
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil // files usually end with a newline
+}
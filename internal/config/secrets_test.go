@@ -0,0 +1,71 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const secretsTestConfig = `
+BCH:
+  Nodes:
+    - Address: "127.0.0.1:8332"
+      Password: "${FILE:%s}"
+      Fulcrum: "127.0.0.1:50001"
+Telegram:
+  Token: "bot${ENV:CASHWHALE_TEST_TOKEN}"
+`
+
+func readSecretsTestConfig(t *testing.T, yaml string) (*viper.Viper, error) {
+	v := viper.New()
+	SetDefaults(v)
+	UseEnv(v)
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(bytes.NewBufferString(yaml)); err != nil {
+		t.Fatalf("Error reading config: %+v", err)
+	}
+	return v, ResolveSecrets(v)
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cashwhale-secrets")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "node-password")
+	if err = ioutil.WriteFile(file, []byte("node-secret\n"), 0600); err != nil {
+		t.Fatalf("Error writing secret file: %+v", err)
+	}
+	os.Setenv("CASHWHALE_TEST_TOKEN", "123:abc")
+	os.Setenv("TWITTER_ACCESSSECRET", "twitter-secret")
+	defer os.Unsetenv("CASHWHALE_TEST_TOKEN")
+	defer os.Unsetenv("TWITTER_ACCESSSECRET")
+
+	v, err := readSecretsTestConfig(t, fmt.Sprintf(secretsTestConfig, file))
+	if err != nil {
+		t.Fatalf("Error resolving secrets: %+v", err)
+	}
+	config, _ := Load(v)
+	if config.BCH.Nodes[0].Password != "node-secret" {
+		t.Errorf("Expected password from file, got %q", config.BCH.Nodes[0].Password)
+	}
+	if config.Telegram.Token != "bot123:abc" {
+		t.Errorf("Expected token from environment, got %q", config.Telegram.Token)
+	}
+	if config.Twitter.AccessSecret != "twitter-secret" {
+		t.Errorf("Expected nested key from environment, got %q", config.Twitter.AccessSecret)
+	}
+
+	os.Unsetenv("CASHWHALE_TEST_TOKEN")
+	if _, err = readSecretsTestConfig(t, fmt.Sprintf(secretsTestConfig, file)); err == nil {
+		t.Errorf("Expected error for missing environment variable")
+	}
+	if _, err = readSecretsTestConfig(t, `App: {Name: "${VAULT:name}"}`); err == nil {
+		t.Errorf("Expected error for unknown secret store")
+	}
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/bch/network"
+	"github.com/Ekliptor/cashwhale/internal/watcher"
+	"github.com/Ekliptor/cashwhale/pkg/notification"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	htmlTemplate "html/template"
+	"net"
+	"strings"
+	"text/template"
+)
+
+// ValidationError is an invalid setting.
+type ValidationError struct {
+	Key     string // the path of the setting, for example "BCH.Nodes[0].Address"
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Key, e.Message)
+}
+
+// ValidationErrors are all invalid settings of a config.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("invalid config (%d errors):\n%s", len(errs), strings.Join(messages, "\n"))
+}
+
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) add(key string, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(key string, value string) {
+	if len(strings.TrimSpace(value)) == 0 {
+		v.add(key, "must not be empty")
+	}
+}
+
+func (v *validator) positive(key string, value float64) {
+	if value <= 0.0 {
+		v.add(key, "must be positive (got %v)", value)
+	}
+}
+
+func (v *validator) notNegative(key string, value float64) {
+	if value < 0.0 {
+		v.add(key, "must not be negative (got %v)", value)
+	}
+}
+
+func (v *validator) txTypes(key string, values []string) {
+	for i, value := range values {
+		if !watcher.IsTxType(watcher.TxType(value)) {
+			v.add(fmt.Sprintf("%s[%d]", key, i), "must be one of %v (got '%s')", watcher.TxTypes, value)
+		}
+	}
+}
+
+func (v *validator) hostPort(key string, value string) {
+	if _, _, err := net.SplitHostPort(value); err != nil {
+		v.add(key, "must be host:port (got '%s')", value)
+	}
+}
+
+// Validate returns all invalid settings (or nil).
+func (c *Config) Validate() ValidationErrors {
+	v := &validator{}
+
+	if _, err := network.Get(c.BCH.Network); err != nil {
+		v.add("BCH.Network", "must be one of %v (got '%s')", network.Names(), c.BCH.Network)
+	}
+	if len(c.BCH.Nodes) == 0 {
+		v.add("BCH.Nodes", "at least 1 node is required")
+	}
+	for i, node := range c.BCH.Nodes {
+		key := fmt.Sprintf("BCH.Nodes[%d]", i)
+		v.hostPort(key+".Address", node.Address)
+		v.hostPort(key+".Fulcrum", node.Fulcrum)
+		v.positive(key+".FulcrumPingMin", float64(node.FulcrumPingMin))
+	}
+	v.notNegative("BCH.MempoolPollSec", float64(c.BCH.MempoolPollSec))
+
+	if _, err := template.New("message").Funcs(price.TemplateFuncs).Parse(c.Message.Text); err != nil {
+		v.add("Message.Text", "invalid template: %v", err)
+	}
+	if !strings.Contains(c.Message.BlockExplorer, "%s") {
+		v.add("Message.BlockExplorer", "must contain %%s for the TX hash (got '%s')", c.Message.BlockExplorer)
+	}
+	v.required("Message.FiatCurrency", c.Message.FiatCurrency)
+	if _, ok := c.Price.API[strings.ToLower(c.Message.FiatCurrency)]; !ok && len(c.Message.FiatCurrency) != 0 {
+		v.add("Price.API", "missing URL for Message.FiatCurrency %s", c.Message.FiatCurrency)
+	}
+	v.positive("Message.WahleThresholdBCH", c.Message.WahleThresholdBCH)
+
+	v.positive("Average.TransactionAverageTimeH", float64(c.Average.TransactionAverageTimeH))
+	v.positive("Average.AverageTxCleanupTimeMin", float64(c.Average.AverageTxCleanupTimeMin))
+	v.required("Average.TxHistoryFile", c.Average.TxHistoryFile)
+	if c.Average.UpperTxPercent <= 0.0 || c.Average.UpperTxPercent > 100.0 {
+		v.add("Average.UpperTxPercent", "must be in (0, 100] (got %v)", c.Average.UpperTxPercent)
+	}
+	v.notNegative("Average.MinTxCount", float64(c.Average.MinTxCount))
+
+	v.positive("HTTP.RequestTimeoutSec", float64(c.HTTP.RequestTimeoutSec))
+	v.positive("Email.ConnectTimeoutSec", float64(c.Email.ConnectTimeoutSec))
+
+	if c.Monitoring.Enable {
+		v.hostPort("Monitoring.Address", c.Monitoring.Address)
+		v.notNegative("Monitoring.EventHistory", float64(c.Monitoring.EventHistory))
+		v.notNegative("Monitoring.StreamReplay", float64(c.Monitoring.StreamReplay))
+		if (len(c.Monitoring.TLSCertFile) == 0) != (len(c.Monitoring.TLSKeyFile) == 0) {
+			v.add("Monitoring.TLSCertFile", "TLSCertFile and TLSKeyFile must both be set for HTTPS")
+		}
+		for i, allowed := range c.Monitoring.Auth.AllowedIPs {
+			if net.ParseIP(allowed) == nil {
+				if _, _, err := net.ParseCIDR(allowed); err != nil {
+					v.add(fmt.Sprintf("Monitoring.Auth.AllowedIPs[%d]", i), "invalid IP or CIDR range '%s'", allowed)
+				}
+			}
+		}
+		v.positive("Monitoring.TweetThresholdH", float64(c.Monitoring.TweetThresholdH))
+		v.notNegative("Monitoring.MaxBlockAgeMin", float64(c.Monitoring.MaxBlockAgeMin))
+	}
+	if c.Admin.Enable {
+		if !c.Monitoring.Enable {
+			v.add("Admin.Enable", "requires Monitoring.Enable")
+		} else if !c.hasAdminCredentials() {
+			v.add("Admin.Enable", "requires credentials in Monitoring.Auth")
+		}
+	}
+	if c.Store.Enable {
+		v.required("Store.Path", c.Store.Path)
+	}
+
+	if c.Twitter.Enable {
+		v.required("Twitter.ConsumerKey", c.Twitter.ConsumerKey)
+		v.required("Twitter.ConsumerSecret", c.Twitter.ConsumerSecret)
+		v.required("Twitter.AccessToken", c.Twitter.AccessToken)
+		v.required("Twitter.AccessSecret", c.Twitter.AccessSecret)
+	}
+	if c.Telegram.Enable {
+		v.required("Telegram.Token", c.Telegram.Token)
+		v.required("Telegram.Channel", c.Telegram.Channel)
+		if _, err := htmlTemplate.New("telegram").Funcs(htmlTemplate.FuncMap(price.TemplateFuncs)).Parse(c.Telegram.Text); err != nil {
+			v.add("Telegram.Text", "invalid template: %v", err)
+		}
+	}
+	v.positive("Price.UpdateIntervalMin", float64(c.Price.UpdateIntervalMin))
+
+	if c.Miner.Enable {
+		if _, err := template.New("block").Funcs(price.TemplateFuncs).Parse(c.Miner.BlockText); err != nil {
+			v.add("Miner.BlockText", "invalid template: %v", err)
+		}
+		if _, err := template.New("payout").Funcs(price.TemplateFuncs).Parse(c.Miner.PayoutText); err != nil {
+			v.add("Miner.PayoutText", "invalid template: %v", err)
+		}
+		v.notNegative("Miner.PayoutThresholdBCH", c.Miner.PayoutThresholdBCH)
+		for i, pool := range c.Miner.Pools {
+			key := fmt.Sprintf("Miner.Pools[%d]", i)
+			v.required(key+".Name", pool.Name)
+			if len(pool.Tags) == 0 && len(pool.Addresses) == 0 {
+				v.add(key, "must have Tags or Addresses")
+			}
+		}
+	}
+
+	v.positive("Classifier.ConsolidationMinInputs", float64(c.Classifier.ConsolidationMinInputs))
+	v.positive("Classifier.BatchMinOutputs", float64(c.Classifier.BatchMinOutputs))
+	v.positive("Classifier.CoinJoinMinEqualOutputs", float64(c.Classifier.CoinJoinMinEqualOutputs))
+	if c.Classifier.PeelChainMinChangePercent <= 50.0 || c.Classifier.PeelChainMinChangePercent > 100.0 {
+		v.add("Classifier.PeelChainMinChangePercent", "must be in (50, 100] (got %v)", c.Classifier.PeelChainMinChangePercent)
+	}
+	for rule, types := range c.Classifier.Rules {
+		key := "Classifier.Rules." + rule
+		if !isRule(rule) {
+			v.add(key, "unknown rule, must be one of %v", watcher.Rules)
+			continue
+		} else if types == nil {
+			continue
+		}
+		v.txTypes(key+".Include", types.Include)
+		v.txTypes(key+".Exclude", types.Exclude)
+	}
+
+	for i, notify := range c.Notify {
+		key := fmt.Sprintf("Notify[%d]", i)
+		switch notify.Method {
+		case "":
+			continue // disabled placeholder of config.example.yaml
+		case notification.NOTIFICATION_PUSHOVER:
+			v.required(key+".AppToken", notify.AppToken)
+			v.required(key+".Receiver", notify.Receiver)
+		case notification.NOTIFICATION_TELEGRAM:
+			v.required(key+".Token", notify.Token)
+			v.required(key+".Channel", notify.Channel)
+		case notification.NOTIFICATION_EMAIL:
+			v.required(key+".SmtpHost", notify.SmtpHost)
+			v.positive(key+".SmtpPort", float64(notify.SmtpPort))
+			v.required(key+".FromAddress", notify.FromAddress)
+			v.required(key+".RecAddress", notify.RecAddress)
+		default:
+			v.add(key+".Method", "must be pushover, telegram or email (got '%s')", notify.Method)
+		}
+	}
+
+	return v.errs
+}
+
+func isRule(name string) bool {
+	for _, rule := range watcher.Rules {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the admin API is protected by credentials.
+// The route with the longest matching path prefix replaces the global credentials (same as the monitoring server).
+func (c *Config) hasAdminCredentials() bool {
+	auth := c.Monitoring.Auth
+	tokens, users := auth.Tokens, auth.Users
+	matched := 0
+	path := strings.TrimSuffix(c.Admin.Path, "/") + "/" // same as the admin API requiring credentials
+	if len(c.Admin.Path) == 0 {
+		path = "/admin/"
+	}
+	for _, route := range auth.Routes {
+		if strings.HasPrefix(path, route.Path) && len(route.Path) > matched {
+			tokens, users = route.Tokens, route.Users
+			matched = len(route.Path)
+		}
+	}
+	return len(tokens) != 0 || len(users) != 0
+}
@@ -0,0 +1,112 @@
+package dashboard
+
+import (
+	_ "embed"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/internal/social"
+	"github.com/Ekliptor/cashwhale/internal/watcher"
+	"github.com/Ekliptor/cashwhale/pkg/txcounter"
+	"net/http"
+)
+
+// Rules holds the thresholds to identify whales (implemented by watcher.Watcher).
+type Rules interface {
+	GetThresholds() watcher.Thresholds
+}
+
+// Outbox holds the whales waiting to be published (implemented by social.MessageBuilder).
+type Outbox interface {
+	Outbox() []*social.OutboxEntry
+}
+
+//go:embed static/index.html
+var indexHtml []byte // the single page dashboard without external assets (works without internet access)
+
+// Dashboard serves a web page with live whales and the bot status on the monitoring server.
+type Dashboard struct {
+	config  DashboardConfig
+	logger  log.Logger
+	monitor *monitoring.HttpMonitoring
+	counter *txcounter.TxCounter
+	rules   Rules
+	outbox  Outbox
+}
+
+type DashboardConfig struct {
+	Path string // the HTTP path to serve the dashboard on - defaults to "/dashboard"
+}
+
+// DashboardStatus is the data shown on the dashboard (in addition to the whale stream and node status).
+type DashboardStatus struct {
+	Thresholds   Thresholds                             `json:"thresholds"`
+	Distribution []txcounter.TxDistributionBucket       `json:"distribution"`
+	Healthy      bool                                   `json:"healthy"`
+	Health       map[string]*monitoring.ComponentHealth `json:"health"`
+	Outbox       []*social.OutboxEntry                  `json:"outbox"` // whales not published on all publishers
+}
+
+// Thresholds are the current values of the rules identifying whales.
+type Thresholds struct {
+	WhaleBch        float64 `json:"whale_bch"`
+	UpperTxPercent  float64 `json:"upper_tx_percent"`
+	UpperPercentBch float64 `json:"upper_percent_bch"`
+	MinTxCount      int     `json:"min_tx_count"` // the upper percent rule is only active with this many TX
+	TxCount         int     `json:"tx_count"`
+	AverageBch      float64 `json:"average_bch"`
+}
+
+// NewDashboard registers the dashboard routes on the monitoring server.
+func NewDashboard(config DashboardConfig, logger log.Logger, monitor *monitoring.HttpMonitoring, counter *txcounter.TxCounter, rules Rules, outbox Outbox) *Dashboard {
+	if len(config.Path) == 0 {
+		config.Path = "/dashboard"
+	}
+	dashboard := &Dashboard{
+		config: config,
+		logger: logger.WithFields(log.Fields{
+			"module": "dashboard",
+		}),
+		monitor: monitor,
+		counter: counter,
+		rules:   rules,
+		outbox:  outbox,
+	}
+	monitor.HandleFunc(config.Path, dashboard.serveIndex)
+	monitor.HandleJSON(config.Path+"/status", func() interface{} {
+		return dashboard.GetStatus()
+	})
+	return dashboard
+}
+
+// GetStatus returns the current thresholds, TX distribution, health of all components and the outbox.
+func (d *Dashboard) GetStatus() *DashboardStatus {
+	thresholds := d.rules.GetThresholds()
+	healthy, health := d.monitor.CheckHealth(monitoring.PROBE_READINESS)
+	return &DashboardStatus{
+		Thresholds: Thresholds{
+			WhaleBch:        thresholds.WhaleBch,
+			UpperTxPercent:  thresholds.UpperTxPercent,
+			UpperPercentBch: d.counter.GetUpperTransactionSizePercent(float32(thresholds.UpperTxPercent)).BCH(),
+			MinTxCount:      thresholds.MinTxCount,
+			TxCount:         d.counter.GetTransactionCount(),
+			AverageBch:      d.counter.GetAverageTransactionSize().BCH(),
+		},
+		Distribution: d.counter.GetDistribution(txcounter.DefaultDistributionBuckets),
+		Healthy:      healthy,
+		Health:       health,
+		Outbox:       d.outbox.Outbox(),
+	}
+}
+
+func (d *Dashboard) serveIndex(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" || req.URL.Path != d.config.Path {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	if _, err := writer.Write(indexHtml); err != nil {
+		d.logger.Errorf("Error serving dashboard: %+v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/internal/social"
+	"github.com/Ekliptor/cashwhale/internal/watcher"
+	"github.com/Ekliptor/cashwhale/pkg/txcounter"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testRules struct{}
+
+func (r testRules) GetThresholds() watcher.Thresholds {
+	return watcher.Thresholds{WhaleBch: 20000.0, UpperTxPercent: 0.1, MinTxCount: 1000}
+}
+
+type testOutbox struct{}
+
+func (o testOutbox) Outbox() []*social.OutboxEntry {
+	return []*social.OutboxEntry{{Hash: "abc", AmountBch: 25000.0, Status: map[string]*social.PublishStatus{
+		"twitter": {Status: social.PUBLISH_STATUS_FAILED, Error: "rate limit"},
+	}}}
+}
+
+func TestDashboard(t *testing.T) {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	monitor, err := monitoring.NewHttpMonitoring(monitoring.HttpMonitoringConfig{}, logger)
+	if err != nil {
+		t.Fatalf("Error creating monitoring: %+v", err)
+	}
+	counter, err := txcounter.NewTxCounter(nil, context.Background(), logger, nil)
+	if err != nil {
+		t.Fatalf("Error creating TX counter: %+v", err)
+	}
+	counter.AddTransaction(5)
+	NewDashboard(DashboardConfig{}, logger, monitor, counter, testRules{}, testOutbox{})
+
+	recorder := httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, httptest.NewRequest("GET", "/dashboard", nil))
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "/whales/stream") {
+		t.Errorf("Unexpected dashboard response: %d", recorder.Code)
+	}
+	if strings.Contains(recorder.Body.String(), "<script src=") || strings.Contains(recorder.Body.String(), "<link ") {
+		t.Errorf("The dashboard must not load external assets")
+	}
+
+	recorder = httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, httptest.NewRequest("GET", "/dashboard/status", nil))
+	var res struct {
+		Data DashboardStatus `json:"data"`
+	}
+	if err = json.Unmarshal(recorder.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Error parsing status: %+v", err)
+	}
+	if res.Data.Thresholds.WhaleBch != 20000.0 || res.Data.Thresholds.TxCount != 1 || len(res.Data.Distribution) != len(txcounter.DefaultDistributionBuckets)+1 {
+		t.Errorf("Unexpected status: %+v", res.Data)
+	}
+	if len(res.Data.Outbox) != 1 || res.Data.Outbox[0].Status["twitter"].Error != "rate limit" {
+		t.Errorf("Unexpected outbox: %+v", res.Data.Outbox)
+	}
+}
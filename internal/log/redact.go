@@ -0,0 +1,79 @@
+package log
+
+import (
+	"go.uber.org/zap/zapcore"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// shorter values are not redacted because they would replace too many unrelated strings
+const minSecretLength = 4
+
+// shown instead of secrets in log output
+const redactedSecret = "***"
+
+// secrets removed from the output of all loggers
+var redactor = &secretRedactor{
+	secrets: make(map[string]bool),
+}
+
+// AddSecrets replaces these values with *** in the output of all loggers.
+func AddSecrets(secrets ...string) {
+	redactor.add(secrets...)
+}
+
+type secretRedactor struct {
+	lock     sync.RWMutex
+	secrets  map[string]bool
+	replacer *strings.Replacer // nil if there are no secrets
+}
+
+func (r *secretRedactor) add(secrets ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, secret := range secrets {
+		if len(secret) >= minSecretLength {
+			r.secrets[secret] = true
+		}
+	}
+	if len(r.secrets) == 0 {
+		return
+	}
+
+	// replace longer secrets first in case one secret contains another
+	sorted := make([]string, 0, len(r.secrets))
+	for secret := range r.secrets {
+		sorted = append(sorted, secret)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, secret := range sorted {
+		pairs = append(pairs, secret, redactedSecret)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+func (r *secretRedactor) redact(data []byte) []byte {
+	r.lock.RLock()
+	replacer := r.replacer
+	r.lock.RUnlock()
+	if replacer == nil {
+		return data
+	}
+	return []byte(replacer.Replace(string(data)))
+}
+
+// redactingWriter removes secrets from encoded log entries.
+type redactingWriter struct {
+	zapcore.WriteSyncer
+}
+
+func (w redactingWriter) Write(data []byte) (int, error) {
+	if _, err := w.WriteSyncer.Write(redactor.redact(data)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
@@ -0,0 +1,20 @@
+package log
+
+import (
+	"bytes"
+	"go.uber.org/zap/zapcore"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	AddSecrets("", "abc", "top-secret", "top-secret-2")
+	var buf bytes.Buffer
+	writer := redactingWriter{zapcore.AddSync(&buf)}
+	line := "password=top-secret-2 token=top-secret short=abc\n"
+	if n, err := writer.Write([]byte(line)); err != nil || n != len(line) {
+		t.Fatalf("Error writing log entry: %d %v", n, err)
+	}
+	if buf.String() != "password=*** token=*** short=abc\n" {
+		t.Errorf("Secrets not redacted: %s", buf.String())
+	}
+}
@@ -45,19 +45,19 @@ func newZapLogger(config Configuration) (Logger, error) {
 
 	if config.EnableConsole {
 		level := getZapLevel(config.ConsoleLevel)
-		writer := zapcore.Lock(os.Stdout)
+		writer := redactingWriter{zapcore.Lock(os.Stdout)}
 		core := zapcore.NewCore(getEncoder(config.ConsoleJSONFormat, config.Color), writer, level)
 		cores = append(cores, core)
 	}
 
 	if config.EnableFile {
 		level := getZapLevel(config.FileLevel)
-		writer := zapcore.AddSync(&lumberjack.Logger{
+		writer := redactingWriter{zapcore.AddSync(&lumberjack.Logger{
 			Filename: config.FileLocation,
 			MaxSize:  100,
 			Compress: true,
 			MaxAge:   28,
-		})
+		})}
 		core := zapcore.NewCore(getEncoder(config.FileJSONFormat, config.Color), writer, level)
 		cores = append(cores, core)
 	}
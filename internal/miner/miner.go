@@ -0,0 +1,279 @@
+package miner
+
+import (
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/internal/social"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"github.com/pkg/errors"
+	"sync"
+	"text/template"
+)
+
+// Names of the rules of miner messages.
+const (
+	RULE_MINED_BLOCK  = "mined_block"  // a pool mined a block
+	RULE_MINER_PAYOUT = "miner_payout" // a pool paid its miners at least MinerTrackerConfig.PayoutThresholdBch
+)
+
+// Labels of TX sent by pools.
+const (
+	LABEL_COINBASE     = "coinbase"
+	LABEL_MINER_PAYOUT = "miner_payout"
+)
+
+// LastBlockMinedEvent is the monitoring event of the pool that mined the last block.
+const LastBlockMinedEvent = "LastBlockMined"
+
+const (
+	defaultBlockText  = "⛏ {{.Pool}} mined block {{.BlockHeight}} with a reward of {{bch .AmountRaw}} #{{.Symbol}} ({{.FiatAmount}} {{.FiatSymbol}})\n\nTX: {{.TxLink}}"
+	defaultPayoutText = "⛏ {{.Pool}} paid {{.Amount}} #{{.Symbol}} ({{.FiatAmount}} {{.FiatSymbol}}) to its miners\n\nTX: {{.TxLink}}"
+
+	// how many coinbase addresses of pools to keep to detect their payouts
+	maxPoolAddresses = 10000
+)
+
+// MinerTracker identifies the pools that mined blocks from their coinbase TX and
+// detects payouts of pools to their miners.
+type MinerTracker struct {
+	config     MinerTrackerConfig
+	logger     log.Logger
+	monitor    *monitoring.HttpMonitoring
+	msgBuilder *social.MessageBuilder
+	pools      []*Pool // configured pools before DefaultPools
+	blockText  *template.Template
+	payoutText *template.Template
+	recordOnly bool // don't publish anything (for backfilling)
+
+	lock         sync.Mutex
+	addresses    map[string]*Pool // address -> pool
+	learnedOrder []string         // addresses learned from coinbase TX in the order they were added to remove old ones
+
+	blocksMined     *monitoring.Counter
+	payoutsDetected *monitoring.Counter
+}
+
+type MinerTrackerConfig struct {
+	AnnounceBlocks     bool    // post a message for every mined block
+	BlockText          string  // text/template with TransactionData, defaults to defaultBlockText
+	PayoutText         string  // text/template with TransactionData, defaults to defaultPayoutText
+	PayoutThresholdBch float64 // post payouts of pools of at least this amount, 0 = disabled
+	Pools              []*Pool // checked before DefaultPools
+}
+
+func NewMinerTracker(config MinerTrackerConfig, logger log.Logger, monitor *monitoring.HttpMonitoring, msgBuilder *social.MessageBuilder) (*MinerTracker, error) {
+	if len(config.BlockText) == 0 {
+		config.BlockText = defaultBlockText
+	}
+	if len(config.PayoutText) == 0 {
+		config.PayoutText = defaultPayoutText
+	}
+	blockText, err := template.New("block").Funcs(price.TemplateFuncs).Parse(config.BlockText)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing mined block template")
+	}
+	payoutText, err := template.New("payout").Funcs(price.TemplateFuncs).Parse(config.PayoutText)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing miner payout template")
+	}
+
+	pools := make([]*Pool, 0, len(config.Pools)+len(DefaultPools))
+	pools = append(pools, config.Pools...)
+	pools = append(pools, DefaultPools...)
+	metrics := monitor.Metrics()
+	tracker := &MinerTracker{
+		config: config,
+		logger: logger.WithFields(
+			log.Fields{
+				"module": "miner",
+			},
+		),
+		monitor:      monitor,
+		msgBuilder:   msgBuilder,
+		pools:        pools,
+		blockText:    blockText,
+		payoutText:   payoutText,
+		addresses:    make(map[string]*Pool, 100),
+		learnedOrder: make([]string, 0, 100),
+
+		blocksMined:     metrics.Counter("cashwhale_blocks_mined_total", "Number of blocks mined per pool.", "pool"),
+		payoutsDetected: metrics.Counter("cashwhale_miner_payouts_total", "Number of large payouts of pools to their miners.", "pool"),
+	}
+	for _, pool := range tracker.pools {
+		for _, address := range pool.Addresses {
+			if _, exists := tracker.addresses[address]; !exists {
+				tracker.addresses[address] = pool
+			}
+		}
+	}
+	return tracker, nil
+}
+
+// SetRecordOnly disables publishing. Pools are still identified.
+// Call this before checking any blocks.
+func (m *MinerTracker) SetRecordOnly(recordOnly bool) {
+	if m == nil {
+		return
+	}
+	m.recordOnly = recordOnly
+}
+
+// CheckCoinbase identifies the pool that mined the block of the coinbase TX and announces the block.
+// Returns nil if the pool is unknown.
+func (m *MinerTracker) CheckCoinbase(tx *parser.Transaction) *Pool {
+	if m == nil || !tx.IsCoinbase() {
+		return nil
+	}
+	script := tx.Inputs[0].Script
+	pool := matchTag(m.pools, script)
+	if pool == nil {
+		pool = m.matchOutputs(tx)
+	}
+	name := UNKNOWN_POOL
+	if pool != nil {
+		name = pool.Name
+		m.learnAddresses(tx, pool)
+	}
+	m.blocksMined.Inc(name)
+	m.monitor.AddEvent(LastBlockMinedEvent, monitoring.D{
+		"pool":     name,
+		"height":   tx.BlockHeight,
+		"coinbase": CoinbaseText(script),
+	})
+	m.logger.Debugf("Block %d mined by %s", tx.BlockHeight, name)
+
+	if !m.config.AnnounceBlocks || m.recordOnly {
+		return pool
+	}
+	m.sendNotice(&social.TransactionData{
+		AmountRaw:   tx.OutputValue(),
+		Hash:        tx.Hash,
+		Confirmed:   true,
+		BlockHeight: tx.BlockHeight,
+		Rule:        RULE_MINED_BLOCK,
+		Labels:      []string{"confirmed", LABEL_COINBASE},
+		Pool:        name,
+	}, m.blockText)
+	return pool
+}
+
+// PayoutPool returns the pool if the TX spends outputs of a pool address or nil.
+func (m *MinerTracker) PayoutPool(tx *parser.Transaction) *Pool {
+	if m == nil || tx.IsCoinbase() {
+		return nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, in := range tx.Inputs {
+		if in.Prevout == nil || len(in.Prevout.Address) == 0 {
+			continue
+		}
+		if pool, exists := m.addresses[in.Prevout.Address]; exists {
+			return pool
+		}
+	}
+	return nil
+}
+
+// CheckPayout posts a message if the TX is a payout of a pool to its miners of at least PayoutThresholdBch.
+// Returns the pool if the TX is a payout (of any amount) or nil.
+func (m *MinerTracker) CheckPayout(tx *parser.Transaction) *Pool {
+	pool := m.PayoutPool(tx)
+	if pool == nil {
+		return nil
+	}
+	amount, large := m.countPayout(tx, pool)
+	if !large || m.recordOnly {
+		return pool
+	}
+	m.sendNotice(&social.TransactionData{
+		AmountRaw:   amount,
+		FeeRaw:      tx.Fee(),
+		Hash:        tx.Hash,
+		Confirmed:   true,
+		BlockHeight: tx.BlockHeight,
+		Rule:        RULE_MINER_PAYOUT,
+		Labels:      []string{"confirmed", LABEL_MINER_PAYOUT},
+		Pool:        pool.Name,
+	}, m.payoutText)
+	return pool
+}
+
+// WhalePayout returns the pool if the whale TX is a payout of a pool or nil. The payout is counted
+// like in CheckPayout, but not posted because it's posted as whale.
+func (m *MinerTracker) WhalePayout(tx *parser.Transaction) *Pool {
+	pool := m.PayoutPool(tx)
+	if pool != nil {
+		m.countPayout(tx, pool)
+	}
+	return pool
+}
+
+// Counts the payout if it's at least PayoutThresholdBch. Returns the value of the payout and
+// true if it was counted.
+func (m *MinerTracker) countPayout(tx *parser.Transaction, pool *Pool) (price.Amount, bool) {
+	if m.config.PayoutThresholdBch <= 0.0 {
+		return 0, false
+	}
+	amount := m.payoutValue(tx, pool)
+	if amount < price.NewAmount(m.config.PayoutThresholdBch) {
+		return amount, false
+	}
+	m.payoutsDetected.Inc(pool.Name)
+	return amount, true
+}
+
+// Returns the pool of the first coinbase output with a pool address or nil.
+func (m *MinerTracker) matchOutputs(tx *parser.Transaction) *Pool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, out := range tx.Outputs {
+		if pool, exists := m.addresses[out.Address]; exists && len(out.Address) != 0 {
+			return pool
+		}
+	}
+	return nil
+}
+
+// Remembers the coinbase addresses of the pool to detect its payouts once the coinbase is spent.
+func (m *MinerTracker) learnAddresses(tx *parser.Transaction, pool *Pool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, out := range tx.Outputs {
+		if len(out.Address) == 0 {
+			continue
+		} else if _, exists := m.addresses[out.Address]; exists {
+			continue // keep configured addresses and the pool that used the address first
+		}
+		if len(m.learnedOrder) >= maxPoolAddresses {
+			delete(m.addresses, m.learnedOrder[0])
+			m.learnedOrder = m.learnedOrder[1:]
+		}
+		m.addresses[out.Address] = pool
+		m.learnedOrder = append(m.learnedOrder, out.Address)
+	}
+}
+
+// Returns the value of all outputs that don't go back to addresses of the pool.
+func (m *MinerTracker) payoutValue(tx *parser.Transaction, pool *Pool) price.Amount {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var total price.Amount
+	for _, out := range tx.Outputs {
+		if m.addresses[out.Address] != pool || len(out.Address) == 0 {
+			total += out.Value
+		}
+	}
+	return total
+}
+
+func (m *MinerTracker) sendNotice(tx *social.TransactionData, tmpl *template.Template) {
+	if err := m.msgBuilder.CreateMessageWith(tx, tmpl); err != nil {
+		m.logger.Errorf("Error creating miner message of TX %s: %+v", tx.Hash, err)
+		return
+	}
+	if err := m.msgBuilder.SendNotice(tx); err != nil {
+		m.logger.Errorf("Error sending miner message %+v", err)
+	}
+}
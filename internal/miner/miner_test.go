@@ -0,0 +1,118 @@
+package miner
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"strings"
+	"testing"
+)
+
+const (
+	testPoolScript   = "76a914f5bf48b397dae70be82b3cca4793f8eb2b6cdac988ac"
+	testPoolAddress  = "bitcoincash:qr6m7j9njldwwzlg9v7v53unlr4jkmx6eylep8ekg2"
+	testMinerScript  = "a914f5bf48b397dae70be82b3cca4793f8eb2b6cdac987"
+	testMinerAddress = "bitcoincash:pr6m7j9njldwwzlg9v7v53unlr4jkmx6eyguug74nh"
+)
+
+func newTestMinerTracker(t *testing.T, pools []*Pool) *MinerTracker {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	tracker, err := NewMinerTracker(MinerTrackerConfig{Pools: pools}, logger, nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating miner tracker: %+v", err)
+	}
+	return tracker
+}
+
+func newTestOutput(t *testing.T, value price.Amount, script string) *parser.Output {
+	data, err := hex.DecodeString(script)
+	if err != nil {
+		t.Fatalf("Invalid script: %+v", err)
+	}
+	return parser.NewParser(nil).NewOutput(value, data)
+}
+
+func newTestCoinbase(t *testing.T, coinbase string, outputs ...*parser.Output) *parser.Transaction {
+	return &parser.Transaction{
+		Hash:        "coinbase",
+		BlockHeight: 700000,
+		Inputs:      []*parser.Input{parser.NewCoinbaseInput(append([]byte{0x03, 0x60, 0xae, 0x0a}, coinbase...))},
+		Outputs:     outputs,
+	}
+}
+
+func TestCheckCoinbase(t *testing.T) {
+	tracker := newTestMinerTracker(t, nil)
+	coinbase := newTestCoinbase(t, "/ViaBTC/Mined by miner1/", newTestOutput(t, 625000000, testPoolScript))
+	if pool := tracker.CheckCoinbase(coinbase); pool == nil || pool.Name != "ViaBTC" {
+		t.Fatalf("Expected block of ViaBTC, got %+v", pool)
+	}
+
+	// the next block without tag is identified by the address of the pool
+	coinbase = newTestCoinbase(t, "", newTestOutput(t, 625000000, testPoolScript))
+	if pool := tracker.CheckCoinbase(coinbase); pool == nil || pool.Name != "ViaBTC" {
+		t.Errorf("Expected block of ViaBTC identified by address, got %+v", pool)
+	}
+	coinbase = newTestCoinbase(t, "solo", newTestOutput(t, 625000000, testMinerScript))
+	if pool := tracker.CheckCoinbase(coinbase); pool != nil {
+		t.Errorf("Expected block of unknown pool, got %+v", pool)
+	}
+
+	// configured pools replace default pools
+	tracker = newTestMinerTracker(t, []*Pool{{Name: "Own Pool", Tags: []string{"/viabtc/"}}})
+	coinbase = newTestCoinbase(t, "/ViaBTC/", newTestOutput(t, 625000000, testPoolScript))
+	if pool := tracker.CheckCoinbase(coinbase); pool == nil || pool.Name != "Own Pool" {
+		t.Errorf("Expected block of configured pool, got %+v", pool)
+	}
+}
+
+func TestPayoutPool(t *testing.T) {
+	pool := &Pool{Name: "Own Pool", Addresses: []string{testPoolAddress}}
+	tracker := newTestMinerTracker(t, []*Pool{pool})
+	payout := &parser.Transaction{
+		Hash:    "payout",
+		Inputs:  []*parser.Input{{PrevHash: "coinbase", Prevout: newTestOutput(t, 625000000, testPoolScript)}},
+		Outputs: []*parser.Output{newTestOutput(t, 500000000, testMinerScript), newTestOutput(t, 124990000, testPoolScript)},
+	}
+	if found := tracker.PayoutPool(payout); found != pool {
+		t.Fatalf("Expected payout of configured pool, got %+v", found)
+	}
+	if value := tracker.payoutValue(payout, pool); value != 500000000 {
+		t.Errorf("Expected payout value without change, got %d", value)
+	}
+
+	// payouts posted as whales are counted too
+	metrics := monitoring.NewMetrics()
+	tracker.payoutsDetected = metrics.Counter("cashwhale_miner_payouts_total", "Number of large payouts of pools to their miners.", "pool")
+	tracker.config.PayoutThresholdBch = 1.0
+	if found := tracker.WhalePayout(payout); found != pool {
+		t.Errorf("Expected whale payout of configured pool, got %+v", found)
+	}
+	var buf bytes.Buffer
+	metrics.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `cashwhale_miner_payouts_total{pool="Own Pool"} 1`) {
+		t.Errorf("Expected whale payout to be counted:\n%s", buf.String())
+	}
+
+	payout.Inputs[0].Prevout = newTestOutput(t, 625000000, testMinerScript)
+	if found := tracker.PayoutPool(payout); found != nil {
+		t.Errorf("Expected no payout spending a miner address, got %+v", found)
+	}
+	if found := tracker.CheckPayout(payout); found != nil {
+		t.Errorf("Expected no payout, got %+v", found)
+	}
+}
+
+func TestCoinbaseText(t *testing.T) {
+	script := append([]byte{0x03, 0x60, 0xae, 0x0a, 0x0f}, "/ViaBTC/Mined by miner1/"...)
+	script = append(append(script, 0x10, 0x00, 0xab), "ok"...)
+	if text := CoinbaseText(script); text != "/ViaBTC/Mined by miner1/" {
+		t.Errorf("Unexpected coinbase text %q", text)
+	}
+}
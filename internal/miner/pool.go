@@ -0,0 +1,67 @@
+package miner
+
+import (
+	"bytes"
+	"strings"
+)
+
+// UNKNOWN_POOL is the pool name of blocks we can't identify.
+const UNKNOWN_POOL = "Unknown"
+
+// coinbase text shorter than this is most likely part of the block height or extra nonce
+const minCoinbaseTextLen = 4
+
+// Pool is a mining pool identified by the tag in its coinbase script or by its payout addresses.
+type Pool struct {
+	Name      string   `json:"name"`
+	Tags      []string `json:"tags"`      // text in the coinbase script (case-insensitive), for example "/ViaBTC/"
+	Addresses []string `json:"addresses"` // cash addresses with prefix the pool mines to
+}
+
+// DefaultPools are pools that put a tag into the coinbase scripts of their blocks.
+// Pools of the config are checked first, so they can replace these.
+var DefaultPools = []*Pool{
+	{Name: "ViaBTC", Tags: []string{"ViaBTC"}},
+	{Name: "BTC.com", Tags: []string{"BTC.COM"}},
+	{Name: "AntPool", Tags: []string{"AntPool"}},
+	{Name: "Binance Pool", Tags: []string{"Binance"}},
+	{Name: "F2Pool", Tags: []string{"F2Pool"}},
+	{Name: "Poolin", Tags: []string{"poolin"}},
+	{Name: "Huobi Pool", Tags: []string{"HuoBi"}},
+	{Name: "Mining-Dutch", Tags: []string{"Mining-Dutch"}},
+	{Name: "Bitcoin.com", Tags: []string{"pool.bitcoin.com"}},
+	{Name: "Prohashing", Tags: []string{"Prohashing"}},
+	{Name: "SBI Crypto", Tags: []string{"SBICrypto"}},
+}
+
+// Returns the first pool with a tag in the coinbase script or nil.
+func matchTag(pools []*Pool, script []byte) *Pool {
+	lower := bytes.ToLower(script)
+	for _, pool := range pools {
+		for _, tag := range pool.Tags {
+			if len(tag) != 0 && bytes.Contains(lower, []byte(strings.ToLower(tag))) {
+				return pool
+			}
+		}
+	}
+	return nil
+}
+
+// CoinbaseText returns the readable parts of a coinbase script, such as the tag of the pool.
+func CoinbaseText(script []byte) string {
+	parts := make([]string, 0, 2)
+	start := -1
+	for i := 0; i <= len(script); i++ {
+		if i < len(script) && script[i] >= 0x20 && script[i] <= 0x7e {
+			if start == -1 {
+				start = i
+			}
+			continue
+		}
+		if start != -1 && i-start >= minCoinbaseTextLen {
+			parts = append(parts, string(script[start:i]))
+		}
+		start = -1
+	}
+	return strings.Join(parts, " ")
+}
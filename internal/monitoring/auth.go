@@ -0,0 +1,196 @@
+package monitoring
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// RouteAccess defines who can access a route of the monitoring server.
+type RouteAccess int
+
+const (
+	// ROUTE_PRIVATE routes require authentication (if credentials are configured) and are
+	// restricted to the IP allowlist (if configured).
+	ROUTE_PRIVATE RouteAccess = iota
+	// ROUTE_PUBLIC routes are available to everyone, for example the whale feed.
+	ROUTE_PUBLIC
+)
+
+type HttpAuthConfig struct {
+	Tokens      []string        `mapstructure:"Tokens"`      // bearer tokens accepted on private routes
+	Users       []HttpAuthUser  `mapstructure:"Users"`       // basic auth users accepted on private routes
+	AllowedIPs  []string        `mapstructure:"AllowedIPs"`  // IPs or CIDR ranges allowed to access private routes - empty allows all
+	PublicPaths []string        `mapstructure:"PublicPaths"` // additional routes to make public
+	Routes      []HttpRouteAuth `mapstructure:"Routes"`      // credentials of specific routes replacing Tokens and Users
+}
+
+type HttpAuthUser struct {
+	User     string `mapstructure:"User"`
+	Password string `mapstructure:"Password"`
+}
+
+// HttpRouteAuth are the credentials of all routes starting with Path.
+type HttpRouteAuth struct {
+	Path   string         `mapstructure:"Path"`
+	Tokens []string       `mapstructure:"Tokens"`
+	Users  []HttpAuthUser `mapstructure:"Users"`
+}
+
+type httpAuth struct {
+	config     HttpAuthConfig
+	allowedIPs []*net.IPNet
+
+	lock   sync.RWMutex           // routes can be added while serving
+	routes map[string]RouteAccess // registered path -> access
+}
+
+func newHttpAuth(config HttpAuthConfig) (*httpAuth, error) {
+	auth := &httpAuth{
+		config:     config,
+		allowedIPs: make([]*net.IPNet, 0, len(config.AllowedIPs)),
+		routes:     make(map[string]RouteAccess, 20),
+	}
+	for _, allowed := range config.AllowedIPs {
+		if !strings.Contains(allowed, "/") {
+			ip := net.ParseIP(allowed)
+			if ip == nil {
+				return nil, errors.New(fmt.Sprintf("invalid IP in monitoring allowlist: %s", allowed))
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			auth.allowedIPs = append(auth.allowedIPs, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(allowed)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid CIDR range in monitoring allowlist: %s", allowed))
+		}
+		auth.allowedIPs = append(auth.allowedIPs, ipNet)
+	}
+	return auth, nil
+}
+
+func (a *httpAuth) setAccess(pattern string, access RouteAccess) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.routes[pattern] = access
+}
+
+// Returns the access of a route (the pattern it was registered with).
+func (a *httpAuth) getAccess(pattern string) RouteAccess {
+	for _, public := range a.config.PublicPaths {
+		if public == pattern {
+			return ROUTE_PUBLIC
+		}
+	}
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.routes[pattern] // private if unknown
+}
+
+// Returns the configured bearer tokens and users of a route.
+// The route with the longest matching path prefix replaces the global credentials.
+func (a *httpAuth) getCredentials(path string) ([]string, []HttpAuthUser) {
+	tokens, users := a.config.Tokens, a.config.Users
+	matched := 0
+	for _, route := range a.config.Routes {
+		if strings.HasPrefix(path, route.Path) && len(route.Path) > matched {
+			tokens, users = route.Tokens, route.Users
+			matched = len(route.Path)
+		}
+	}
+	return tokens, users
+}
+
+// Check if the request may access the route. Returns the HTTP status to respond with otherwise.
+func (a *httpAuth) checkAccess(req *http.Request, pattern string) (bool, int) {
+	if a.getAccess(pattern) == ROUTE_PUBLIC {
+		return true, http.StatusOK
+	}
+	if !a.isAllowedIP(req.RemoteAddr) {
+		return false, http.StatusForbidden
+	}
+
+	tokens, users := a.getCredentials(req.URL.Path)
+	if len(tokens) == 0 && len(users) == 0 {
+		return true, http.StatusOK
+	}
+	authHeader := req.Header.Get("Authorization")
+	if strings.HasPrefix(authHeader, "Bearer ") {
+		token := strings.TrimPrefix(authHeader, "Bearer ")
+		for _, allowed := range tokens {
+			if secureCompare(token, allowed) {
+				return true, http.StatusOK
+			}
+		}
+	} else if user, password, ok := req.BasicAuth(); ok {
+		for _, allowed := range users {
+			// check both to not leak valid user names via timing
+			userOk := secureCompare(user, allowed.User)
+			passwordOk := secureCompare(password, allowed.Password)
+			if userOk && passwordOk {
+				return true, http.StatusOK
+			}
+		}
+	}
+	return false, http.StatusUnauthorized
+}
+
+// RequiresAuth returns true if the private route with this path is protected by credentials.
+func (m *HttpMonitoring) RequiresAuth(path string) bool {
+	if m == nil {
+		return false
+	}
+	for _, public := range m.auth.config.PublicPaths {
+		if strings.HasPrefix(public, path) || strings.HasPrefix(path, public) {
+			return false
+		}
+	}
+	tokens, users := m.auth.getCredentials(path)
+	return len(tokens) != 0 || len(users) != 0
+}
+
+func (a *httpAuth) isAllowedIP(remoteAddr string) bool {
+	if len(a.allowedIPs) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, allowed := range a.allowedIPs {
+		if allowed.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *HttpMonitoring) serveUnauthorized(writer http.ResponseWriter, req *http.Request, status int) {
+	if status == http.StatusUnauthorized {
+		_, users := m.auth.getCredentials(req.URL.Path)
+		if len(users) != 0 {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="cashwhale", charset="UTF-8"`)
+		} else {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="cashwhale"`)
+		}
+	}
+	m.logger.Warnf("Denied access to %s from %s (%d)", req.URL.Path, req.RemoteAddr, status)
+	m.RespondJSON(writer, status, http.StatusText(status))
+}
+
+func secureCompare(given string, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
@@ -0,0 +1,97 @@
+package monitoring
+
+import (
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestAuthMonitoring(t *testing.T, auth HttpAuthConfig) *HttpMonitoring {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	monitor, err := NewHttpMonitoring(HttpMonitoringConfig{
+		Auth: auth,
+	}, logger)
+	if err != nil {
+		t.Fatalf("Error creating monitoring: %+v", err)
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	monitor.HandlePublicFunc("/whales/stream", ok)
+	monitor.HandleFunc("/nodes", ok)
+	monitor.HandleFunc("/admin/pause", ok)
+	return monitor
+}
+
+func getTestStatus(monitor *HttpMonitoring, path string, remoteAddr string, setAuth func(req *http.Request)) int {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = remoteAddr
+	if setAuth != nil {
+		setAuth(req)
+	}
+	recorder := httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func TestAuth(t *testing.T) {
+	monitor := newTestAuthMonitoring(t, HttpAuthConfig{
+		Tokens:     []string{"secret-token"},
+		Users:      []HttpAuthUser{{User: "ops", Password: "pw"}},
+		AllowedIPs: []string{"10.0.0.0/8", "192.168.1.5"},
+		Routes: []HttpRouteAuth{{
+			Path:   "/admin",
+			Tokens: []string{"admin-token"},
+		}},
+	})
+	bearer := func(token string) func(req *http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	}
+	basic := func(user, password string) func(req *http.Request) {
+		return func(req *http.Request) { req.SetBasicAuth(user, password) }
+	}
+
+	tests := []struct {
+		path       string
+		remoteAddr string
+		setAuth    func(req *http.Request)
+		expected   int
+	}{
+		{"/whales/stream", "1.2.3.4:1000", nil, http.StatusOK},
+		{"/healthz", "1.2.3.4:1000", nil, http.StatusOK},
+		{"/nodes", "10.1.2.3:1000", nil, http.StatusUnauthorized},
+		{"/nodes", "1.2.3.4:1000", bearer("secret-token"), http.StatusForbidden},
+		{"/nodes", "10.1.2.3:1000", bearer("secret-token"), http.StatusOK},
+		{"/nodes", "192.168.1.5:1000", basic("ops", "pw"), http.StatusOK},
+		{"/nodes", "192.168.1.5:1000", basic("ops", "wrong"), http.StatusUnauthorized},
+		{"/metrics", "10.1.2.3:1000", bearer("wrong"), http.StatusUnauthorized},
+		{"/admin/pause", "10.1.2.3:1000", bearer("secret-token"), http.StatusUnauthorized},
+		{"/admin/pause", "10.1.2.3:1000", bearer("admin-token"), http.StatusOK},
+	}
+	for _, test := range tests {
+		if status := getTestStatus(monitor, test.path, test.remoteAddr, test.setAuth); status != test.expected {
+			t.Errorf("Expected %d for %s from %s, got %d", test.expected, test.path, test.remoteAddr, status)
+		}
+	}
+}
+
+func TestAuthPublicPaths(t *testing.T) {
+	monitor := newTestAuthMonitoring(t, HttpAuthConfig{
+		Tokens:      []string{"secret-token"},
+		PublicPaths: []string{"/nodes"},
+	})
+	if status := getTestStatus(monitor, "/nodes", "1.2.3.4:1000", nil); status != http.StatusOK {
+		t.Errorf("Expected configured public path to be accessible, got %d", status)
+	}
+	if status := getTestStatus(monitor, "/monitoring", "1.2.3.4:1000", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected private path to require auth, got %d", status)
+	}
+}
+
+func TestAuthInvalidAllowlist(t *testing.T) {
+	if _, err := newHttpAuth(HttpAuthConfig{AllowedIPs: []string{"not-an-ip"}}); err == nil {
+		t.Errorf("Expected error for invalid allowlist")
+	}
+}
@@ -0,0 +1,63 @@
+package monitoring
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultEventHistory is the number of values kept per event if not configured.
+const DefaultEventHistory = 100
+
+// eventHistory is a fixed size ring buffer of the last values of an event.
+type eventHistory struct {
+	events []*Event
+	next   int // index of the next write
+	full   bool
+}
+
+func newEventHistory(size int) *eventHistory {
+	return &eventHistory{
+		events: make([]*Event, size),
+	}
+}
+
+func (h *eventHistory) add(event *Event) {
+	h.events[h.next] = event
+	h.next = (h.next + 1) % len(h.events)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// latest returns the most recent event or nil if no event was added yet.
+func (h *eventHistory) latest() *Event {
+	if h.next == 0 && !h.full {
+		return nil
+	}
+	return h.events[(h.next-1+len(h.events))%len(h.events)]
+}
+
+// filter returns all events (oldest first) with from <= When <= to. Zero times are unbounded.
+func (h *eventHistory) filter(from time.Time, to time.Time) []*Event {
+	start, count := 0, h.next
+	if h.full {
+		start, count = h.next, len(h.events)
+	}
+	events := make([]*Event, 0, count)
+	for i := 0; i < count; i++ {
+		event := h.events[(start+i)%len(h.events)]
+		if !from.IsZero() && event.When < from.Unix() {
+			continue
+		} else if !to.IsZero() && event.When > to.Unix() {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// The history of all registered events. Events are added from multiple goroutines.
+type eventStore struct {
+	lock    sync.RWMutex
+	history map[string]*eventHistory
+}
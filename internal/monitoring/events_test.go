@@ -0,0 +1,78 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEventHistory(t *testing.T) {
+	history := newEventHistory(3)
+	if history.latest() != nil || len(history.filter(time.Time{}, time.Time{})) != 0 {
+		t.Fatalf("Expected empty history")
+	}
+	for i := int64(1); i <= 5; i++ {
+		history.add(&Event{Data: i, When: i * 10})
+	}
+	if latest := history.latest(); latest.Data != int64(5) {
+		t.Errorf("Unexpected latest event: %+v", latest)
+	}
+	events := history.filter(time.Time{}, time.Time{})
+	if len(events) != 3 || events[0].Data != int64(3) || events[2].Data != int64(5) {
+		t.Errorf("Expected the last 3 events oldest first, got %+v", events)
+	}
+	events = history.filter(time.Unix(35, 0), time.Unix(45, 0))
+	if len(events) != 1 || events[0].Data != int64(4) {
+		t.Errorf("Unexpected events in time range: %+v", events)
+	}
+}
+
+func getTestEvents(t *testing.T, monitor *HttpMonitoring, path string) (int, *MonitoringHttpResponse) {
+	recorder := httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	var res MonitoringHttpResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Error parsing %s response: %+v", path, err)
+	}
+	return recorder.Code, &res
+}
+
+func TestServeEventHistory(t *testing.T) {
+	monitor := newTestMonitoring(t)
+	for i := 0; i < 3; i++ {
+		if err := monitor.AddEvent("LastTweet", i); err != nil {
+			t.Fatalf("Error adding event: %+v", err)
+		}
+	}
+	if err := monitor.AddEvent("Unknown", 1); err == nil {
+		t.Errorf("Expected error adding unregistered event")
+	}
+
+	status, res := getTestEvents(t, monitor, "/monitoring")
+	if status != http.StatusOK || res.History != nil || res.Data["LastTweet"].Data != float64(2) {
+		t.Errorf("Unexpected response without query: %d %+v", status, res)
+	}
+
+	now := time.Now().Unix()
+	status, res = getTestEvents(t, monitor, "/monitoring?event=LastTweet&from=0&to="+strconv.FormatInt(now+1, 10))
+	if status != http.StatusOK || len(res.History["LastTweet"]) != 3 {
+		t.Errorf("Unexpected history response: %d %+v", status, res)
+	}
+
+	status, res = getTestEvents(t, monitor, "/monitoring?from="+strconv.FormatInt(now+60, 10))
+	if status != http.StatusOK || len(res.History["LastTweet"]) != 0 {
+		t.Errorf("Expected empty history in the future: %d %+v", status, res)
+	}
+
+	for _, path := range []string{"/monitoring?event=Unknown", "/monitoring?from=yesterday", "/monitoring?from=20&to=10"} {
+		recorder := httptest.NewRecorder()
+		monitor.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+		var res JsonHttpResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &res); err != nil || recorder.Code != http.StatusBadRequest || !res.Error {
+			t.Errorf("Expected bad request for %s, got %d %s", path, recorder.Code, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HealthCheck returns an error if the component is not healthy.
+type HealthCheck func() error
+
+// HealthProbe is the kind of probe a health check is included in.
+type HealthProbe int
+
+const (
+	// PROBE_READINESS checks are only included in /readyz. A failure means the bot can't do its work
+	// right now (for example the price API is down), but a restart won't help.
+	PROBE_READINESS HealthProbe = iota
+	// PROBE_LIVENESS checks are included in /healthz and /readyz. A failure means the bot is stuck
+	// and should be restarted.
+	PROBE_LIVENESS
+)
+
+type healthCheck struct {
+	probe HealthProbe
+	check HealthCheck
+}
+
+type healthChecks struct {
+	lock   sync.Mutex
+	checks map[string]*healthCheck
+}
+
+// ComponentHealth is the status of a single component.
+type ComponentHealth struct {
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message"`
+}
+
+type HealthHttpResponse struct {
+	Status     string                      `json:"status"` // ok|degraded
+	Components map[string]*ComponentHealth `json:"components"`
+	Time       int64                       `json:"time"` // unix timestamp
+}
+
+// AddHealthCheck registers a health check of a component under a unique name.
+// Calling it again with the same name replaces the previous check.
+func (m *HttpMonitoring) AddHealthCheck(name string, probe HealthProbe, check HealthCheck) {
+	if m == nil {
+		return
+	}
+	m.health.lock.Lock()
+	defer m.health.lock.Unlock()
+	m.health.checks[name] = &healthCheck{
+		probe: probe,
+		check: check,
+	}
+}
+
+// RemoveHealthCheck removes the health check of a component that got stopped.
+func (m *HttpMonitoring) RemoveHealthCheck(name string) {
+	if m == nil {
+		return
+	}
+	m.health.lock.Lock()
+	defer m.health.lock.Unlock()
+	delete(m.health.checks, name)
+}
+
+// CheckHealth runs all health checks included in the probe and returns their status.
+func (m *HttpMonitoring) CheckHealth(probe HealthProbe) (bool, map[string]*ComponentHealth) {
+	m.health.lock.Lock()
+	checks := make(map[string]*healthCheck, len(m.health.checks))
+	for name, check := range m.health.checks {
+		checks[name] = check
+	}
+	m.health.lock.Unlock()
+
+	healthy := true
+	components := make(map[string]*ComponentHealth, len(checks))
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		check := checks[name]
+		if probe == PROBE_LIVENESS && check.probe != PROBE_LIVENESS {
+			continue
+		}
+		status := &ComponentHealth{
+			Healthy: true,
+			Message: "ok",
+		}
+		if err := check.check(); err != nil {
+			healthy = false
+			status.Healthy = false
+			status.Message = err.Error()
+		}
+		components[name] = status
+	}
+	return healthy, components
+}
+
+func (m *HttpMonitoring) serveLiveness(writer http.ResponseWriter, req *http.Request) {
+	m.serveHealth(writer, req, PROBE_LIVENESS)
+}
+
+func (m *HttpMonitoring) serveReadiness(writer http.ResponseWriter, req *http.Request) {
+	m.serveHealth(writer, req, PROBE_READINESS)
+}
+
+func (m *HttpMonitoring) serveHealth(writer http.ResponseWriter, req *http.Request, probe HealthProbe) {
+	if req.Method != "GET" {
+		m.serveNotFound(writer)
+		return
+	}
+
+	healthy, components := m.CheckHealth(probe)
+	res := HealthHttpResponse{
+		Status:     "ok",
+		Components: components,
+		Time:       time.Now().Unix(),
+	}
+	status := http.StatusOK
+	if !healthy {
+		res.Status = "degraded"
+		status = http.StatusServiceUnavailable
+	}
+
+	jsonData, err := json.Marshal(res)
+	if err != nil {
+		m.logger.Errorf("Error responding health data: %+v", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(status)
+	writer.Write(jsonData)
+}
@@ -0,0 +1,66 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestMonitoring(t *testing.T) *HttpMonitoring {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	monitor, err := NewHttpMonitoring(HttpMonitoringConfig{
+		Events: []string{"LastTweet"},
+	}, logger)
+	if err != nil {
+		t.Fatalf("Error creating monitoring: %+v", err)
+	}
+	return monitor
+}
+
+func getTestHealth(t *testing.T, monitor *HttpMonitoring, path string) (int, *HealthHttpResponse) {
+	recorder := httptest.NewRecorder()
+	monitor.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	var res HealthHttpResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Error parsing %s response: %+v", path, err)
+	}
+	return recorder.Code, &res
+}
+
+func TestHealthChecks(t *testing.T) {
+	monitor := newTestMonitoring(t)
+	var priceErr error
+	monitor.AddHealthCheck("last_block", PROBE_LIVENESS, func() error { return nil })
+	monitor.AddHealthCheck("price", PROBE_READINESS, func() error { return priceErr })
+
+	code, res := getTestHealth(t, monitor, "/readyz")
+	if code != http.StatusOK || res.Status != "ok" || len(res.Components) != 2 {
+		t.Errorf("Expected healthy readiness, got %d %+v", code, res)
+	}
+
+	// a failing readiness check doesn't affect liveness
+	priceErr = errors.New("price API down")
+	code, res = getTestHealth(t, monitor, "/readyz")
+	if code != http.StatusServiceUnavailable || res.Status != "degraded" {
+		t.Errorf("Expected degraded readiness, got %d %+v", code, res)
+	}
+	if res.Components["price"].Healthy || res.Components["price"].Message != "price API down" || !res.Components["last_block"].Healthy {
+		t.Errorf("Unexpected component status: %+v", res.Components)
+	}
+	code, res = getTestHealth(t, monitor, "/healthz")
+	if code != http.StatusOK || len(res.Components) != 1 || res.Components["last_block"] == nil {
+		t.Errorf("Expected healthy liveness with only liveness checks, got %d %+v", code, res)
+	}
+
+	monitor.AddHealthCheck("last_block", PROBE_LIVENESS, func() error { return errors.New("stuck") })
+	code, res = getTestHealth(t, monitor, "/healthz")
+	if code != http.StatusServiceUnavailable || res.Components["last_block"].Healthy {
+		t.Errorf("Expected failing liveness, got %d %+v", code, res)
+	}
+}
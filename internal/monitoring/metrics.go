@@ -0,0 +1,276 @@
+package monitoring
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets are histogram buckets in seconds for network requests.
+var DefaultLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	metricTypeCounter   = "counter"
+	metricTypeGauge     = "gauge"
+	metricTypeHistogram = "histogram"
+)
+
+// Metrics is a minimal registry of counters, gauges and histograms that
+// can be exported in the Prometheus text exposition format.
+// All methods are safe to be called on a nil registry (they do nothing) so
+// callers don't have to check if monitoring is enabled.
+type Metrics struct {
+	lock     sync.Mutex
+	families []*metricFamily // in order of registration
+	byName   map[string]*metricFamily
+}
+
+type metricFamily struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	buckets    []float64 // only for histograms
+
+	lock   sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64 // counter or gauge value
+
+	// histogram values
+	bucketCounts []uint64
+	sum          float64
+	count        uint64
+}
+
+// A Counter can only go up. It is reset when the process restarts.
+type Counter struct {
+	family *metricFamily
+}
+
+// A Gauge can go up and down.
+type Gauge struct {
+	family *metricFamily
+}
+
+// A Histogram counts observed values in buckets.
+type Histogram struct {
+	family *metricFamily
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		families: make([]*metricFamily, 0, 20),
+		byName:   make(map[string]*metricFamily, 20),
+	}
+}
+
+// Counter returns the counter of the given name, creating it on first use.
+func (r *Metrics) Counter(name string, help string, labelNames ...string) *Counter {
+	family := r.getOrCreate(name, help, metricTypeCounter, labelNames, nil)
+	if family == nil {
+		return nil
+	}
+	return &Counter{family: family}
+}
+
+// Gauge returns the gauge of the given name, creating it on first use.
+func (r *Metrics) Gauge(name string, help string, labelNames ...string) *Gauge {
+	family := r.getOrCreate(name, help, metricTypeGauge, labelNames, nil)
+	if family == nil {
+		return nil
+	}
+	return &Gauge{family: family}
+}
+
+// Histogram returns the histogram of the given name, creating it on first use.
+// buckets are the upper bounds of the buckets in increasing order (+Inf is added automatically).
+func (r *Metrics) Histogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	family := r.getOrCreate(name, help, metricTypeHistogram, labelNames, buckets)
+	if family == nil {
+		return nil
+	}
+	return &Histogram{family: family}
+}
+
+func (r *Metrics) getOrCreate(name string, help string, metricType string, labelNames []string, buckets []float64) *metricFamily {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	family, exists := r.byName[name]
+	if exists {
+		return family
+	}
+
+	family = &metricFamily{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*metricSeries, 1),
+	}
+	r.families = append(r.families, family)
+	r.byName[name] = family
+	return family
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds the given positive value to the counter.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if c == nil || value < 0 {
+		return
+	}
+	c.family.update(labelValues, func(s *metricSeries) {
+		s.value += value
+	})
+}
+
+// Set sets the gauge to the given value.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+	g.family.update(labelValues, func(s *metricSeries) {
+		s.value = value
+	})
+}
+
+// Add adds the given value (can be negative) to the gauge.
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+	g.family.update(labelValues, func(s *metricSeries) {
+		s.value += value
+	})
+}
+
+// Observe adds a single value to the histogram.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+	h.family.update(labelValues, func(s *metricSeries) {
+		for i, upperBound := range h.family.buckets {
+			if value <= upperBound {
+				s.bucketCounts[i]++
+			}
+		}
+		s.sum += value
+		s.count++
+	})
+}
+
+func (f *metricFamily) update(labelValues []string, updateFn func(s *metricSeries)) {
+	// fill missing label values so that wrong calls don't produce invalid output
+	values := make([]string, len(f.labelNames))
+	copy(values, labelValues)
+	key := strings.Join(values, "\xff")
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	s, exists := f.series[key]
+	if !exists {
+		s = &metricSeries{
+			labelValues:  values,
+			bucketCounts: make([]uint64, len(f.buckets)),
+		}
+		f.series[key] = s
+	}
+	updateFn(s)
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format.
+func (r *Metrics) WriteTo(writer io.Writer) (int64, error) {
+	if r == nil {
+		return 0, nil
+	}
+	r.lock.Lock()
+	families := make([]*metricFamily, len(r.families))
+	copy(families, r.families)
+	r.lock.Unlock()
+
+	var buf bytes.Buffer
+	for _, family := range families {
+		family.write(&buf)
+	}
+	return buf.WriteTo(writer)
+}
+
+func (f *metricFamily) write(buf *bytes.Buffer) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	buf.WriteString(fmt.Sprintf("# HELP %s %s\n", f.name, escapeMetricHelp(f.help)))
+	buf.WriteString(fmt.Sprintf("# TYPE %s %s\n", f.name, f.metricType))
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.metricType != metricTypeHistogram {
+			buf.WriteString(fmt.Sprintf("%s%s %s\n", f.name, f.formatLabels(s.labelValues, "", ""), formatMetricValue(s.value)))
+			continue
+		}
+
+		for i, upperBound := range f.buckets {
+			buf.WriteString(fmt.Sprintf("%s_bucket%s %d\n", f.name, f.formatLabels(s.labelValues, "le", formatMetricValue(upperBound)), s.bucketCounts[i]))
+		}
+		buf.WriteString(fmt.Sprintf("%s_bucket%s %d\n", f.name, f.formatLabels(s.labelValues, "le", "+Inf"), s.count))
+		buf.WriteString(fmt.Sprintf("%s_sum%s %s\n", f.name, f.formatLabels(s.labelValues, "", ""), formatMetricValue(s.sum)))
+		buf.WriteString(fmt.Sprintf("%s_count%s %d\n", f.name, f.formatLabels(s.labelValues, "", ""), s.count))
+	}
+}
+
+func (f *metricFamily) formatLabels(labelValues []string, extraName string, extraValue string) string {
+	pairs := make([]string, 0, len(f.labelNames)+1)
+	for i, name := range f.labelNames {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeMetricLabel(labelValues[i])))
+	}
+	if len(extraName) != 0 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetricValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+func escapeMetricLabel(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
+
+func escapeMetricHelp(help string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(help)
+}
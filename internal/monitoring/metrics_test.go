@@ -0,0 +1,69 @@
+package monitoring
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	metrics := NewMetrics()
+	blocks := metrics.Counter("test_blocks_total", "Blocks processed.")
+	blocks.Inc()
+	blocks.Add(2)
+	metrics.Counter("test_blocks_total", "Blocks processed.").Inc() // same counter on 2nd call
+
+	published := metrics.Counter("test_publish_total", "Published messages.", "publisher", "result")
+	published.Inc("twitter", "success")
+	published.Inc("telegram", "failure")
+	published.Inc("twitter", "success")
+
+	height := metrics.Gauge("test_height", "Node height.", "node")
+	height.Set(700000, "node \"1\"")
+
+	latency := metrics.Histogram("test_latency_seconds", "Latency.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(3)
+
+	var buf bytes.Buffer
+	if _, err := metrics.WriteTo(&buf); err != nil {
+		t.Fatalf("Error writing metrics: %+v", err)
+	}
+	want := `# HELP test_blocks_total Blocks processed.
+# TYPE test_blocks_total counter
+test_blocks_total 4
+# HELP test_publish_total Published messages.
+# TYPE test_publish_total counter
+test_publish_total{publisher="telegram",result="failure"} 1
+test_publish_total{publisher="twitter",result="success"} 2
+# HELP test_height Node height.
+# TYPE test_height gauge
+test_height{node="node \"1\""} 700000
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 1
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 3.55
+test_latency_seconds_count 3
+`
+	if buf.String() != want {
+		t.Errorf("Unexpected metrics output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestMetricsNil(t *testing.T) {
+	// monitoring can be disabled, so all calls must be safe on nil
+	var monitor *HttpMonitoring
+	metrics := monitor.Metrics()
+	metrics.Counter("test_total", "Test.").Inc()
+	metrics.Gauge("test_gauge", "Test.").Set(1)
+	metrics.Histogram("test_histogram", "Test.", DefaultLatencyBuckets).Observe(1)
+
+	var buf bytes.Buffer
+	metrics.WriteTo(&buf)
+	if len(strings.TrimSpace(buf.String())) != 0 {
+		t.Errorf("Expected no output for nil metrics")
+	}
+}
@@ -2,11 +2,15 @@ package monitoring
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Ekliptor/cashwhale/internal/log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -28,21 +32,49 @@ type Event struct {
 type HttpMonitoringConfig struct {
 	HttpListenAddress string   // for example ":8080"
 	Path              string   // the HTTP path to serve monitoring data on - defaults to "/monitoring"
+	MetricsPath       string   // the HTTP path to serve Prometheus metrics on - defaults to "/metrics"
+	LivenessPath      string   // defaults to "/healthz"
+	ReadinessPath     string   // defaults to "/readyz"
 	Events            []string // A list of event names to keep track of
+	EventHistory      int      // how many values to keep per event - defaults to DefaultEventHistory
+
+	TLSCertFile string // serve HTTPS if set (together with TLSKeyFile). Send SIGHUP to reload the certificate
+	TLSKeyFile  string
+	Auth        HttpAuthConfig
 }
 
 // The monitoring server with API to add events.
 type HttpMonitoring struct {
 	config HttpMonitoringConfig
 	logger log.Logger
+	mux    *http.ServeMux
+	auth   *httpAuth
 
-	events EventMap
+	events  eventStore
+	metrics *Metrics
+	health  healthChecks
 }
 
 func NewHttpMonitoring(config HttpMonitoringConfig, logger log.Logger) (*HttpMonitoring, error) {
 	if len(config.Path) == 0 {
 		config.Path = "/monitoring"
 	}
+	if len(config.MetricsPath) == 0 {
+		config.MetricsPath = "/metrics"
+	}
+	if len(config.LivenessPath) == 0 {
+		config.LivenessPath = "/healthz"
+	}
+	if len(config.ReadinessPath) == 0 {
+		config.ReadinessPath = "/readyz"
+	}
+	if config.EventHistory <= 0 {
+		config.EventHistory = DefaultEventHistory
+	}
+	auth, err := newHttpAuth(config.Auth)
+	if err != nil {
+		return nil, err
+	}
 	m := &HttpMonitoring{
 		config: config,
 		logger: logger.WithFields(
@@ -50,17 +82,96 @@ func NewHttpMonitoring(config HttpMonitoringConfig, logger log.Logger) (*HttpMon
 				"module": "monitoring",
 			},
 		),
-		events: make(EventMap, len(config.Events)),
+		mux:  http.NewServeMux(),
+		auth: auth,
+		events: eventStore{
+			history: make(map[string]*eventHistory, len(config.Events)),
+		},
+		metrics: NewMetrics(),
+		health: healthChecks{
+			checks: make(map[string]*healthCheck, 10),
+		},
 	}
 
 	// copy all event keys
 	for _, key := range config.Events {
-		m.events[key] = nil
+		m.events.history[key] = newEventHistory(config.EventHistory)
 	}
 
+	m.HandleFunc(config.Path, m.serveEvents)
+	m.HandleFunc(config.MetricsPath, m.serveMetrics)
+	m.HandlePublicFunc(config.LivenessPath, m.serveLiveness)
+	m.HandlePublicFunc(config.ReadinessPath, m.serveReadiness)
+
 	return m, nil
 }
 
+// Metrics returns the registry of all Prometheus metrics.
+// It returns nil (which can be used safely) if monitoring is disabled.
+func (m *HttpMonitoring) Metrics() *Metrics {
+	if m == nil {
+		return nil
+	}
+	return m.metrics
+}
+
+// HandleFunc registers another private HTTP route on the monitoring server.
+func (m *HttpMonitoring) HandleFunc(path string, handler func(http.ResponseWriter, *http.Request)) {
+	m.HandleRoute(path, ROUTE_PRIVATE, handler)
+}
+
+// HandlePublicFunc registers another HTTP route everybody can access.
+func (m *HttpMonitoring) HandlePublicFunc(path string, handler func(http.ResponseWriter, *http.Request)) {
+	m.HandleRoute(path, ROUTE_PUBLIC, handler)
+}
+
+// HandleRoute registers another HTTP route with the given access on the monitoring server.
+func (m *HttpMonitoring) HandleRoute(path string, access RouteAccess, handler func(http.ResponseWriter, *http.Request)) {
+	if m == nil {
+		return
+	}
+	m.auth.setAccess(path, access)
+	m.mux.HandleFunc(path, handler)
+}
+
+// HandleJSON registers a GET route responding with the JSON data returned by dataFn.
+func (m *HttpMonitoring) HandleJSON(path string, dataFn func() interface{}) {
+	m.HandleFunc(path, func(writer http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" || req.URL.Path != path {
+			m.serveNotFound(writer)
+			return
+		}
+		m.RespondJSON(writer, http.StatusOK, dataFn())
+	})
+}
+
+// JsonHttpResponse is the format of all JSON responses of the monitoring server.
+type JsonHttpResponse struct {
+	Error bool        `json:"error"`
+	Data  interface{} `json:"data"`
+	Time  int64       `json:"time"` // unix timestamp
+}
+
+// RespondJSON writes data as JSON response.
+func (m *HttpMonitoring) RespondJSON(writer http.ResponseWriter, status int, data interface{}) {
+	res := JsonHttpResponse{
+		Error: status >= http.StatusBadRequest,
+		Data:  data,
+		Time:  time.Now().Unix(),
+	}
+	jsonData, err := json.Marshal(res)
+	if err != nil {
+		m.logger.Errorf("Error responding JSON data: %+v", err)
+		res.Error = true
+		res.Data = nil // the payload most likely caused the error
+		jsonData, _ = json.Marshal(res)
+		status = http.StatusInternalServerError
+	}
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(status)
+	writer.Write(jsonData)
+}
+
 // Starts to serve monitoring data on the configured address.
 // This call is blocking.
 func (m *HttpMonitoring) ListenHttp(ctx context.Context) error {
@@ -68,6 +179,10 @@ func (m *HttpMonitoring) ListenHttp(ctx context.Context) error {
 		Addr:        m.config.HttpListenAddress,
 		Handler:     m,
 		ReadTimeout: 30 * time.Second,
+		// end open streams on shutdown
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
 		//ErrorLog:    goLog.New(log.GetWriter(), "HTTP: ", 0),
 	}
 
@@ -80,8 +195,26 @@ func (m *HttpMonitoring) ListenHttp(ctx context.Context) error {
 		close(done)
 	}()
 
-	m.logger.Infof("Serving HTTP monitoring JSON on %s%s", m.config.HttpListenAddress, m.config.Path)
-	if err := s.ListenAndServe(); err != nil {
+	var err error
+	if len(m.config.TLSCertFile) != 0 || len(m.config.TLSKeyFile) != 0 {
+		var loader *certificateLoader
+		loader, err = newCertificateLoader(m.config.TLSCertFile, m.config.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		s.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: loader.getCertificate,
+		}
+		go m.reloadCertificateOnSignal(ctx, loader)
+
+		m.logger.Infof("Serving HTTPS monitoring JSON on %s%s and metrics on %s", m.config.HttpListenAddress, m.config.Path, m.config.MetricsPath)
+		err = s.ListenAndServeTLS("", "") // certificate from TLSConfig
+	} else {
+		m.logger.Infof("Serving HTTP monitoring JSON on %s%s and metrics on %s", m.config.HttpListenAddress, m.config.Path, m.config.MetricsPath)
+		err = s.ListenAndServe()
+	}
+	if err != nil {
 		return err
 	}
 
@@ -89,51 +222,195 @@ func (m *HttpMonitoring) ListenHttp(ctx context.Context) error {
 	return nil
 }
 
-// AddEvent adds an event with the current timestamp. It overwrites the previous event
-// of the same name (if existing).
+// AddEvent adds an event with the current timestamp to the history of this event.
+// The oldest value is removed once the history is full.
 func (m *HttpMonitoring) AddEvent(name string, value interface{}) error {
-	_, exists := m.events[name]
+	if m == nil {
+		return nil
+	}
+	m.events.lock.Lock()
+	defer m.events.lock.Unlock()
+	history, exists := m.events.history[name]
 	if exists == false { // only allow pre-registered events to prevent consuming too much memory
 		return errors.New(fmt.Sprintf("can not add unknown event '%s' - please add it to config first", name))
 	}
-	m.events[name] = &Event{
+	history.add(&Event{
 		Data: value,
 		When: time.Now().Unix(),
-	}
+	})
 	return nil
 }
 
-// GetEvent returns a registered event value.
+// GetEvent returns the latest value of a registered event.
 func (m *HttpMonitoring) GetEvent(name string) *Event {
-	event, exists := m.events[name]
+	if m == nil {
+		return nil
+	}
+	m.events.lock.RLock()
+	defer m.events.lock.RUnlock()
+	history, exists := m.events.history[name]
 	if exists == false {
 		m.logger.Errorf("Can not fetch unregistered event: %s", name)
 		return nil
 	}
-	return event
+	return history.latest()
+}
+
+// GetEventHistory returns all values of a registered event (oldest first) within the time range.
+// Zero times are unbounded.
+func (m *HttpMonitoring) GetEventHistory(name string, from time.Time, to time.Time) []*Event {
+	if m == nil {
+		return nil
+	}
+	m.events.lock.RLock()
+	defer m.events.lock.RUnlock()
+	history, exists := m.events.history[name]
+	if exists == false {
+		m.logger.Errorf("Can not fetch unregistered event history: %s", name)
+		return nil
+	}
+	return history.filter(from, to)
 }
 
 type MonitoringHttpResponse struct {
-	Error bool     `json:"error"`
-	Data  EventMap `json:"data"`
-	Time  int64    `json:"time"` // unix timestamp
+	Error   bool                `json:"error"`
+	Data    EventMap            `json:"data"`              // latest value of each event
+	History map[string][]*Event `json:"history,omitempty"` // only if requested via query parameters
+	Time    int64               `json:"time"`              // unix timestamp
+}
+
+// eventQuery are the query parameters of the monitoring endpoint:
+// event (comma separated or repeated), from and to (unix timestamps).
+// The history of events is only included if any parameter is set (use history=1 to get all values).
+type eventQuery struct {
+	names   []string
+	from    time.Time
+	to      time.Time
+	history bool
+}
+
+func parseEventQuery(req *http.Request) (*eventQuery, error) {
+	params := req.URL.Query()
+	query := &eventQuery{
+		names: make([]string, 0, 4),
+	}
+	for _, value := range params["event"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); len(name) != 0 {
+				query.names = append(query.names, name)
+			}
+		}
+	}
+
+	parseTime := func(key string) (time.Time, error) {
+		value := params.Get(key)
+		if len(value) == 0 {
+			return time.Time{}, nil
+		}
+		unix, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.New(fmt.Sprintf("invalid '%s' parameter - must be a unix timestamp", key))
+		}
+		return time.Unix(unix, 0), nil
+	}
+	var err error
+	if query.from, err = parseTime("from"); err != nil {
+		return nil, err
+	}
+	if query.to, err = parseTime("to"); err != nil {
+		return nil, err
+	}
+	if !query.from.IsZero() && !query.to.IsZero() && query.from.After(query.to) {
+		return nil, errors.New("'from' must not be after 'to'")
+	}
+
+	query.history = len(params) != 0
+	return query, nil
+}
+
+// Get the latest values and history of all events matching the query.
+func (m *HttpMonitoring) queryEvents(query *eventQuery) (EventMap, map[string][]*Event, error) {
+	m.events.lock.RLock()
+	defer m.events.lock.RUnlock()
+
+	names := query.names
+	if len(names) == 0 {
+		names = make([]string, 0, len(m.events.history))
+		for name := range m.events.history {
+			names = append(names, name)
+		}
+	}
+
+	latest := make(EventMap, len(names))
+	var history map[string][]*Event
+	if query.history {
+		history = make(map[string][]*Event, len(names))
+	}
+	for _, name := range names {
+		eventHistory, exists := m.events.history[name]
+		if exists == false {
+			return nil, nil, errors.New(fmt.Sprintf("unknown event '%s'", name))
+		}
+		latest[name] = eventHistory.latest()
+		if query.history {
+			history[name] = eventHistory.filter(query.from, query.to)
+		}
+	}
+	return latest, history, nil
 }
 
 // Respond with monitoring data to an HTTP request.
 // Only needed if you want to integrate the monitoring package into another
 // HTTP server (instead of calling HttpMonitoring.ListenHttp() ).
 func (m *HttpMonitoring) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
+	_, pattern := m.mux.Handler(req)
+	if allowed, status := m.auth.checkAccess(req, pattern); !allowed {
+		m.serveUnauthorized(writer, req, status)
+		return
+	}
+	m.mux.ServeHTTP(writer, req)
+}
+
+func (m *HttpMonitoring) serveNotFound(writer http.ResponseWriter) {
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writer.WriteHeader(http.StatusNotFound)
+	writer.Write([]byte("Not found"))
+}
+
+func (m *HttpMonitoring) serveMetrics(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" || req.URL.Path != m.config.MetricsPath {
+		m.serveNotFound(writer)
+		return
+	}
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	if _, err := m.metrics.WriteTo(writer); err != nil {
+		m.logger.Errorf("Error responding metrics: %+v", err)
+	}
+}
+
+func (m *HttpMonitoring) serveEvents(writer http.ResponseWriter, req *http.Request) {
 	if req.Method != "GET" || req.URL.Path != m.config.Path {
-		writer.WriteHeader(http.StatusNotFound)
-		writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		writer.Write([]byte("Not found"))
+		m.serveNotFound(writer)
+		return
+	}
+
+	query, err := parseEventQuery(req)
+	if err != nil {
+		m.RespondJSON(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	latest, history, err := m.queryEvents(query)
+	if err != nil {
+		m.RespondJSON(writer, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	res := MonitoringHttpResponse{
-		Error: false,
-		Data:  m.events,
-		Time:  time.Now().Unix(),
+		Error:   false,
+		Data:    latest,
+		History: history,
+		Time:    time.Now().Unix(),
 	}
 	jsonData, err := json.Marshal(res)
 	if err != nil {
@@ -141,6 +418,7 @@ func (m *HttpMonitoring) ServeHTTP(writer http.ResponseWriter, req *http.Request
 
 		res.Error = true
 		res.Data = nil // the payload most likely caused the error
+		res.History = nil
 		jsonData, err := json.Marshal(res)
 		if err != nil {
 			m.logger.Errorf("Repeating responding monitoring data - giving up: %+v", err)
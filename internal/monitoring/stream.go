@@ -0,0 +1,311 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultStreamReplay is the number of events sent to new subscribers if not configured.
+	DefaultStreamReplay = 10
+
+	// how many events to buffer per subscriber before disconnecting it as too slow
+	streamSubscriberBuffer = 64
+	// keep idle connections open through proxies
+	streamHeartbeatInterval = 30 * time.Second
+	streamWriteTimeout      = 10 * time.Second
+)
+
+// StreamEvent is a single event sent to all subscribers of a stream.
+type StreamEvent struct {
+	ID    uint64      `json:"id"`
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+	When  int64       `json:"when"` // unix timestamp
+}
+
+// StreamFilter parses the query parameters of a subscriber and returns a function
+// to check if an event's data shall be sent to this subscriber.
+type StreamFilter func(query url.Values) (func(data interface{}) bool, error)
+
+type StreamConfig struct {
+	Event         string // the name of the events, for example "whale"
+	SsePath       string // the HTTP path to serve Server-Sent Events on
+	WebSocketPath string // the HTTP path to serve WebSocket connections on
+	Replay        int    // how many of the latest events to send on connect - defaults to DefaultStreamReplay
+	Access        RouteAccess
+}
+
+// Stream publishes events live to subscribers via Server-Sent Events and WebSocket.
+// New subscribers receive the latest events first. They can limit the number of replayed events
+// with the "replay" query parameter.
+type Stream struct {
+	config  StreamConfig
+	filter  StreamFilter
+	monitor *HttpMonitoring
+
+	lock        sync.Mutex
+	nextID      uint64
+	latest      []*StreamEvent // oldest first
+	subscribers map[*streamSubscriber]struct{}
+
+	subscriberCount *Gauge
+}
+
+type streamSubscriber struct {
+	events chan *StreamEvent
+	accept func(data interface{}) bool
+}
+
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	// dashboards are served from other origins
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// NewStream creates a stream and registers its routes on the monitoring server.
+// filter can be nil to send all events to all subscribers.
+// It returns nil (which can be used safely) if monitoring is disabled.
+func (m *HttpMonitoring) NewStream(config StreamConfig, filter StreamFilter) *Stream {
+	if m == nil {
+		return nil
+	}
+	if config.Replay < 0 {
+		config.Replay = 0
+	} else if config.Replay == 0 {
+		config.Replay = DefaultStreamReplay
+	}
+	stream := &Stream{
+		config:      config,
+		filter:      filter,
+		monitor:     m,
+		nextID:      1,
+		latest:      make([]*StreamEvent, 0, config.Replay),
+		subscribers: make(map[*streamSubscriber]struct{}, 10),
+
+		subscriberCount: m.metrics.Gauge("cashwhale_stream_subscribers", "Number of connected stream subscribers.", "event", "transport"),
+	}
+	if len(config.SsePath) != 0 {
+		m.HandleRoute(config.SsePath, config.Access, stream.serveSse)
+	}
+	if len(config.WebSocketPath) != 0 {
+		m.HandleRoute(config.WebSocketPath, config.Access, stream.serveWebSocket)
+	}
+	return stream
+}
+
+// Publish sends data to all subscribers.
+func (s *Stream) Publish(data interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	event := &StreamEvent{
+		ID:    s.nextID,
+		Event: s.config.Event,
+		Data:  data,
+		When:  time.Now().Unix(),
+	}
+	s.nextID++
+	if s.config.Replay > 0 {
+		if len(s.latest) >= s.config.Replay {
+			s.latest = s.latest[1:]
+		}
+		s.latest = append(s.latest, event)
+	}
+
+	for sub := range s.subscribers {
+		if !sub.accept(data) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// the subscriber is too slow, close it to not block or buffer infinitely
+			s.monitor.logger.Warnf("Disconnecting slow %s stream subscriber", s.config.Event)
+			delete(s.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Add a new subscriber and queue the latest events for it.
+func (s *Stream) subscribe(query url.Values) (*streamSubscriber, error) {
+	sub := &streamSubscriber{
+		events: make(chan *StreamEvent, streamSubscriberBuffer),
+		accept: func(data interface{}) bool { return true },
+	}
+	if s.filter != nil {
+		accept, err := s.filter(query)
+		if err != nil {
+			return nil, err
+		}
+		sub.accept = accept
+	}
+	replay := s.config.Replay
+	if value := query.Get("replay"); len(value) != 0 {
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 {
+			return nil, errors.New("invalid 'replay' parameter - must be a positive number")
+		} else if count < replay {
+			replay = count
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	replayEvents := make([]*StreamEvent, 0, len(s.latest))
+	for _, event := range s.latest {
+		if sub.accept(event.Data) {
+			replayEvents = append(replayEvents, event)
+		}
+	}
+	if len(replayEvents) > replay {
+		replayEvents = replayEvents[len(replayEvents)-replay:]
+	}
+	for _, event := range replayEvents {
+		sub.events <- event // replay is smaller than the buffer
+	}
+	s.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+func (s *Stream) unsubscribe(sub *streamSubscriber) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, exists := s.subscribers[sub]; exists {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+func (s *Stream) serveSse(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" || req.URL.Path != s.config.SsePath {
+		s.monitor.serveNotFound(writer)
+		return
+	}
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		s.monitor.RespondJSON(writer, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	sub, err := s.subscribe(req.URL.Query())
+	if err != nil {
+		s.monitor.RespondJSON(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer s.unsubscribe(sub)
+	s.subscriberCount.Add(1, s.config.Event, "sse")
+	defer s.subscriberCount.Add(-1, s.config.Event, "sse")
+
+	writer.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.Header().Set("X-Accel-Buffering", "no") // disable nginx buffering
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				s.monitor.logger.Errorf("Error serializing %s stream event: %+v", s.config.Event, err)
+				continue
+			}
+			if _, err = fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Event, data); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-heartbeat.C:
+			if _, err := writer.Write([]byte(": ping\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Stream) serveWebSocket(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" || req.URL.Path != s.config.WebSocketPath {
+		s.monitor.serveNotFound(writer)
+		return
+	}
+	sub, err := s.subscribe(req.URL.Query())
+	if err != nil {
+		s.monitor.RespondJSON(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer s.unsubscribe(sub)
+	conn, err := streamUpgrader.Upgrade(writer, req, nil)
+	if err != nil {
+		// the upgrader already responded with an error
+		s.monitor.logger.Debugf("Error upgrading %s stream to WebSocket: %+v", s.config.Event, err)
+		return
+	}
+	defer conn.Close()
+	s.subscriberCount.Add(1, s.config.Event, "websocket")
+	defer s.subscriberCount.Add(-1, s.config.Event, "websocket")
+
+	// we don't expect messages from clients, but we must read to process control frames
+	closed := make(chan struct{})
+	conn.SetReadLimit(1024)
+	conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeatInterval))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * streamHeartbeatInterval))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(streamWriteTimeout))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+
+		case <-closed:
+			return
+
+		case <-req.Context().Done():
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down"), time.Now().Add(streamWriteTimeout))
+			return
+		}
+	}
+}
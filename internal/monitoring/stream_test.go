@@ -0,0 +1,117 @@
+package monitoring
+
+import (
+	"bufio"
+	"errors"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testStreamData struct {
+	Amount int `json:"amount"`
+}
+
+func testStreamFilter(query url.Values) (func(data interface{}) bool, error) {
+	min := 0
+	if value := query.Get("min"); len(value) != 0 {
+		var err error
+		if min, err = strconv.Atoi(value); err != nil {
+			return nil, errors.New("invalid min")
+		}
+	}
+	return func(data interface{}) bool {
+		return data.(*testStreamData).Amount >= min
+	}, nil
+}
+
+func newTestStream(t *testing.T) (*Stream, *httptest.Server) {
+	monitor := newTestMonitoring(t)
+	stream := monitor.NewStream(StreamConfig{
+		Event:         "whale",
+		SsePath:       "/stream",
+		WebSocketPath: "/ws",
+		Replay:        2,
+	}, testStreamFilter)
+	for i := 1; i <= 3; i++ {
+		stream.Publish(&testStreamData{Amount: i * 10})
+	}
+	return stream, httptest.NewServer(monitor)
+}
+
+func TestStreamSse(t *testing.T) {
+	stream, server := newTestStream(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream?min=20")
+	if err != nil {
+		t.Fatalf("Error connecting to SSE stream: %+v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("Unexpected SSE response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	stream.Publish(&testStreamData{Amount: 5}) // filtered
+	stream.Publish(&testStreamData{Amount: 40})
+	reader := bufio.NewReader(resp.Body)
+	expected := []string{
+		"id: 2", "event: whale", `data: {"amount":20}`, "",
+		"id: 3", "event: whale", `data: {"amount":30}`, "",
+		"id: 5", "event: whale", `data: {"amount":40}`, "",
+	}
+	for _, want := range expected {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Error reading SSE stream: %+v", err)
+		}
+		if line = strings.TrimRight(line, "\n"); line != want {
+			t.Fatalf("Expected SSE line %q, got %q", want, line)
+		}
+	}
+
+	invalid, err := http.Get(server.URL + "/stream?replay=-1")
+	if err != nil {
+		t.Fatalf("Error connecting to SSE stream: %+v", err)
+	}
+	invalid.Body.Close()
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected bad request for invalid replay, got %d", invalid.StatusCode)
+	}
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	stream, server := newTestStream(t)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?replay=1", nil)
+	if err != nil {
+		t.Fatalf("Error connecting to WebSocket stream: %+v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var event struct {
+		ID   uint64         `json:"id"`
+		Data testStreamData `json:"data"`
+	}
+	if err = conn.ReadJSON(&event); err != nil || event.ID != 3 || event.Data.Amount != 30 {
+		t.Fatalf("Expected only the latest event to be replayed, got %+v %v", event, err)
+	}
+
+	stream.Publish(&testStreamData{Amount: 50})
+	if err = conn.ReadJSON(&event); err != nil || event.ID != 4 || event.Data.Amount != 50 {
+		t.Fatalf("Unexpected live event: %+v %v", event, err)
+	}
+}
+
+func TestStreamNil(t *testing.T) {
+	var monitor *HttpMonitoring
+	stream := monitor.NewStream(StreamConfig{Event: "whale"}, nil)
+	stream.Publish(&testStreamData{Amount: 10}) // must not panic
+}
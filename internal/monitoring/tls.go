@@ -0,0 +1,71 @@
+package monitoring
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/pkg/errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// certificateLoader keeps the current TLS certificate and reloads it from disk,
+// for example after it was renewed by certbot.
+type certificateLoader struct {
+	certFile string
+	keyFile  string
+
+	lock sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertificateLoader(certFile string, keyFile string) (*certificateLoader, error) {
+	loader := &certificateLoader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := loader.reload(); err != nil {
+		return nil, err
+	}
+	return loader, nil
+}
+
+// Reload the certificate from disk. The previous certificate is kept on error.
+func (l *certificateLoader) reload() error {
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "error loading TLS certificate")
+	}
+	l.lock.Lock()
+	l.cert = &cert
+	l.lock.Unlock()
+	return nil
+}
+
+func (l *certificateLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.cert, nil
+}
+
+// Reload the certificate on SIGHUP until ctx is done.
+// This call is blocking.
+func (m *HttpMonitoring) reloadCertificateOnSignal(ctx context.Context, loader *certificateLoader) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+	for {
+		select {
+		case <-c:
+			if err := loader.reload(); err != nil {
+				m.logger.Errorf("Error reloading TLS certificate, keeping the previous one: %+v", err)
+				continue
+			}
+			m.logger.Infof("Reloaded TLS certificate from %s", loader.certFile)
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
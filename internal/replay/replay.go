@@ -0,0 +1,186 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/backfill"
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"github.com/Ekliptor/cashwhale/internal/social"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ReplayBlock is a recorded block. Fixture files contain one JSON encoded block per line.
+type ReplayBlock struct {
+	Height uint32        `json:"height"`
+	Time   time.Time     `json:"time"` // when the block was mined
+	Block  *parser.Block `json:"block"`
+}
+
+// Alert is a whale that would have been published.
+type Alert struct {
+	TxID        string  `json:"txid"`
+	BlockHeight uint32  `json:"block_height"`
+	AmountBch   float64 `json:"amount_bch"`
+	Rule        string  `json:"rule"`
+	Message     string  `json:"message"`
+}
+
+// LoadFixture reads all blocks of a fixture file.
+func LoadFixture(path string) ([]*ReplayBlock, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening fixture file")
+	}
+	defer file.Close()
+
+	blocks := make([]*ReplayBlock, 0, 10)
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		block := &ReplayBlock{}
+		if err = decoder.Decode(block); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "error decoding block %d of fixture file", len(blocks)+1)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// SaveFixture writes blocks to a fixture file to replay them later without a node.
+func SaveFixture(path string, blocks []*ReplayBlock) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "error creating fixture file")
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, block := range blocks {
+		if err = encoder.Encode(block); err != nil {
+			return errors.Wrapf(err, "error encoding block %d", block.Height)
+		}
+	}
+	return nil
+}
+
+// FetchBlocks gets all blocks of a height range (inclusive) from the node.
+// All blocks are kept in memory, so this is meant for short ranges.
+func FetchBlocks(source backfill.BlockSource, from uint32, to uint32) ([]*ReplayBlock, error) {
+	best := source.GetBestBlockHeight()
+	if to == 0 {
+		to = best
+	}
+	if to < from || to > best {
+		return nil, errors.Errorf("invalid block range %d to %d (best block %d)", from, to, best)
+	}
+	blocks := make([]*ReplayBlock, 0, to-from+1)
+	for height := from; height <= to; height++ {
+		block, err := source.GetBlock(height)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting block %d", height)
+		}
+		blocks = append(blocks, &ReplayBlock{
+			Height: height,
+			Time:   backfill.BlockTime(block, height, best),
+			Block:  block,
+		})
+	}
+	return blocks, nil
+}
+
+// Replay checks all blocks in order. Block times are shifted so that the last block
+// happened now, this way old fixtures fill the average window of TxCounter the same way.
+func Replay(blocks []*ReplayBlock, checker backfill.BlockChecker) {
+	if len(blocks) == 0 {
+		return
+	}
+	shift := time.Since(blocks[len(blocks)-1].Time)
+	for _, block := range blocks {
+		checker.CheckBlockAt(block.Block, block.Time.Add(shift))
+	}
+}
+
+// NewAlerts returns the alerts of all TX published by the dry run publisher.
+func NewAlerts(published []*social.TransactionData) []*Alert {
+	alerts := make([]*Alert, 0, len(published))
+	for _, tx := range published {
+		alerts = append(alerts, &Alert{
+			TxID:        tx.Hash,
+			BlockHeight: tx.BlockHeight,
+			AmountBch:   tx.AmountRaw.BCH(),
+			Rule:        tx.Rule,
+			Message:     tx.Message,
+		})
+	}
+	return alerts
+}
+
+// Comparison are the differences between the alerts of two configs.
+type Comparison struct {
+	OnlyA   []*Alert       `json:"only_a"`
+	OnlyB   []*Alert       `json:"only_b"`
+	Changed []*AlertChange `json:"changed"` // same TX with a different rule or message
+	Same    int            `json:"same"`
+}
+
+type AlertChange struct {
+	A *Alert `json:"a"`
+	B *Alert `json:"b"`
+}
+
+// Compare returns the differences between the alerts of config A and B.
+func Compare(a []*Alert, b []*Alert) *Comparison {
+	comparison := &Comparison{
+		OnlyA:   make([]*Alert, 0, 5),
+		OnlyB:   make([]*Alert, 0, 5),
+		Changed: make([]*AlertChange, 0, 5),
+	}
+	alertsB := make(map[string]*Alert, len(b))
+	for _, alert := range b {
+		alertsB[alert.TxID] = alert
+	}
+	for _, alertA := range a {
+		alertB, ok := alertsB[alertA.TxID]
+		if !ok {
+			comparison.OnlyA = append(comparison.OnlyA, alertA)
+			continue
+		}
+		delete(alertsB, alertA.TxID)
+		if alertA.Rule != alertB.Rule || alertA.Message != alertB.Message {
+			comparison.Changed = append(comparison.Changed, &AlertChange{A: alertA, B: alertB})
+		} else {
+			comparison.Same++
+		}
+	}
+	for _, alert := range b { // keep the order of B
+		if _, ok := alertsB[alert.TxID]; ok {
+			comparison.OnlyB = append(comparison.OnlyB, alert)
+		}
+	}
+	return comparison
+}
+
+// Write prints the comparison similar to a diff: "-" only in A, "+" only in B, "~" changed.
+func (c *Comparison) Write(writer io.Writer) {
+	fmt.Fprintf(writer, "=== %d alerts unchanged, %d only in A, %d only in B, %d changed\n", c.Same, len(c.OnlyA), len(c.OnlyB), len(c.Changed))
+	for _, alert := range c.OnlyA {
+		fmt.Fprintf(writer, "- block %d, TX %s, %.8f BCH, rule %s\n", alert.BlockHeight, alert.TxID, alert.AmountBch, alert.Rule)
+	}
+	for _, alert := range c.OnlyB {
+		fmt.Fprintf(writer, "+ block %d, TX %s, %.8f BCH, rule %s\n", alert.BlockHeight, alert.TxID, alert.AmountBch, alert.Rule)
+	}
+	for _, change := range c.Changed {
+		fmt.Fprintf(writer, "~ block %d, TX %s, %.8f BCH\n", change.A.BlockHeight, change.A.TxID, change.A.AmountBch)
+		if change.A.Rule != change.B.Rule {
+			fmt.Fprintf(writer, "  rule: %s -> %s\n", change.A.Rule, change.B.Rule)
+		}
+		if change.A.Message != change.B.Message {
+			fmt.Fprintf(writer, "  A: %q\n  B: %q\n", change.A.Message, change.B.Message)
+		}
+	}
+}
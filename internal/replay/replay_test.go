@@ -0,0 +1,72 @@
+package replay
+
+import (
+	"bytes"
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testChecker struct {
+	when []time.Time
+}
+
+func (c *testChecker) CheckBlockAt(block *parser.Block, when time.Time) {
+	c.when = append(c.when, when)
+}
+
+func TestFixture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.json")
+	mined := time.Now().Add(-30 * 24 * time.Hour)
+	blocks := []*ReplayBlock{
+		{Height: 100, Time: mined, Block: &parser.Block{Tx: []*parser.Transaction{{Hash: "a"}}}},
+		{Height: 101, Time: mined.Add(10 * time.Minute), Block: &parser.Block{}},
+	}
+	if err := SaveFixture(path, blocks); err != nil {
+		t.Fatalf("Error saving fixture: %+v", err)
+	}
+	loaded, err := LoadFixture(path)
+	if err != nil {
+		t.Fatalf("Error loading fixture: %+v", err)
+	}
+	if len(loaded) != 2 || loaded[0].Height != 100 || len(loaded[0].Block.Tx) != 1 || loaded[0].Block.Tx[0].Hash != "a" {
+		t.Fatalf("Unexpected fixture blocks: %+v", loaded)
+	}
+
+	// the last block is replayed as if it was mined now
+	checker := &testChecker{}
+	Replay(loaded, checker)
+	if len(checker.when) != 2 || time.Since(checker.when[1]) > time.Minute || checker.when[1].Sub(checker.when[0]) != 10*time.Minute {
+		t.Errorf("Unexpected replay times: %v", checker.when)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	a := []*Alert{
+		{TxID: "same", Rule: "threshold", Message: "1,000 BCH"},
+		{TxID: "removed", Rule: "upper_percent"},
+		{TxID: "changed", Rule: "threshold", Message: "old"},
+	}
+	b := []*Alert{
+		{TxID: "added", Rule: "threshold"},
+		{TxID: "changed", Rule: "threshold", Message: "new"},
+		{TxID: "same", Rule: "threshold", Message: "1,000 BCH"},
+	}
+	comparison := Compare(a, b)
+	if comparison.Same != 1 || len(comparison.OnlyA) != 1 || len(comparison.OnlyB) != 1 || len(comparison.Changed) != 1 {
+		t.Fatalf("Unexpected comparison: %+v", comparison)
+	}
+	if comparison.OnlyA[0].TxID != "removed" || comparison.OnlyB[0].TxID != "added" || comparison.Changed[0].B.Message != "new" {
+		t.Errorf("Unexpected comparison: %+v", comparison)
+	}
+
+	var out bytes.Buffer
+	comparison.Write(&out)
+	for _, expected := range []string{"- block 0, TX removed", "+ block 0, TX added", "~ block 0, TX changed", `B: "new"`} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in comparison output:\n%s", expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package social
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ensure we always implement Publisher (compile error otherwise)
+var _ Publisher = (*DryRunPublisher)(nil)
+
+// DryRunPublisher prints messages instead of posting them. Use it to test templates and thresholds.
+type DryRunPublisher struct {
+	writer io.Writer
+
+	lock      sync.Mutex
+	published []*TransactionData
+}
+
+func NewDryRunPublisher(writer io.Writer) *DryRunPublisher {
+	return &DryRunPublisher{
+		writer:    writer,
+		published: make([]*TransactionData, 0, 10),
+	}
+}
+
+func (p *DryRunPublisher) Name() string {
+	return "dryrun"
+}
+
+func (p *DryRunPublisher) Publish(tx *TransactionData) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	txCopy := *tx
+	p.published = append(p.published, &txCopy)
+	_, err := fmt.Fprintf(p.writer, "--- block %d, TX %s, rule %s\n%s\n\n", tx.BlockHeight, tx.Hash, tx.Rule, tx.Message)
+	return err
+}
+
+// GetPublished returns all TX that would have been published.
+func (p *DryRunPublisher) GetPublished() []*TransactionData {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	published := make([]*TransactionData, len(p.published))
+	copy(published, p.published)
+	return published
+}
@@ -2,85 +2,276 @@ package social
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/bch/network"
 	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
 	"github.com/Ekliptor/cashwhale/pkg/price"
-	"github.com/spf13/viper"
+	"github.com/pkg/errors"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
+	"reflect"
+	"strings"
+	"sync"
 	"text/template"
+	"time"
 )
 
+// how many sent TX to keep to re-send them via admin API
+const maxRecentTransactions = 1000
+
+// how many suppressed TX to keep, suppressing more removes the oldest ones
+const maxSuppressedTransactions = 1000
+
+// ErrTransactionSuppressed is returned by SendMessage if publishing the TX was suppressed via admin API.
+var ErrTransactionSuppressed = errors.New("publishing this transaction is suppressed")
+
 type MessageBuilder struct {
-	logger  log.Logger
-	twitter *TwitterClient
+	ctx          context.Context
+	logger       log.Logger
+	baseLogger   log.Logger // for publishers
+	monitor      *monitoring.HttpMonitoring
+	price        *priceOracle
+	stream       *monitoring.Stream
+	fiatCurrency string
+	network      *network.Network
 	// TODO add memo and more
+
+	lock             sync.Mutex
+	publishers       []*publisherState
+	publishersConfig PublishersConfig
+	stopPublishers   context.CancelFunc // stops the background tasks of the configured publishers
+	text             *template.Template
+	blockExplorer    string
+	recent           map[string]*TransactionData          // txid -> TX
+	recentOrder      []string                             // txids in the order they were sent to remove old ones
+	recentStatus     map[string]map[string]*PublishStatus // txid -> last publish status per publisher of recent TX
+	suppressed       map[string]bool
+	suppressedOrder  []string // txids in the order they were suppressed to remove old ones
+	recorder         WhaleRecorder
+
+	publishCount *monitoring.Counter
+}
+
+type MessageBuilderConfig struct {
+	Text                string // text/template with TransactionData
+	BlockExplorer       string // URL with %s for the TX hash
+	FiatCurrency        string // must have a URL in PriceAPI
+	Network             string // the BCH network for hashtags in messages, defaults to mainnet
+	PriceAPI            price.PriceAPIConfig
+	PriceUpdateInterval time.Duration // defaults to 5min
+	StreamReplay        int           // number of recent whales sent to new stream subscribers
+	Publishers          PublishersConfig
 }
 
-func NewMessageBuilder(logger log.Logger) *MessageBuilder {
+func NewMessageBuilder(ctx context.Context, config MessageBuilderConfig, logger log.Logger, monitor *monitoring.HttpMonitoring) (*MessageBuilder, error) {
+	chain, err := network.Get(config.Network)
+	if err != nil {
+		return nil, err
+	}
+	metrics := monitor.Metrics()
 	builder := &MessageBuilder{
+		ctx: ctx,
 		logger: logger.WithFields(
 			log.Fields{
 				"module": "message",
 			},
 		),
+		baseLogger:      logger,
+		monitor:         monitor,
+		fiatCurrency:    config.FiatCurrency,
+		network:         chain,
+		publishers:      make([]*publisherState, 0, 2),
+		recent:          make(map[string]*TransactionData, maxRecentTransactions),
+		recentOrder:     make([]string, 0, maxRecentTransactions),
+		recentStatus:    make(map[string]map[string]*PublishStatus, maxRecentTransactions),
+		suppressed:      make(map[string]bool, 10),
+		suppressedOrder: make([]string, 0, 10),
+
+		publishCount: metrics.Counter("cashwhale_publish_total", "Number of whale messages published.", "publisher", "result"),
+	}
+	builder.stream = newWhaleStream(monitor, config.StreamReplay)
+	builder.price = newPriceOracle(price.NewPriceAPI(config.PriceAPI), config.FiatCurrency, config.PriceUpdateInterval, builder.logger, monitor)
+	go builder.price.ScheduleUpdate(ctx)
+
+	if err = builder.SetTemplate(config.Text, config.BlockExplorer); err != nil {
+		return nil, err
+	} else if err = builder.SetPublishers(config.Publishers); err != nil {
+		return nil, err
+	}
+	return builder, nil
+}
+
+// AddPublisher adds another publisher to send messages to.
+func (m *MessageBuilder) AddPublisher(publisher Publisher) {
+	state := &publisherState{
+		publisher: publisher,
+	}
+	m.lock.Lock()
+	m.publishers = append(m.publishers, state)
+	m.lock.Unlock()
+	m.monitor.AddHealthCheck("publisher_"+publisher.Name(), monitoring.PROBE_READINESS, state.checkHealth)
+}
+
+// PublishersConfig are the publishers created from the config.
+type PublishersConfig struct {
+	TwitterEnable  bool
+	Twitter        TwitterClientConfig
+	TelegramEnable bool
+	Telegram       TelegramPublisherConfig
+}
+
+// SetPublishers replaces the publishers created from the config. Publishers added with AddPublisher are kept,
+// publishers with the same name stay paused. If a publisher can't be created the previous publishers keep running.
+func (m *MessageBuilder) SetPublishers(config PublishersConfig) error {
+	m.lock.Lock()
+	unchanged := m.stopPublishers != nil && reflect.DeepEqual(m.publishersConfig, config)
+	m.lock.Unlock()
+	if unchanged {
+		return nil // keep the state of running publishers, such as the Telegram daily summary
+	}
+
+	created := make([]Publisher, 0, 2)
+	if config.TwitterEnable {
+		created = append(created, NewTwitterClient(config.Twitter, m.baseLogger))
+	}
+	var telegram *TelegramPublisher
+	if config.TelegramEnable {
+		var err error
+		telegram, err = NewTelegramPublisher(config.Telegram, m.baseLogger)
+		if err != nil {
+			return err
+		}
+		created = append(created, telegram)
 	}
-	if viper.GetBool("Twitter.Enable") {
-		builder.twitter = NewTwitterClient(logger)
+
+	m.lock.Lock()
+	paused := make(map[string]bool, len(m.publishers))
+	publishers := make([]*publisherState, 0, len(m.publishers)+len(created))
+	for _, state := range m.publishers {
+		if state.configured {
+			paused[state.publisher.Name()] = state.isPaused()
+			m.monitor.RemoveHealthCheck("publisher_" + state.publisher.Name())
+			continue
+		}
+		publishers = append(publishers, state)
+	}
+	for _, publisher := range created {
+		state := &publisherState{
+			publisher:  publisher,
+			configured: true,
+			paused:     paused[publisher.Name()],
+		}
+		publishers = append(publishers, state)
+		m.monitor.AddHealthCheck("publisher_"+publisher.Name(), monitoring.PROBE_READINESS, state.checkHealth)
+	}
+	stopPrevious := m.stopPublishers
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.publishers = publishers
+	m.publishersConfig = config
+	m.stopPublishers = cancel
+	m.lock.Unlock()
+
+	if stopPrevious != nil {
+		stopPrevious()
+	}
+	if telegram != nil {
+		go telegram.ScheduleDailySummary(ctx)
 	}
-	return builder
+	return nil
+}
+
+// SetTemplate changes the text/template of messages and the block explorer URL (with %s for the TX hash).
+func (m *MessageBuilder) SetTemplate(text string, blockExplorer string) error {
+	tmpl, err := template.New("message").Funcs(price.TemplateFuncs).Parse(text)
+	if err != nil {
+		return errors.Wrap(err, "error parsing message template")
+	} else if !strings.Contains(blockExplorer, "%s") {
+		return errors.Errorf("block explorer URL must contain %%s for the TX hash: %s", blockExplorer)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.text = tmpl
+	m.blockExplorer = blockExplorer
+	return nil
+}
+
+func (m *MessageBuilder) getPublishers() []*publisherState {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.publishers
 }
 
 type TransactionData struct {
 	//RawTXs []*pb.Transaction_Output `json:"txs"`
-	AmountBchRaw float64 `json:"amount_bch_raw"`
-
-	Amount     string  `json:"amount"`
-	Symbol     string  `json:"symbol"`
-	Currency   string  `json:"currency"`
-	FeeBch     float64 `json:"fee"`
-	FiatFee    string  `json:"fee"`
-	FiatAmount string  `json:"fiat_amount"`
-	FiatSymbol string  `json:"fiat_symbol"`
-	Hash       string  `json:"hash"`
-	TxLink     string  `json:"tx_link"`
+	AmountRaw price.Amount `json:"amount_raw"` // satoshis
+
+	Amount        string       `json:"amount"`
+	Symbol        string       `json:"symbol"`
+	Currency      string       `json:"currency"`
+	Network       string       `json:"network"`
+	FeeRaw        price.Amount `json:"fee_raw"` // satoshis
+	FiatFee       string       `json:"fiat_fee"`
+	FiatAmount    string       `json:"fiat_amount"`
+	FiatAmountRaw float64      `json:"fiat_amount_raw"`
+	FiatSymbol    string       `json:"fiat_symbol"`
+	Hash          string       `json:"hash"`
+	TxLink        string       `json:"tx_link"`
+
+	Confirmed   bool      `json:"confirmed"`
+	BlockHeight uint32    `json:"block_height"`
+	Detected    time.Time `json:"detected"`         // when the TX was seen, the block time when backfilling or replaying
+	Rule        string    `json:"rule"`             // the name of the rule that identified this whale
+	TxType      string    `json:"tx_type"`          // the type of the TX, for example "consolidation"
+	Labels      []string  `json:"labels"`           // tags describing this TX, for example "confirmed"
+	Pool        string    `json:"pool,omitempty"`   // the mining pool of coinbase TX and miner payouts
+	Notice      bool      `json:"notice,omitempty"` // not a whale, for example a mined block (see SendNotice)
 
 	Message string `json:"message"`
 }
 
 // Prepares a social media message from RawTXs.
 func (m *MessageBuilder) CreateMessage(tx *TransactionData) error {
+	return m.CreateMessageWith(tx, nil)
+}
+
+// CreateMessageWith prepares the message with another text/template than the whale message.
+// nil uses the whale message template.
+func (m *MessageBuilder) CreateMessageWith(tx *TransactionData, tmpl *template.Template) error {
 	// TODO crawl rich list addresses and name them in tweets: https://bitinfocharts.com/top-100-richest-bitcoin%20cash-addresses.html
 
-	// get current price // TODO cache?
-	price, err := price.GetBitcoinCashRate(viper.GetString("Message.FiatCurrency"))
+	// get current price
+	rate, err := m.price.GetRate()
 	if err != nil {
-		m.logger.Errorf("Error getting BCH rate %+v", err)
 		return err
 	}
 
 	// fill template vars
 	pr := message.NewPrinter(language.English)
-	tx.Amount = pr.Sprintf("%.0f", tx.AmountBchRaw)
-	tx.Symbol = "BCH" // TODO add SLP support
-	tx.Currency = "BitcoinCash"
-	tx.FiatAmount = pr.Sprintf("%.0f", tx.AmountBchRaw*float64(price))
+	tx.Amount = pr.Sprintf("%.0f", tx.AmountRaw.BCH())
+	tx.Symbol = m.network.Symbol // TODO add SLP support
+	tx.Currency = m.network.Currency
+	tx.Network = m.network.Name
+	tx.FiatAmountRaw = tx.AmountRaw.Fiat(rate)
+	tx.FiatAmount = pr.Sprintf("%.0f", tx.FiatAmountRaw)
 
-	fiatFee := tx.FeeBch * float64(price)
+	fiatFee := tx.FeeRaw.Fiat(rate)
 	if fiatFee < 0.0001 {
 		fiatFee = 0.0001
 	}
 	tx.FiatFee = pr.Sprintf("%.4f", fiatFee)
 
-	tx.FiatSymbol = viper.GetString("Message.FiatCurrency")
-	tx.TxLink = fmt.Sprintf(viper.GetString("Message.BlockExplorer"), tx.Hash)
+	m.lock.Lock()
+	if tmpl == nil {
+		tmpl = m.text
+	}
+	blockExplorer := m.blockExplorer
+	m.lock.Unlock()
+	tx.FiatSymbol = m.fiatCurrency
+	tx.TxLink = fmt.Sprintf(blockExplorer, tx.Hash)
 
 	// create message
-	tmpl, err := template.New("message").Parse(viper.GetString("Message.Text"))
-	if err != nil {
-		m.logger.Errorf("Error creating message from template %s %+v", viper.GetString("Message.Text"), err)
-		return err
-	}
 	var data bytes.Buffer
 	err = tmpl.Execute(&data, tx)
 	if err != nil {
@@ -92,15 +283,226 @@ func (m *MessageBuilder) CreateMessage(tx *TransactionData) error {
 	return nil
 }
 
-// Sends message. Call this after CreateMessage().
+// Sends message to all publishers. Call this after CreateMessage().
+// The confirmation of a TX sent unconfirmed is only sent to publishers that edit their message (ConfirmationEditor).
+// Returns an error if no publisher succeeded.
 func (m *MessageBuilder) SendMessage(tx *TransactionData) error {
-	if viper.GetBool("Twitter.Enable") {
-		_, err := m.twitter.SendTweet(tx.Message)
+	m.lock.Lock()
+	suppressed := m.suppressed[tx.Hash]
+	publishers := m.publishers
+	previous, exists := m.recent[tx.Hash]
+	confirmation := exists && !previous.Confirmed && tx.Confirmed
+	previousStatus := m.recentStatus[tx.Hash]
+	m.lock.Unlock()
+	m.rememberTransaction(tx) // suppressed TX can be re-sent too
+	if suppressed {
+		status := make(map[string]*PublishStatus, len(publishers))
+		for _, state := range publishers {
+			status[state.publisher.Name()] = &PublishStatus{Status: PUBLISH_STATUS_SUPPRESSED, When: time.Now()}
+		}
+		m.setPublishStatus(tx.Hash, status)
+		m.recordWhale(tx, status)
+		return ErrTransactionSuppressed
+	}
+
+	if confirmation {
+		publishers = confirmationEditors(publishers)
+	}
+	status, err := m.publish(tx, publishers)
+	if confirmation {
+		for name, publishStatus := range previousStatus {
+			if _, ok := status[name]; !ok {
+				status[name] = publishStatus // keep the status of the unconfirmed TX
+			}
+		}
+	}
+	m.setPublishStatus(tx.Hash, status)
+	m.recordWhale(tx, status)
+	return err
+}
+
+// Returns the publishers that edit their message of an unconfirmed TX on confirmation.
+func confirmationEditors(publishers []*publisherState) []*publisherState {
+	editors := make([]*publisherState, 0, len(publishers))
+	for _, state := range publishers {
+		if _, ok := state.publisher.(ConfirmationEditor); ok {
+			editors = append(editors, state)
+		}
+	}
+	return editors
+}
+
+// SendNotice sends a message that is not a whale (for example a mined block) to all publishers.
+// Notices are not streamed, recorded in the whale database or resent. Call this after CreateMessageWith().
+func (m *MessageBuilder) SendNotice(tx *TransactionData) error {
+	tx.Notice = true
+	_, err := m.publish(tx, m.getPublishers())
+	return err
+}
+
+// Publishes the TX on all publishers that are not paused and returns the status per publisher.
+// Returns an error if no publisher succeeded.
+func (m *MessageBuilder) publish(tx *TransactionData, publishers []*publisherState) (map[string]*PublishStatus, error) {
+	status := make(map[string]*PublishStatus, len(publishers))
+	var lastErr error
+	sent := 0
+	for _, state := range publishers {
+		name := state.publisher.Name()
+		if state.isPaused() {
+			m.logger.Debugf("Skipped publishing TX %s on paused %s", tx.Hash, name)
+			status[name] = &PublishStatus{Status: PUBLISH_STATUS_PAUSED, When: time.Now()}
+			continue
+		}
+		err := state.publisher.Publish(tx)
+		state.setResult(err)
 		if err != nil {
-			//m.logger.Errorf("Error tweeting %+v", err)
-			return err
+			m.publishCount.Inc(name, "failure")
+			m.logger.Errorf("Error publishing message on %s %+v", name, err)
+			status[name] = &PublishStatus{Status: PUBLISH_STATUS_FAILED, Error: err.Error(), When: time.Now()}
+			lastErr = errors.Wrap(err, fmt.Sprintf("error publishing on %s", name))
+			continue
 		}
+		m.publishCount.Inc(name, "success")
+		status[name] = &PublishStatus{Status: PUBLISH_STATUS_PUBLISHED, When: time.Now()}
+		sent++
+	}
+	if sent == 0 && lastErr != nil {
+		return status, lastErr
 	}
 
-	return nil
+	return status, nil
+}
+
+// SetPublisherPaused pauses or resumes publishing messages on the publisher with this name.
+func (m *MessageBuilder) SetPublisherPaused(name string, paused bool) error {
+	for _, state := range m.getPublishers() {
+		if state.publisher.Name() == name {
+			state.setPaused(paused)
+			return nil
+		}
+	}
+	return errors.Errorf("unknown publisher %s", name)
+}
+
+// ResendTransaction publishes a recently sent (or suppressed) TX again and removes its suppression.
+func (m *MessageBuilder) ResendTransaction(txHash string) error {
+	m.lock.Lock()
+	tx, exists := m.recent[txHash]
+	if exists && m.suppressed[txHash] {
+		delete(m.suppressed, txHash)
+		for i, hash := range m.suppressedOrder {
+			if hash == txHash {
+				m.suppressedOrder = append(m.suppressedOrder[:i], m.suppressedOrder[i+1:]...)
+				break
+			}
+		}
+	}
+	m.lock.Unlock()
+	if !exists {
+		return errors.Errorf("TX %s was not published recently", txHash)
+	}
+	return m.SendMessage(tx)
+}
+
+// SuppressTransaction prevents a TX from being published (for example when it gets confirmed).
+func (m *MessageBuilder) SuppressTransaction(txHash string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.suppressed[txHash] {
+		return
+	}
+	if len(m.suppressedOrder) >= maxSuppressedTransactions {
+		delete(m.suppressed, m.suppressedOrder[0])
+		m.suppressedOrder = m.suppressedOrder[1:]
+	}
+	m.suppressed[txHash] = true
+	m.suppressedOrder = append(m.suppressedOrder, txHash)
+}
+
+func (m *MessageBuilder) rememberTransaction(tx *TransactionData) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, exists := m.recent[tx.Hash]; !exists {
+		if len(m.recentOrder) >= maxRecentTransactions {
+			delete(m.recent, m.recentOrder[0])
+			delete(m.recentStatus, m.recentOrder[0])
+			m.recentOrder = m.recentOrder[1:]
+		}
+		m.recentOrder = append(m.recentOrder, tx.Hash)
+	}
+	m.recent[tx.Hash] = tx
+}
+
+// Keeps the publish status of a recent TX for the outbox.
+func (m *MessageBuilder) setPublishStatus(txHash string, status map[string]*PublishStatus) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, exists := m.recent[txHash]; exists {
+		m.recentStatus[txHash] = status
+	}
+}
+
+// OutboxEntry is a recent whale that is not published on all publishers yet.
+type OutboxEntry struct {
+	Hash      string                    `json:"hash"`
+	AmountBch float64                   `json:"amount_bch"`
+	Rule      string                    `json:"rule"`
+	Status    map[string]*PublishStatus `json:"status"` // per publisher
+}
+
+// Outbox returns the recent whales that failed or were paused on at least 1 publisher, oldest first.
+// They can be re-sent via admin API and are removed once they are published on all publishers or suppressed.
+func (m *MessageBuilder) Outbox() []*OutboxEntry {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	outbox := make([]*OutboxEntry, 0, 10)
+	for _, txHash := range m.recentOrder {
+		if m.suppressed[txHash] {
+			continue
+		}
+		status := m.recentStatus[txHash]
+		for _, publisherStatus := range status {
+			if publisherStatus.Status != PUBLISH_STATUS_FAILED && publisherStatus.Status != PUBLISH_STATUS_PAUSED {
+				continue
+			}
+			tx := m.recent[txHash]
+			outbox = append(outbox, &OutboxEntry{
+				Hash:      tx.Hash,
+				AmountBch: tx.AmountRaw.BCH(),
+				Rule:      tx.Rule,
+				Status:    status,
+			})
+			break
+		}
+	}
+	return outbox
+}
+
+// SetRecorder sets the store to persist all whales in.
+func (m *MessageBuilder) SetRecorder(recorder WhaleRecorder) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.recorder = recorder
+}
+
+// SetFixedRate uses this BCH price for all messages instead of the price API.
+func (m *MessageBuilder) SetFixedRate(rate float32) {
+	m.price.setFixedRate(rate)
+}
+
+// RecordTransaction stores the TX in the whale database without publishing it.
+func (m *MessageBuilder) RecordTransaction(tx *TransactionData) {
+	m.recordWhale(tx, make(map[string]*PublishStatus))
+}
+
+func (m *MessageBuilder) recordWhale(tx *TransactionData, status map[string]*PublishStatus) {
+	m.lock.Lock()
+	recorder := m.recorder
+	m.lock.Unlock()
+	if recorder == nil {
+		return
+	}
+	if err := recorder.RecordWhale(tx, status); err != nil {
+		m.logger.Errorf("Error recording whale TX %s: %+v", tx.Hash, err)
+	}
 }
@@ -0,0 +1,238 @@
+package social
+
+import (
+	"context"
+	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/bch/network"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"testing"
+)
+
+type testPublisher struct {
+	published []string
+}
+
+func (p *testPublisher) Name() string {
+	return "test"
+}
+
+func (p *testPublisher) Publish(tx *TransactionData) error {
+	p.published = append(p.published, tx.Hash)
+	return nil
+}
+
+func newTestMessageBuilder(t *testing.T) (*MessageBuilder, *testPublisher) {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	chain, _ := network.Get(network.MAINNET)
+	builder := &MessageBuilder{
+		ctx:          context.Background(),
+		logger:       logger,
+		baseLogger:   logger,
+		network:      chain,
+		recent:       make(map[string]*TransactionData),
+		recentStatus: make(map[string]map[string]*PublishStatus),
+		suppressed:   make(map[string]bool),
+	}
+	publisher := &testPublisher{}
+	builder.AddPublisher(publisher)
+	return builder, publisher
+}
+
+func TestPauseAndSuppress(t *testing.T) {
+	builder, publisher := newTestMessageBuilder(t)
+
+	if err := builder.SetPublisherPaused("test", true); err != nil {
+		t.Fatalf("Error pausing publisher: %+v", err)
+	}
+	if err := builder.SetPublisherPaused("unknown", true); err == nil {
+		t.Errorf("Expected error pausing unknown publisher")
+	}
+	builder.SendMessage(&TransactionData{Hash: "abc"})
+	if len(publisher.published) != 0 {
+		t.Errorf("Paused publisher published %v", publisher.published)
+	}
+	if outbox := builder.Outbox(); len(outbox) != 1 || outbox[0].Hash != "abc" || outbox[0].Status["test"].Status != PUBLISH_STATUS_PAUSED {
+		t.Errorf("Expected paused TX in outbox, got %+v", outbox)
+	}
+
+	builder.SetPublisherPaused("test", false)
+	if err := builder.ResendTransaction("abc"); err != nil || len(publisher.published) != 1 {
+		t.Errorf("Expected TX to be re-sent: %v %v", err, publisher.published)
+	}
+	if outbox := builder.Outbox(); len(outbox) != 0 {
+		t.Errorf("Expected published TX to be removed from outbox, got %+v", outbox)
+	}
+	if err := builder.ResendTransaction("unknown"); err == nil {
+		t.Errorf("Expected error re-sending unknown TX")
+	}
+
+	builder.SuppressTransaction("def")
+	if err := builder.SendMessage(&TransactionData{Hash: "def"}); err != ErrTransactionSuppressed || len(publisher.published) != 1 {
+		t.Errorf("Expected TX to be suppressed: %v %v", err, publisher.published)
+	}
+	// suppressed TX we saw can be re-sent, unknown TX stay suppressed
+	builder.SuppressTransaction("ghi")
+	if err := builder.ResendTransaction("ghi"); err == nil || !builder.suppressed["ghi"] {
+		t.Errorf("Expected unknown TX to stay suppressed: %v", err)
+	}
+	if err := builder.ResendTransaction("def"); err != nil || len(publisher.published) != 2 || builder.suppressed["def"] {
+		t.Errorf("Expected suppressed TX to be re-sent: %v %v", err, publisher.published)
+	}
+	if len(builder.suppressedOrder) != 1 || builder.suppressedOrder[0] != "ghi" {
+		t.Errorf("Unexpected suppressed TX: %v", builder.suppressedOrder)
+	}
+
+	for i := 0; i < maxSuppressedTransactions; i++ {
+		builder.SuppressTransaction(fmt.Sprintf("tx%d", i))
+	}
+	if len(builder.suppressed) != maxSuppressedTransactions || builder.suppressed["ghi"] {
+		t.Errorf("Expected oldest suppressed TX to be removed, got %d TX", len(builder.suppressed))
+	}
+}
+
+type testEditor struct {
+	testPublisher
+}
+
+func (p *testEditor) Name() string {
+	return "editor"
+}
+
+func (p *testEditor) EditsOnConfirmation() {}
+
+func TestSendConfirmation(t *testing.T) {
+	builder, publisher := newTestMessageBuilder(t)
+	editor := &testEditor{}
+	builder.AddPublisher(editor)
+
+	builder.SendMessage(&TransactionData{Hash: "abc", Confirmed: false})
+	if len(publisher.published) != 1 || len(editor.published) != 1 {
+		t.Fatalf("Expected unconfirmed TX on all publishers, got %v %v", publisher.published, editor.published)
+	}
+	// the confirmation is only sent to publishers editing their message
+	builder.SetPublisherPaused("test", true)
+	if err := builder.SendMessage(&TransactionData{Hash: "abc", Confirmed: true}); err != nil {
+		t.Fatalf("Error sending confirmation: %+v", err)
+	}
+	if len(publisher.published) != 1 || len(editor.published) != 2 {
+		t.Errorf("Expected confirmation on the editor only, got %v %v", publisher.published, editor.published)
+	}
+	if outbox := builder.Outbox(); len(outbox) != 0 {
+		t.Errorf("Expected the status of the unconfirmed TX to be kept, got %+v", outbox)
+	}
+
+	// TX we didn't send unconfirmed are sent to all publishers
+	builder.SetPublisherPaused("test", false)
+	builder.SendMessage(&TransactionData{Hash: "def", Confirmed: true})
+	if len(publisher.published) != 2 || len(editor.published) != 3 {
+		t.Errorf("Expected confirmed TX on all publishers, got %v %v", publisher.published, editor.published)
+	}
+}
+
+type testRecorder struct {
+	status map[string]map[string]*PublishStatus
+}
+
+func (r *testRecorder) RecordWhale(tx *TransactionData, status map[string]*PublishStatus) error {
+	r.status[tx.Hash] = status
+	return nil
+}
+
+func TestRecordWhale(t *testing.T) {
+	builder, _ := newTestMessageBuilder(t)
+	recorder := &testRecorder{status: make(map[string]map[string]*PublishStatus)}
+	builder.SetRecorder(recorder)
+
+	builder.SendMessage(&TransactionData{Hash: "abc"})
+	builder.SetPublisherPaused("test", true)
+	builder.SendMessage(&TransactionData{Hash: "def"})
+	builder.SuppressTransaction("ghi")
+	builder.SendMessage(&TransactionData{Hash: "ghi"})
+
+	expected := map[string]string{
+		"abc": PUBLISH_STATUS_PUBLISHED,
+		"def": PUBLISH_STATUS_PAUSED,
+		"ghi": PUBLISH_STATUS_SUPPRESSED,
+	}
+	for hash, status := range expected {
+		if recorder.status[hash] == nil || recorder.status[hash]["test"].Status != status {
+			t.Errorf("Expected TX %s to be recorded as %s, got %+v", hash, status, recorder.status[hash])
+		}
+	}
+
+	// notices are published, but not recorded as whales
+	builder.SetPublisherPaused("test", false)
+	notice := &TransactionData{Hash: "jkl"}
+	if err := builder.SendNotice(notice); err != nil || !notice.Notice || recorder.status["jkl"] != nil {
+		t.Errorf("Expected notice to be published without recording it: %v %+v", err, recorder.status["jkl"])
+	}
+}
+
+func TestSetPublishers(t *testing.T) {
+	builder, publisher := newTestMessageBuilder(t)
+	config := PublishersConfig{
+		TelegramEnable: true,
+		Telegram: TelegramPublisherConfig{
+			Token:   "token",
+			Channel: "@whales",
+		},
+	}
+	if err := builder.SetPublishers(config); err != nil {
+		t.Fatalf("Error setting publishers: %+v", err)
+	}
+	if err := builder.SetPublisherPaused("telegram", true); err != nil {
+		t.Fatalf("Error pausing publisher: %+v", err)
+	}
+
+	config.Telegram.Channel = "@other"
+	if err := builder.SetPublishers(config); err != nil {
+		t.Fatalf("Error replacing publishers: %+v", err)
+	}
+	publishers := builder.getPublishers()
+	if len(publishers) != 2 || publishers[0].publisher != publisher || !publishers[1].isPaused() {
+		t.Errorf("Expected added publisher to be kept and Telegram to stay paused: %+v", publishers)
+	}
+
+	config.Telegram.Token = "" // invalid
+	if err := builder.SetPublishers(config); err == nil {
+		t.Errorf("Expected error creating invalid publisher")
+	}
+	config.TelegramEnable = false
+	if err := builder.SetPublishers(config); err != nil || len(builder.getPublishers()) != 1 {
+		t.Errorf("Expected Telegram to be removed: %v %+v", err, builder.getPublishers())
+	}
+}
+
+func TestSetTemplate(t *testing.T) {
+	builder, _ := newTestMessageBuilder(t)
+	if err := builder.SetTemplate("{{.Hash", "https://explorer/%s"); err == nil {
+		t.Errorf("Expected error for invalid template")
+	}
+	if err := builder.SetTemplate("{{.Hash}}", "https://explorer/"); err == nil {
+		t.Errorf("Expected error for block explorer without %%s")
+	}
+	if err := builder.SetTemplate("TX {{.Hash}}", "https://explorer/%s"); err != nil {
+		t.Fatalf("Error setting template: %+v", err)
+	}
+	builder.price = &priceOracle{fixed: true, rate: 100.0}
+	tx := &TransactionData{Hash: "abc", AmountRaw: price.NewAmount(1.0)}
+	if err := builder.CreateMessage(tx); err != nil || tx.Message != "TX abc" || tx.TxLink != "https://explorer/abc" {
+		t.Errorf("Unexpected message %q with link %s: %v", tx.Message, tx.TxLink, err)
+	}
+
+	builder.network, _ = network.Get(network.CHIPNET)
+	builder.SetTemplate("#{{.Currency}} #{{.Symbol}} on {{.Network}}", "https://explorer/%s")
+	if err := builder.CreateMessage(tx); err != nil || tx.Message != "#BitcoinCashChipnet #tBCH on chipnet" {
+		t.Errorf("Unexpected chipnet message %q: %v", tx.Message, err)
+	}
+
+	tx = &TransactionData{Hash: "abc", AmountRaw: 2500012345678, FeeRaw: 1234}
+	builder.SetTemplate("{{bch .AmountRaw}} BCH, {{mbch .AmountRaw}} mBCH, {{bits .FeeRaw}} bits, {{sats .FeeRaw}} sats, {{.FiatFee}}", "https://explorer/%s")
+	if err := builder.CreateMessage(tx); err != nil || tx.Message != "25,000.12345678 BCH, 25,000,123.45678 mBCH, 12.34 bits, 1,234 sats, 0.0012" {
+		t.Errorf("Unexpected amount message %q: %v", tx.Message, err)
+	}
+}
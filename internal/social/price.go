@@ -0,0 +1,117 @@
+package social
+
+import (
+	"context"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// Caches the BCH price and keeps it up to date so we don't have to wait for
+// the price API when sending messages.
+type priceOracle struct {
+	api            *price.PriceAPI
+	fiatCurrency   string
+	updateInterval time.Duration
+	logger         log.Logger
+	fetchLatency   *monitoring.Histogram
+
+	lock    sync.Mutex
+	rate    float32
+	updated time.Time
+	fixed   bool // never update the rate (for replays)
+}
+
+func newPriceOracle(api *price.PriceAPI, fiatCurrency string, updateInterval time.Duration, logger log.Logger, monitor *monitoring.HttpMonitoring) *priceOracle {
+	if updateInterval <= 0 {
+		updateInterval = 5 * time.Minute
+	}
+	oracle := &priceOracle{
+		api:            api,
+		fiatCurrency:   fiatCurrency,
+		updateInterval: updateInterval,
+		logger:         logger,
+		fetchLatency:   monitor.Metrics().Histogram("cashwhale_price_fetch_duration_seconds", "Latency of fetching the BCH price.", monitoring.DefaultLatencyBuckets, "result"),
+	}
+	monitor.AddHealthCheck("price", monitoring.PROBE_READINESS, oracle.checkHealth)
+	return oracle
+}
+
+// GetRate returns the cached price or fetches it if the cache expired.
+func (o *priceOracle) GetRate() (float32, error) {
+	o.lock.Lock()
+	rate, updated, fixed := o.rate, o.updated, o.fixed
+	o.lock.Unlock()
+	if fixed || time.Since(updated) < o.updateInterval {
+		return rate, nil
+	}
+	return o.update()
+}
+
+// ScheduleUpdate keeps the price up to date until ctx is done.
+// This call is blocking.
+func (o *priceOracle) ScheduleUpdate(ctx context.Context) {
+	ticker := time.NewTicker(o.updateInterval)
+	defer ticker.Stop()
+	o.update()
+	for {
+		select {
+		case <-ticker.C:
+			o.update()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (o *priceOracle) setFixedRate(rate float32) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.rate = rate
+	o.updated = time.Now()
+	o.fixed = true
+}
+
+func (o *priceOracle) update() (float32, error) {
+	o.lock.Lock()
+	fixed := o.fixed
+	o.lock.Unlock()
+	if fixed {
+		return o.GetRate()
+	}
+	start := time.Now()
+	rate, err := o.api.GetBitcoinCashRate(o.fiatCurrency)
+	if err != nil {
+		o.fetchLatency.Observe(time.Since(start).Seconds(), "failure")
+		o.logger.Errorf("Error getting BCH rate %+v", err)
+		return 0.0, err
+	}
+	o.fetchLatency.Observe(time.Since(start).Seconds(), "success")
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.fixed {
+		return o.rate, nil // fixed while we were fetching
+	}
+	o.rate = rate
+	o.updated = time.Now()
+	return rate, nil
+}
+
+func (o *priceOracle) checkHealth() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.fixed {
+		return nil
+	} else if o.updated.IsZero() {
+		return errors.New("no price received yet")
+	}
+	if since := time.Since(o.updated); since > 3*o.updateInterval {
+		return errors.Errorf("last price received %s ago", since.Round(time.Second))
+	}
+	return nil
+}
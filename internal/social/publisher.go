@@ -0,0 +1,94 @@
+package social
+
+import (
+	"github.com/pkg/errors"
+	"sync"
+	"time"
+)
+
+// Publisher posts whale messages to a social network or messenger channel.
+type Publisher interface {
+	// Name returns the unique name of this publisher such as "twitter".
+	Name() string
+
+	// Publish posts the transaction. It is called after MessageBuilder.CreateMessage().
+	Publish(tx *TransactionData) error
+}
+
+// ConfirmationEditor is a Publisher that updates its message of an unconfirmed TX when the TX is
+// published again confirmed. Confirmations of TX published unconfirmed are only sent to these
+// publishers, so other publishers don't post the same whale twice.
+type ConfirmationEditor interface {
+	Publisher
+
+	// EditsOnConfirmation marks the publisher as editing messages on confirmation.
+	EditsOnConfirmation()
+}
+
+// The publish status of a TX per publisher.
+const (
+	PUBLISH_STATUS_PUBLISHED  = "published"
+	PUBLISH_STATUS_FAILED     = "failed"
+	PUBLISH_STATUS_PAUSED     = "paused"
+	PUBLISH_STATUS_SUPPRESSED = "suppressed"
+)
+
+// PublishStatus is the result of publishing a TX on a single publisher.
+type PublishStatus struct {
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+	When   time.Time `json:"when"`
+}
+
+// WhaleRecorder persists whales together with their publish status.
+type WhaleRecorder interface {
+	RecordWhale(tx *TransactionData, status map[string]*PublishStatus) error
+}
+
+// Keeps track of the last results of a publisher for health checks.
+type publisherState struct {
+	publisher  Publisher
+	configured bool // created from PublishersConfig
+
+	lock        sync.Mutex
+	paused      bool // set via admin API
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   error
+}
+
+func (s *publisherState) setResult(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err != nil {
+		s.lastFailure = time.Now()
+		s.lastError = err
+		return
+	}
+	s.lastSuccess = time.Now()
+}
+
+func (s *publisherState) setPaused(paused bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.paused = paused
+}
+
+func (s *publisherState) isPaused() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.paused
+}
+
+func (s *publisherState) checkHealth() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.lastFailure.IsZero() || s.lastSuccess.After(s.lastFailure) {
+		return nil
+	}
+	lastSuccess := "never"
+	if !s.lastSuccess.IsZero() {
+		lastSuccess = s.lastSuccess.Format(time.RFC3339)
+	}
+	return errors.Errorf("last publish failed: %v (last success: %s)", s.lastError, lastSuccess)
+}
@@ -0,0 +1,66 @@
+package social
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"net/url"
+	"strconv"
+)
+
+const (
+	whaleStreamSsePath       = "/whales/stream"
+	whaleStreamWebSocketPath = "/whales/ws"
+)
+
+// Creates the live stream of whales on the monitoring server.
+// Subscribers can filter whales with the min_bch and min_fiat query parameters.
+// replay is the number of recent whales sent to new subscribers.
+func newWhaleStream(monitor *monitoring.HttpMonitoring, replay int) *monitoring.Stream {
+	return monitor.NewStream(monitoring.StreamConfig{
+		Event:         "whale",
+		SsePath:       whaleStreamSsePath,
+		WebSocketPath: whaleStreamWebSocketPath,
+		Replay:        replay,
+		Access:        monitoring.ROUTE_PUBLIC,
+	}, whaleStreamFilter)
+}
+
+func whaleStreamFilter(query url.Values) (func(data interface{}) bool, error) {
+	parseMin := func(key string) (float64, error) {
+		value := query.Get(key)
+		if len(value) == 0 {
+			return 0.0, nil
+		}
+		min, err := strconv.ParseFloat(value, 64)
+		if err != nil || min < 0.0 {
+			return 0.0, errors.New(fmt.Sprintf("invalid '%s' parameter - must be a positive number", key))
+		}
+		return min, nil
+	}
+	minBch, err := parseMin("min_bch")
+	if err != nil {
+		return nil, err
+	}
+	minFiat, err := parseMin("min_fiat")
+	if err != nil {
+		return nil, err
+	}
+
+	return func(data interface{}) bool {
+		tx, ok := data.(*TransactionData)
+		if !ok {
+			return false
+		}
+		return tx.AmountRaw >= price.NewAmount(minBch) && tx.FiatAmountRaw >= minFiat
+	}, nil
+}
+
+// StreamTransaction sends the TX to all live subscribers of the monitoring server.
+// Call this for every whale, even if creating the message failed.
+func (m *MessageBuilder) StreamTransaction(tx *TransactionData) {
+	// copy it so that later changes don't race with subscribers serializing it
+	txCopy := *tx
+	m.stream.Publish(&txCopy)
+}
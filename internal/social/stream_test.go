@@ -0,0 +1,26 @@
+package social
+
+import (
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"net/url"
+	"testing"
+)
+
+func TestWhaleStreamFilter(t *testing.T) {
+	accept, err := whaleStreamFilter(url.Values{"min_bch": {"20000"}, "min_fiat": {"1000000"}})
+	if err != nil {
+		t.Fatalf("Error parsing filter: %+v", err)
+	}
+	if !accept(&TransactionData{AmountRaw: price.NewAmount(25000), FiatAmountRaw: 7500000}) {
+		t.Errorf("Expected whale above both minimums to be accepted")
+	}
+	if accept(&TransactionData{AmountRaw: price.NewAmount(15000), FiatAmountRaw: 4500000}) || accept(&TransactionData{AmountRaw: price.NewAmount(25000)}) {
+		t.Errorf("Expected whale below a minimum to be filtered")
+	}
+
+	for _, query := range []url.Values{{"min_bch": {"abc"}}, {"min_fiat": {"-1"}}} {
+		if _, err = whaleStreamFilter(query); err == nil {
+			t.Errorf("Expected error for invalid query %v", query)
+		}
+	}
+}
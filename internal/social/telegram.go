@@ -0,0 +1,321 @@
+package social
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ensure we always implement Publisher (compile error otherwise)
+var _ Publisher = (*TelegramPublisher)(nil)
+var _ ConfirmationEditor = (*TelegramPublisher)(nil)
+
+const (
+	telegramDefaultApiUrl = "https://api.telegram.org"
+	telegramDefaultText   = "🐋 <b>{{.Amount}} #{{.Symbol}}</b> ({{.FiatAmount}} {{.FiatSymbol}}) transferred with {{.FiatFee}} {{.FiatSymbol}} TX fee\n\n" +
+		"{{if .Confirmed}}✅ confirmed in block {{.BlockHeight}}{{else}}⏳ unconfirmed{{end}}"
+
+	// how many message IDs of published TX to keep to edit them on confirmation
+	telegramMaxSentMessages = 1000
+)
+
+// TelegramPublisher posts whales as HTML messages to a Telegram channel.
+// Messages of unconfirmed TX are edited in place once the TX confirms.
+// Optionally a summary of all whales is posted and pinned once a day.
+type TelegramPublisher struct {
+	config TelegramPublisherConfig
+	text   *template.Template
+	client *http.Client
+	logger log.Logger
+
+	lock          sync.Mutex
+	sentMessages  map[string]int64 // txid -> message ID
+	sentOrder     []string         // txids in the order they were sent to remove old ones
+	summary       *telegramDailySummary
+	pinnedSummary int64 // message ID
+}
+
+type TelegramPublisherConfig struct {
+	Token           string // received by talking to @BotFather
+	Channel         string // channel ID or @name - the bot must be admin of the channel to pin messages
+	Text            string // html/template of the message, defaults to telegramDefaultText
+	PinDailySummary bool   // post and pin a summary of the day's whales at midnight UTC
+	Symbol          string // hashtag of the coin in the daily summary, defaults to BCH
+
+	ApiUrl  string // defaults to https://api.telegram.org
+	Timeout time.Duration
+}
+
+type telegramDailySummary struct {
+	Day     time.Time
+	Count   int
+	Total   price.Amount
+	Largest price.Amount
+}
+
+// The response of any Telegram Bot API call.
+type telegramBotResponse struct {
+	Ok          bool            `json:"ok"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+type telegramBotMessage struct {
+	MessageID int64 `json:"message_id"`
+}
+
+type telegramInlineKeyboardButton struct {
+	Text string `json:"text"`
+	Url  string `json:"url"`
+}
+
+type telegramInlineKeyboardMarkup struct {
+	InlineKeyboard [][]telegramInlineKeyboardButton `json:"inline_keyboard"`
+}
+
+func NewTelegramPublisher(config TelegramPublisherConfig, logger log.Logger) (*TelegramPublisher, error) {
+	if len(config.Token) == 0 || len(config.Channel) == 0 {
+		return nil, errors.New("Telegram token and channel must be set to publish whales on Telegram")
+	}
+	if len(config.Text) == 0 {
+		config.Text = telegramDefaultText
+	}
+	if len(config.Symbol) == 0 {
+		config.Symbol = "BCH"
+	}
+	if len(config.ApiUrl) == 0 {
+		config.ApiUrl = telegramDefaultApiUrl
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	text, err := template.New("telegram").Funcs(template.FuncMap(price.TemplateFuncs)).Parse(config.Text)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing Telegram message template")
+	}
+
+	return &TelegramPublisher{
+		config: config,
+		text:   text,
+		client: &http.Client{
+			Timeout: config.Timeout,
+		},
+		logger: logger.WithFields(
+			log.Fields{
+				"module": "telegram",
+			},
+		),
+		sentMessages: make(map[string]int64, telegramMaxSentMessages),
+		sentOrder:    make([]string, 0, telegramMaxSentMessages),
+		summary:      newTelegramDailySummary(time.Now()),
+	}, nil
+}
+
+func (t *TelegramPublisher) Name() string {
+	return "telegram"
+}
+
+// EditsOnConfirmation makes MessageBuilder send us confirmations of TX we published unconfirmed.
+func (t *TelegramPublisher) EditsOnConfirmation() {}
+
+// Publish sends the TX as a new message. If we already sent a message for this unconfirmed TX
+// and it is now confirmed, the existing message is edited instead.
+// Notices are sent with their text message and are not part of the daily summary.
+func (t *TelegramPublisher) Publish(tx *TransactionData) error {
+	var text bytes.Buffer
+	if tx.Notice {
+		text.WriteString(template.HTMLEscapeString(tx.Message))
+	} else if err := t.text.Execute(&text, tx); err != nil {
+		return errors.Wrap(err, "error executing Telegram message template")
+	}
+	params := map[string]interface{}{
+		"chat_id":                  t.config.Channel,
+		"text":                     text.String(),
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+		"reply_markup": telegramInlineKeyboardMarkup{
+			InlineKeyboard: [][]telegramInlineKeyboardButton{{
+				{Text: "View TX", Url: tx.TxLink},
+			}},
+		},
+	}
+
+	t.lock.Lock()
+	messageID, sent := t.sentMessages[tx.Hash]
+	t.lock.Unlock()
+	if sent {
+		if !tx.Confirmed {
+			return nil // nothing changed
+		}
+		params["message_id"] = messageID
+		if err := t.call("editMessageText", params, nil); err != nil {
+			return err
+		}
+		t.logger.Debugf("Edited Telegram message %d of confirmed TX %s", messageID, tx.Hash)
+		t.lock.Lock()
+		delete(t.sentMessages, tx.Hash)
+		t.lock.Unlock()
+		t.addToSummary(tx)
+		return nil
+	}
+
+	var msg telegramBotMessage
+	if err := t.call("sendMessage", params, &msg); err != nil {
+		return err
+	}
+	t.logger.Infof("Successfully sent Telegram message with ID: %d", msg.MessageID)
+	if tx.Notice {
+		return nil
+	} else if !tx.Confirmed {
+		t.rememberMessage(tx.Hash, msg.MessageID)
+	} else {
+		t.addToSummary(tx)
+	}
+	return nil
+}
+
+// ScheduleDailySummary posts and pins a summary at midnight UTC until ctx is done.
+// This call is blocking.
+func (t *TelegramPublisher) ScheduleDailySummary(ctx context.Context) {
+	if !t.config.PinDailySummary {
+		return
+	}
+	for {
+		now := time.Now().UTC()
+		nextDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		select {
+		case <-time.After(nextDay.Sub(now)):
+			if err := t.PostDailySummary(nextDay); err != nil {
+				t.logger.Errorf("Error posting Telegram daily summary: %+v", err)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// PostDailySummary posts the summary of all whales since the last summary, pins it and
+// unpins the previous one. The next summary will start at nextDay.
+func (t *TelegramPublisher) PostDailySummary(nextDay time.Time) error {
+	t.lock.Lock()
+	summary := t.summary
+	t.summary = newTelegramDailySummary(nextDay)
+	previousPin := t.pinnedSummary
+	t.lock.Unlock()
+
+	pr := message.NewPrinter(language.English)
+	text := fmt.Sprintf("📊 <b>Whale summary for %s</b>\n\n", summary.Day.Format("2006-01-02"))
+	if summary.Count == 0 {
+		text += "No whales today."
+	} else {
+		text += pr.Sprintf("%d whales moved %.0f #%s\nLargest: %.0f #%s", summary.Count, summary.Total.BCH(), t.config.Symbol, summary.Largest.BCH(), t.config.Symbol)
+	}
+
+	var msg telegramBotMessage
+	err := t.call("sendMessage", map[string]interface{}{
+		"chat_id":    t.config.Channel,
+		"text":       text,
+		"parse_mode": "HTML",
+	}, &msg)
+	if err != nil {
+		return err
+	}
+
+	err = t.call("pinChatMessage", map[string]interface{}{
+		"chat_id":              t.config.Channel,
+		"message_id":           msg.MessageID,
+		"disable_notification": true,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	t.pinnedSummary = msg.MessageID
+	t.lock.Unlock()
+
+	if previousPin != 0 {
+		err = t.call("unpinChatMessage", map[string]interface{}{
+			"chat_id":    t.config.Channel,
+			"message_id": previousPin,
+		}, nil)
+		if err != nil {
+			// not critical, Telegram will show the latest pin
+			t.logger.Errorf("Error unpinning previous Telegram summary %d: %+v", previousPin, err)
+		}
+	}
+	return nil
+}
+
+func (t *TelegramPublisher) rememberMessage(txHash string, messageID int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(t.sentOrder) >= telegramMaxSentMessages {
+		delete(t.sentMessages, t.sentOrder[0])
+		t.sentOrder = t.sentOrder[1:]
+	}
+	t.sentMessages[txHash] = messageID
+	t.sentOrder = append(t.sentOrder, txHash)
+}
+
+func (t *TelegramPublisher) addToSummary(tx *TransactionData) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.summary.Count++
+	t.summary.Total += tx.AmountRaw
+	if tx.AmountRaw > t.summary.Largest {
+		t.summary.Largest = tx.AmountRaw
+	}
+}
+
+// Call a Telegram Bot API method and unmarshal the result (if result is not nil).
+func (t *TelegramPublisher) call(method string, params interface{}, result interface{}) error {
+	reqBody, err := json.Marshal(params)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling Telegram request")
+	}
+	urlStr := fmt.Sprintf("%s/bot%s/%s", t.config.ApiUrl, t.config.Token, method)
+	resp, err := t.client.Post(urlStr, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("error calling Telegram %s", method))
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "error reading Telegram response")
+	}
+	var apiRes telegramBotResponse
+	err = json.Unmarshal(body, &apiRes)
+	if err != nil {
+		return errors.Wrap(err, "error unmarshalling Telegram JSON")
+	} else if !apiRes.Ok {
+		return errors.New(fmt.Sprintf("Telegram %s failed. Code %d - %s", method, apiRes.ErrorCode, apiRes.Description))
+	}
+
+	if result != nil {
+		if err = json.Unmarshal(apiRes.Result, result); err != nil {
+			return errors.Wrap(err, "error unmarshalling Telegram result")
+		}
+	}
+	return nil
+}
+
+func newTelegramDailySummary(day time.Time) *telegramDailySummary {
+	day = day.UTC()
+	return &telegramDailySummary{
+		Day: time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC),
+	}
+}
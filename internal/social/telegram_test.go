@@ -0,0 +1,190 @@
+package social
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type telegramTestCall struct {
+	method string
+	params map[string]interface{}
+}
+
+// A local stand-in for the Telegram Bot API recording all calls.
+type telegramTestServer struct {
+	*httptest.Server
+	lock      sync.Mutex
+	calls     []telegramTestCall
+	messageID int64
+}
+
+func newTelegramTestServer() *telegramTestServer {
+	server := &telegramTestServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.URL.Path, "/")
+		call := telegramTestCall{method: parts[len(parts)-1]}
+		if err := json.NewDecoder(r.Body).Decode(&call.params); err != nil {
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"invalid JSON"}`))
+			return
+		}
+
+		server.lock.Lock()
+		server.calls = append(server.calls, call)
+		server.messageID++
+		messageID := server.messageID
+		server.lock.Unlock()
+		w.Write([]byte(fmt.Sprintf(`{"ok":true,"result":{"message_id":%d}}`, messageID)))
+	}))
+	return server
+}
+
+func (s *telegramTestServer) popCalls() []telegramTestCall {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	calls := s.calls
+	s.calls = nil
+	return calls
+}
+
+func newTestTelegramPublisher(t *testing.T, server *telegramTestServer) *TelegramPublisher {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	telegram, err := NewTelegramPublisher(TelegramPublisherConfig{
+		Token:           "token",
+		Channel:         "@whales",
+		PinDailySummary: true,
+		ApiUrl:          server.URL,
+	}, logger)
+	if err != nil {
+		t.Fatalf("Error creating Telegram publisher: %+v", err)
+	}
+	return telegram
+}
+
+func newTestTransactionData(confirmed bool) *TransactionData {
+	return &TransactionData{
+		AmountRaw:   price.NewAmount(25000),
+		Amount:      "25,000",
+		Symbol:      "BCH",
+		FiatAmount:  "7,500,000",
+		FiatFee:     "0.0010",
+		FiatSymbol:  "<USD>",
+		Hash:        "abc",
+		TxLink:      "https://explorer.example.com/tx/abc",
+		Confirmed:   confirmed,
+		BlockHeight: 700000,
+	}
+}
+
+func TestTelegramPublish(t *testing.T) {
+	server := newTelegramTestServer()
+	defer server.Close()
+	telegram := newTestTelegramPublisher(t, server)
+
+	if err := telegram.Publish(newTestTransactionData(true)); err != nil {
+		t.Fatalf("Error publishing: %+v", err)
+	}
+	calls := server.popCalls()
+	if len(calls) != 1 || calls[0].method != "sendMessage" {
+		t.Fatalf("Expected 1 sendMessage call, got %+v", calls)
+	}
+	params := calls[0].params
+	text := params["text"].(string)
+	if params["parse_mode"] != "HTML" || !strings.Contains(text, "<b>25,000 #BCH</b>") || !strings.Contains(text, "&lt;USD&gt;") {
+		t.Errorf("Unexpected HTML message: %s", text)
+	}
+	if !strings.Contains(text, "confirmed in block 700000") {
+		t.Errorf("Message is missing confirmation: %s", text)
+	}
+	button := params["reply_markup"].(map[string]interface{})["inline_keyboard"].([]interface{})[0].([]interface{})[0].(map[string]interface{})
+	if button["text"] != "View TX" || button["url"] != "https://explorer.example.com/tx/abc" {
+		t.Errorf("Unexpected inline button: %v", button)
+	}
+	// notices are sent with their text message
+	notice := newTestTransactionData(true)
+	notice.Notice = true
+	notice.Message = "<Pool> mined block 700000"
+	if err := telegram.Publish(notice); err != nil {
+		t.Fatalf("Error publishing notice: %+v", err)
+	}
+	calls = server.popCalls()
+	if len(calls) != 1 || calls[0].params["text"] != "&lt;Pool&gt; mined block 700000" {
+		t.Errorf("Unexpected notice message: %+v", calls)
+	}
+	if telegram.summary.Count != 1 {
+		t.Errorf("Expected notice to be excluded from the summary, got %d TX", telegram.summary.Count)
+	}
+}
+
+func TestTelegramEditOnConfirmation(t *testing.T) {
+	server := newTelegramTestServer()
+	defer server.Close()
+	telegram := newTestTelegramPublisher(t, server)
+
+	if err := telegram.Publish(newTestTransactionData(false)); err != nil {
+		t.Fatalf("Error publishing: %+v", err)
+	}
+	calls := server.popCalls()
+	if len(calls) != 1 || calls[0].method != "sendMessage" || !strings.Contains(calls[0].params["text"].(string), "unconfirmed") {
+		t.Fatalf("Expected unconfirmed sendMessage call, got %+v", calls)
+	}
+
+	if err := telegram.Publish(newTestTransactionData(true)); err != nil {
+		t.Fatalf("Error publishing: %+v", err)
+	}
+	calls = server.popCalls()
+	if len(calls) != 1 || calls[0].method != "editMessageText" {
+		t.Fatalf("Expected editMessageText call, got %+v", calls)
+	}
+	if calls[0].params["message_id"] != float64(1) || !strings.Contains(calls[0].params["text"].(string), "confirmed in block") {
+		t.Errorf("Unexpected edit params: %v", calls[0].params)
+	}
+}
+
+func TestTelegramDailySummary(t *testing.T) {
+	server := newTelegramTestServer()
+	defer server.Close()
+	telegram := newTestTelegramPublisher(t, server)
+
+	telegram.Publish(newTestTransactionData(true))
+	tx := newTestTransactionData(true)
+	tx.Hash = "def"
+	tx.AmountRaw = price.NewAmount(30000)
+	telegram.Publish(tx)
+	server.popCalls()
+
+	if err := telegram.PostDailySummary(time.Now().Add(24 * time.Hour)); err != nil {
+		t.Fatalf("Error posting summary: %+v", err)
+	}
+	calls := server.popCalls()
+	if len(calls) != 2 || calls[0].method != "sendMessage" || calls[1].method != "pinChatMessage" {
+		t.Fatalf("Expected sendMessage and pinChatMessage calls, got %+v", calls)
+	}
+	text := calls[0].params["text"].(string)
+	if !strings.Contains(text, "2 whales moved 55,000 #BCH") || !strings.Contains(text, "Largest: 30,000 #BCH") {
+		t.Errorf("Unexpected summary: %s", text)
+	}
+	pinned := calls[1].params["message_id"]
+
+	// the next summary is empty and replaces the previous pin
+	if err := telegram.PostDailySummary(time.Now().Add(48 * time.Hour)); err != nil {
+		t.Fatalf("Error posting summary: %+v", err)
+	}
+	calls = server.popCalls()
+	if len(calls) != 3 || calls[2].method != "unpinChatMessage" || calls[2].params["message_id"] != pinned {
+		t.Fatalf("Expected previous summary to be unpinned, got %+v", calls)
+	}
+	if !strings.Contains(calls[0].params["text"].(string), "No whales today.") {
+		t.Errorf("Unexpected empty summary: %s", calls[0].params["text"])
+	}
+}
@@ -4,19 +4,28 @@ import (
 	"github.com/Ekliptor/cashwhale/internal/log"
 	"github.com/dghubble/go-twitter/twitter"
 	"github.com/dghubble/oauth1"
-	"github.com/spf13/viper"
 )
 
+// ensure we always implement Publisher (compile error otherwise)
+var _ Publisher = (*TwitterClient)(nil)
+
 type TwitterClient struct {
 	Client *twitter.Client
 
 	logger log.Logger
 }
 
-func NewTwitterClient(logger log.Logger) *TwitterClient {
-	config := oauth1.NewConfig(viper.GetString("Twitter.ConsumerKey"), viper.GetString("Twitter.ConsumerSecret"))
-	token := oauth1.NewToken(viper.GetString("Twitter.AccessToken"), viper.GetString("Twitter.AccessSecret"))
-	httpClient := config.Client(oauth1.NoContext, token)
+type TwitterClientConfig struct {
+	ConsumerKey    string
+	ConsumerSecret string
+	AccessToken    string
+	AccessSecret   string
+}
+
+func NewTwitterClient(config TwitterClientConfig, logger log.Logger) *TwitterClient {
+	oauthConfig := oauth1.NewConfig(config.ConsumerKey, config.ConsumerSecret)
+	token := oauth1.NewToken(config.AccessToken, config.AccessSecret)
+	httpClient := oauthConfig.Client(oauth1.NoContext, token)
 
 	// Twitter client
 	client := twitter.NewClient(httpClient)
@@ -40,3 +49,12 @@ func (c *TwitterClient) SendTweet(msg string) (*twitter.Tweet, error) {
 	c.logger.Infof("Successfully sent tweet with ID: %s", tweet.IDStr)
 	return tweet, err
 }
+
+func (c *TwitterClient) Name() string {
+	return "twitter"
+}
+
+func (c *TwitterClient) Publish(tx *TransactionData) error {
+	_, err := c.SendTweet(tx.Message)
+	return err
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parses the query parameters of the /whales endpoint:
+// from and to (unix timestamps), min (BCH) and limit.
+func parseWhaleQuery(params url.Values) (WhaleQuery, error) {
+	query := WhaleQuery{}
+	parseTime := func(key string) (time.Time, error) {
+		value := params.Get(key)
+		if len(value) == 0 {
+			return time.Time{}, nil
+		}
+		unix, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.New(fmt.Sprintf("invalid '%s' parameter - must be a unix timestamp", key))
+		}
+		return time.Unix(unix, 0), nil
+	}
+	var err error
+	if query.From, err = parseTime("from"); err != nil {
+		return query, err
+	}
+	if query.To, err = parseTime("to"); err != nil {
+		return query, err
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && query.From.After(query.To) {
+		return query, errors.New("'from' must not be after 'to'")
+	}
+
+	if value := params.Get("min"); len(value) != 0 {
+		query.MinBch, err = strconv.ParseFloat(value, 64)
+		if err != nil || query.MinBch < 0.0 {
+			return query, errors.New("invalid 'min' parameter - must be a positive number")
+		}
+	}
+	if value := params.Get("limit"); len(value) != 0 {
+		query.Limit, err = strconv.Atoi(value)
+		if err != nil || query.Limit <= 0 || query.Limit > MaxQueryLimit {
+			return query, errors.New(fmt.Sprintf("invalid 'limit' parameter - must be between 1 and %d", MaxQueryLimit))
+		}
+	}
+	return query, nil
+}
+
+func (s *WhaleStore) serveWhales(writer http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" || req.URL.Path != "/whales" {
+		s.monitor.RespondJSON(writer, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	query, err := parseWhaleQuery(req.URL.Query())
+	if err != nil {
+		s.monitor.RespondJSON(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	records, err := s.QueryWhales(query)
+	if err != nil {
+		s.logger.Errorf("Error querying whales: %+v", err)
+		s.monitor.RespondJSON(writer, http.StatusInternalServerError, "error querying whales")
+		return
+	}
+	s.monitor.RespondJSON(writer, http.StatusOK, records)
+}
+
+func (s *WhaleStore) serveWhale(writer http.ResponseWriter, req *http.Request) {
+	txid := strings.TrimPrefix(req.URL.Path, "/whales/")
+	if req.Method != "GET" || len(txid) == 0 || strings.Contains(txid, "/") {
+		s.monitor.RespondJSON(writer, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	record, err := s.GetWhale(txid)
+	if err == ErrWhaleNotFound {
+		s.monitor.RespondJSON(writer, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		s.logger.Errorf("Error reading whale %s: %+v", txid, err)
+		s.monitor.RespondJSON(writer, http.StatusInternalServerError, "error reading whale")
+		return
+	}
+	s.monitor.RespondJSON(writer, http.StatusOK, record)
+}
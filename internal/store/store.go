@@ -0,0 +1,233 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/internal/social"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+	"time"
+)
+
+const (
+	DefaultQueryLimit = 100
+	MaxQueryLimit     = 1000
+)
+
+var (
+	whalesBucket     = []byte("whales")   // txid -> JSON record
+	detectedBucket   = []byte("detected") // big endian unix nano + txid -> txid
+	ErrWhaleNotFound = errors.New("whale not found")
+)
+
+// WhaleStore persists all whales in an embedded database.
+type WhaleStore struct {
+	config  WhaleStoreConfig
+	db      *bbolt.DB
+	logger  log.Logger
+	monitor *monitoring.HttpMonitoring
+}
+
+type WhaleStoreConfig struct {
+	Path string // the database file - defaults to "whales.db"
+}
+
+// WhaleRecord is a stored whale with its publish status per publisher.
+type WhaleRecord struct {
+	TxID         string                           `json:"txid"`
+	BlockHeight  uint32                           `json:"block_height"`
+	Confirmed    bool                             `json:"confirmed"`
+	AmountBch    float64                          `json:"amount_bch"`
+	FeeBch       float64                          `json:"fee_bch"`
+	FiatAmount   float64                          `json:"fiat_amount"`
+	FiatCurrency string                           `json:"fiat_currency"`
+	Labels       []string                         `json:"labels"`
+	Rule         string                           `json:"rule"`
+	TxType       string                           `json:"tx_type,omitempty"`
+	Detected     time.Time                        `json:"detected"`
+	Published    map[string]*social.PublishStatus `json:"published"` // publisher name -> status
+}
+
+// WhaleQuery filters stored whales. Zero values are ignored.
+type WhaleQuery struct {
+	From   time.Time
+	To     time.Time
+	MinBch float64
+	Limit  int // defaults to DefaultQueryLimit
+}
+
+// NewWhaleStore opens (or creates) the database and registers the query routes on the monitoring server.
+func NewWhaleStore(config WhaleStoreConfig, logger log.Logger, monitor *monitoring.HttpMonitoring) (*WhaleStore, error) {
+	if len(config.Path) == 0 {
+		config.Path = "whales.db"
+	}
+	db, err := bbolt.Open(config.Path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening whale database")
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{whalesBucket, detectedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "error creating whale database buckets")
+	}
+
+	store := &WhaleStore{
+		config: config,
+		db:     db,
+		logger: logger.WithFields(log.Fields{
+			"module": "store",
+		}),
+		monitor: monitor,
+	}
+	monitor.HandleFunc("/whales", store.serveWhales)
+	monitor.HandleFunc("/whales/", store.serveWhale)
+	return store, nil
+}
+
+// Close closes the database. Call this on shutdown.
+func (s *WhaleStore) Close() error {
+	return s.db.Close()
+}
+
+// RecordWhale stores the whale or updates the existing record of this TX
+// (for example when it gets confirmed or is resent).
+// New whales are indexed by the time they were detected, which is the block time of backfilled TX.
+func (s *WhaleStore) RecordWhale(tx *social.TransactionData, status map[string]*social.PublishStatus) error {
+	return s.db.Update(func(btx *bbolt.Tx) error {
+		whales := btx.Bucket(whalesBucket)
+		detected := tx.Detected
+		if detected.IsZero() {
+			detected = time.Now()
+		}
+		record := &WhaleRecord{
+			Detected:  detected,
+			Published: make(map[string]*social.PublishStatus, len(status)),
+		}
+		if existing := whales.Get([]byte(tx.Hash)); existing != nil {
+			if err := json.Unmarshal(existing, record); err != nil {
+				return errors.Wrap(err, "error decoding stored whale")
+			}
+			if record.Published == nil {
+				record.Published = make(map[string]*social.PublishStatus, len(status))
+			}
+		} else {
+			key := detectedKey(record.Detected, tx.Hash)
+			if err := btx.Bucket(detectedBucket).Put(key, []byte(tx.Hash)); err != nil {
+				return errors.Wrap(err, "error storing whale index")
+			}
+		}
+
+		record.TxID = tx.Hash
+		record.BlockHeight = tx.BlockHeight
+		record.Confirmed = tx.Confirmed
+		record.AmountBch = tx.AmountRaw.BCH()
+		record.FeeBch = tx.FeeRaw.BCH()
+		if tx.FiatAmountRaw != 0.0 {
+			record.FiatAmount = tx.FiatAmountRaw
+			record.FiatCurrency = tx.Currency
+		}
+		record.Labels = tx.Labels
+		record.Rule = tx.Rule
+		record.TxType = tx.TxType
+		for name, publishStatus := range status {
+			// keep a previous success if resending on this publisher failed
+			previous, ok := record.Published[name]
+			if ok && previous.Status == social.PUBLISH_STATUS_PUBLISHED && publishStatus.Status != social.PUBLISH_STATUS_PUBLISHED {
+				continue
+			}
+			record.Published[name] = publishStatus
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return errors.Wrap(err, "error encoding whale")
+		}
+		return whales.Put([]byte(tx.Hash), data)
+	})
+}
+
+// GetWhale returns the stored whale with this TX hash or ErrWhaleNotFound.
+func (s *WhaleStore) GetWhale(txid string) (*WhaleRecord, error) {
+	var record *WhaleRecord
+	err := s.db.View(func(btx *bbolt.Tx) error {
+		data := btx.Bucket(whalesBucket).Get([]byte(txid))
+		if data == nil {
+			return ErrWhaleNotFound
+		}
+		record = &WhaleRecord{}
+		return json.Unmarshal(data, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// QueryWhales returns the stored whales matching the query, newest first.
+func (s *WhaleStore) QueryWhales(query WhaleQuery) ([]*WhaleRecord, error) {
+	if query.Limit <= 0 {
+		query.Limit = DefaultQueryLimit
+	} else if query.Limit > MaxQueryLimit {
+		query.Limit = MaxQueryLimit
+	}
+	records := make([]*WhaleRecord, 0, 20)
+	err := s.db.View(func(btx *bbolt.Tx) error {
+		whales := btx.Bucket(whalesBucket)
+		cursor := btx.Bucket(detectedBucket).Cursor()
+
+		// iterate backwards from the end of the time range
+		var key, txid []byte
+		if query.To.IsZero() {
+			key, txid = cursor.Last()
+		} else {
+			key, txid = cursor.Seek(detectedKey(query.To.Add(time.Nanosecond), ""))
+			if key == nil {
+				key, txid = cursor.Last()
+			} else {
+				key, txid = cursor.Prev()
+			}
+		}
+		for ; key != nil && len(records) < query.Limit; key, txid = cursor.Prev() {
+			if !query.From.IsZero() && detectedTime(key).Before(query.From) {
+				break
+			}
+			data := whales.Get(txid)
+			if data == nil {
+				continue
+			}
+			record := &WhaleRecord{}
+			if err := json.Unmarshal(data, record); err != nil {
+				return errors.Wrap(err, "error decoding stored whale")
+			}
+			if record.AmountBch < query.MinBch {
+				continue
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Returns the index key sorting whales by the time they were detected.
+func detectedKey(when time.Time, txid string) []byte {
+	key := make([]byte, 8, 8+len(txid))
+	binary.BigEndian.PutUint64(key, uint64(when.UnixNano()))
+	return append(key, txid...)
+}
+
+func detectedTime(key []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"encoding/json"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/internal/social"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) (*WhaleStore, *monitoring.HttpMonitoring) {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	monitor, err := monitoring.NewHttpMonitoring(monitoring.HttpMonitoringConfig{}, logger)
+	if err != nil {
+		t.Fatalf("Error creating monitoring: %+v", err)
+	}
+	store, err := NewWhaleStore(WhaleStoreConfig{Path: filepath.Join(t.TempDir(), "whales.db")}, logger, monitor)
+	if err != nil {
+		t.Fatalf("Error creating whale store: %+v", err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+	})
+	return store, monitor
+}
+
+func TestRecordWhale(t *testing.T) {
+	store, _ := newTestStore(t)
+	tx := &social.TransactionData{Hash: "tx1", AmountRaw: price.NewAmount(15000), FiatAmountRaw: 4500000, Currency: "USD", Rule: "fixed"}
+	err := store.RecordWhale(tx, map[string]*social.PublishStatus{
+		"twitter":  {Status: social.PUBLISH_STATUS_PUBLISHED, When: time.Now()},
+		"telegram": {Status: social.PUBLISH_STATUS_FAILED, Error: "timeout", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("Error recording whale: %+v", err)
+	}
+
+	// confirmation: a failed resend must not overwrite the previous success
+	tx.Confirmed = true
+	tx.BlockHeight = 700000
+	err = store.RecordWhale(tx, map[string]*social.PublishStatus{
+		"twitter":  {Status: social.PUBLISH_STATUS_FAILED, Error: "rate limit", When: time.Now()},
+		"telegram": {Status: social.PUBLISH_STATUS_PUBLISHED, When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("Error updating whale: %+v", err)
+	}
+
+	record, err := store.GetWhale("tx1")
+	if err != nil {
+		t.Fatalf("Error reading whale: %+v", err)
+	}
+	if !record.Confirmed || record.BlockHeight != 700000 || record.FiatCurrency != "USD" {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+	if record.Published["twitter"].Status != social.PUBLISH_STATUS_PUBLISHED || record.Published["telegram"].Status != social.PUBLISH_STATUS_PUBLISHED {
+		t.Errorf("Unexpected publish status: %+v", record.Published)
+	}
+	if _, err = store.GetWhale("missing"); err != ErrWhaleNotFound {
+		t.Errorf("Expected ErrWhaleNotFound, got %v", err)
+	}
+
+	records, err := store.QueryWhales(WhaleQuery{})
+	if err != nil || len(records) != 1 {
+		t.Errorf("Expected 1 stored whale, got %d: %v", len(records), err)
+	}
+}
+
+func TestQueryWhales(t *testing.T) {
+	store, monitor := newTestStore(t)
+	start := time.Now()
+	for i, amount := range []float64{1000, 5000, 20000} {
+		tx := &social.TransactionData{Hash: "tx" + string(rune('a'+i)), AmountRaw: price.NewAmount(amount)}
+		if err := store.RecordWhale(tx, nil); err != nil {
+			t.Fatalf("Error recording whale: %+v", err)
+		}
+	}
+
+	records, err := store.QueryWhales(WhaleQuery{MinBch: 2000})
+	if err != nil {
+		t.Fatalf("Error querying whales: %+v", err)
+	}
+	if len(records) != 2 || records[0].TxID != "txc" || records[1].TxID != "txb" {
+		t.Errorf("Expected newest whales above min first, got %+v", records)
+	}
+	records, _ = store.QueryWhales(WhaleQuery{Limit: 1})
+	if len(records) != 1 || records[0].TxID != "txc" {
+		t.Errorf("Expected newest whale only, got %+v", records)
+	}
+	records, _ = store.QueryWhales(WhaleQuery{To: start.Add(-time.Hour)})
+	if len(records) != 0 {
+		t.Errorf("Expected no whales before start, got %+v", records)
+	}
+	records, _ = store.QueryWhales(WhaleQuery{From: start.Add(-time.Second), To: time.Now()})
+	if len(records) != 3 {
+		t.Errorf("Expected all whales in range, got %+v", records)
+	}
+
+	// backfilled whales are indexed by their block time
+	backfilled := &social.TransactionData{Hash: "txd", AmountRaw: price.NewAmount(3000), Detected: start.Add(-24 * time.Hour)}
+	if err := store.RecordWhale(backfilled, nil); err != nil {
+		t.Fatalf("Error recording whale: %+v", err)
+	}
+	records, _ = store.QueryWhales(WhaleQuery{To: start.Add(-time.Hour)})
+	if len(records) != 1 || records[0].TxID != "txd" || !records[0].Detected.Equal(backfilled.Detected) {
+		t.Errorf("Expected backfilled whale at its block time, got %+v", records)
+	}
+
+	tests := []struct {
+		path     string
+		expected int
+		count    int
+	}{
+		{"/whales", http.StatusOK, 4},
+		{"/whales?min=4000&limit=10", http.StatusOK, 2},
+		{"/whales?min=-1", http.StatusBadRequest, 0},
+		{"/whales?from=10&to=5", http.StatusBadRequest, 0},
+		{"/whales/txa", http.StatusOK, 0},
+		{"/whales/unknown", http.StatusNotFound, 0},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		monitor.ServeHTTP(recorder, httptest.NewRequest("GET", test.path, nil))
+		if recorder.Code != test.expected {
+			t.Errorf("Expected %d for %s, got %d: %s", test.expected, test.path, recorder.Code, recorder.Body.String())
+			continue
+		}
+		if test.count == 0 {
+			continue
+		}
+		var res struct {
+			Data []*WhaleRecord `json:"data"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &res); err != nil || len(res.Data) != test.count {
+			t.Errorf("Expected %d whales for %s, got %s", test.count, test.path, recorder.Body.String())
+		}
+	}
+}
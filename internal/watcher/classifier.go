@@ -0,0 +1,207 @@
+package watcher
+
+import (
+	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// Types of transactions. Rules can include or exclude whales by type.
+type TxType string
+
+const (
+	TX_TRANSFER      TxType = "transfer"      // few inputs to 1 or 2 outputs
+	TX_CONSOLIDATION TxType = "consolidation" // many inputs to 1 or 2 outputs, for example an exchange sweeping deposits
+	TX_BATCH_PAYOUT  TxType = "batch_payout"  // few inputs to many outputs, for example exchange withdrawals
+	TX_PEEL_CHAIN    TxType = "peel_chain"    // 1 input spending the large change of a previous peel to a small payment and a large change output
+	TX_COINJOIN      TxType = "coinjoin"      // many inputs to many (equal) outputs, for example CashFusion
+)
+
+// TxTypes are all types of the classifier.
+var TxTypes = []TxType{TX_TRANSFER, TX_CONSOLIDATION, TX_BATCH_PAYOUT, TX_PEEL_CHAIN, TX_COINJOIN}
+
+// how many change outputs of possible peel chains to keep to detect the next peel
+const maxPeelOutputs = 10000
+
+// Classifier tags transactions with a TxType by the number and values of their inputs and outputs.
+type Classifier struct {
+	config ClassifierConfig
+
+	lock        sync.Mutex
+	peelOutputs map[string]bool // "hash:index" of large change outputs of 1 input to 2 outputs TX
+	peelOrder   []string        // outputs in the order they were added to remove old ones
+}
+
+type ClassifierConfig struct {
+	ConsolidationMinInputs    int     // defaults to 20
+	BatchMinOutputs           int     // defaults to 20
+	CoinJoinMinEqualOutputs   int     // defaults to 5
+	PeelChainMinChangePercent float64 // the change of a peel chain TX and the TX it spends is at least this share of the value, defaults to 90
+}
+
+// RuleTypes include or exclude TX of these types from a rule.
+type RuleTypes struct {
+	Include []TxType `json:"include"` // empty = all types
+	Exclude []TxType `json:"exclude"`
+}
+
+func NewClassifier(config ClassifierConfig) *Classifier {
+	if config.ConsolidationMinInputs <= 0 {
+		config.ConsolidationMinInputs = 20
+	}
+	if config.BatchMinOutputs <= 0 {
+		config.BatchMinOutputs = 20
+	}
+	if config.CoinJoinMinEqualOutputs <= 0 {
+		config.CoinJoinMinEqualOutputs = 5
+	}
+	if config.PeelChainMinChangePercent <= 0.0 {
+		config.PeelChainMinChangePercent = 90.0
+	}
+	return &Classifier{
+		config:      config,
+		peelOutputs: make(map[string]bool, 1000),
+		peelOrder:   make([]string, 0, 1000),
+	}
+}
+
+// Classify returns the type of the TX.
+func (c *Classifier) Classify(tx *parser.Transaction) TxType {
+	inputs := len(tx.Inputs)
+	outputs := make([]*parser.Output, 0, len(tx.Outputs))
+	indexes := make([]int, 0, len(tx.Outputs))
+	for i, out := range tx.Outputs {
+		if out.ScriptType != parser.SCRIPT_NULLDATA { // OP_RETURN data is no payment
+			outputs = append(outputs, out)
+			indexes = append(indexes, i)
+		}
+	}
+
+	switch {
+	case inputs >= 2 && maxEqualOutputs(outputs) >= c.config.CoinJoinMinEqualOutputs,
+		inputs >= c.config.ConsolidationMinInputs && len(outputs) >= c.config.BatchMinOutputs:
+		return TX_COINJOIN
+	case inputs >= c.config.ConsolidationMinInputs && len(outputs) <= 2:
+		return TX_CONSOLIDATION
+	case len(outputs) >= c.config.BatchMinOutputs:
+		return TX_BATCH_PAYOUT
+	case inputs == 1 && len(outputs) == 2:
+		if change := c.changeIndex(outputs[0].Value, outputs[1].Value); change != -1 && c.spendPeel(tx, indexes[change]) {
+			return TX_PEEL_CHAIN
+		}
+	}
+	return TX_TRANSFER
+}
+
+// Returns the index of the larger output if it's the change of a small payment or -1.
+func (c *Classifier) changeIndex(a price.Amount, b price.Amount) int {
+	total := a + b
+	if total <= 0 {
+		return -1
+	}
+	change, index := a, 0
+	if b > a {
+		change, index = b, 1
+	}
+	if float64(change)*100.0 < float64(total)*c.config.PeelChainMinChangePercent {
+		return -1
+	}
+	return index
+}
+
+// Remembers the change output of the TX and returns true if the TX spends the change of a previous peel.
+// A single TX with a small payment and a large change is most likely an ordinary payment.
+// Spent outputs are kept, so a TX checked unconfirmed and again in its block gets the same type.
+func (c *Classifier) spendPeel(tx *parser.Transaction, change int) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	in := tx.Inputs[0]
+	peel := c.peelOutputs[fmt.Sprintf("%s:%d", in.PrevHash, in.PrevIndex)]
+
+	key := fmt.Sprintf("%s:%d", tx.Hash, change)
+	if c.peelOutputs[key] {
+		return peel // classified before
+	}
+	if len(c.peelOrder) >= maxPeelOutputs {
+		delete(c.peelOutputs, c.peelOrder[0])
+		c.peelOrder = c.peelOrder[1:]
+	}
+	c.peelOutputs[key] = true
+	c.peelOrder = append(c.peelOrder, key)
+	return peel
+}
+
+// Returns the highest number of outputs with the same value.
+func maxEqualOutputs(outputs []*parser.Output) int {
+	counts := make(map[price.Amount]int, len(outputs))
+	max := 0
+	for _, out := range outputs {
+		counts[out.Value]++
+		if counts[out.Value] > max {
+			max = counts[out.Value]
+		}
+	}
+	return max
+}
+
+// Allows returns true if TX of this type can match the rule.
+func (r *RuleTypes) Allows(txType TxType) bool {
+	if r == nil {
+		return true
+	}
+	for _, excluded := range r.Exclude {
+		if excluded == txType {
+			return false
+		}
+	}
+	if len(r.Include) == 0 {
+		return true
+	}
+	for _, included := range r.Include {
+		if included == txType {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRuleTypes returns an error if a rule or type is unknown.
+func ValidateRuleTypes(ruleTypes map[string]*RuleTypes) error {
+	for rule, types := range ruleTypes {
+		if !isRule(rule) {
+			return errors.Errorf("unknown rule %s, must be one of %v", rule, Rules)
+		} else if types == nil {
+			continue
+		}
+		txTypes := make([]TxType, 0, len(types.Include)+len(types.Exclude))
+		txTypes = append(txTypes, types.Include...)
+		txTypes = append(txTypes, types.Exclude...)
+		for _, txType := range txTypes {
+			if !IsTxType(txType) {
+				return errors.Errorf("unknown TX type %s of rule %s, must be one of %v", txType, rule, TxTypes)
+			}
+		}
+	}
+	return nil
+}
+
+// IsTxType returns true if the type is known to the classifier.
+func IsTxType(txType TxType) bool {
+	for _, known := range TxTypes {
+		if known == txType {
+			return true
+		}
+	}
+	return false
+}
+
+func isRule(name string) bool {
+	for _, rule := range Rules {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
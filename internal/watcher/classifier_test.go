@@ -0,0 +1,121 @@
+package watcher
+
+import (
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"testing"
+)
+
+// Returns a TX with this number of inputs and these output values.
+func newTestTransaction(inputs int, values ...price.Amount) *parser.Transaction {
+	tx := &parser.Transaction{
+		Hash:    "tx",
+		Inputs:  make([]*parser.Input, inputs),
+		Outputs: make([]*parser.Output, len(values)),
+	}
+	for i := range tx.Inputs {
+		tx.Inputs[i] = &parser.Input{PrevHash: "abc", PrevIndex: uint32(i)}
+	}
+	for i, value := range values {
+		tx.Outputs[i] = &parser.Output{Value: value, ScriptType: parser.SCRIPT_P2PKH}
+	}
+	return tx
+}
+
+// Returns count outputs of value.
+func repeatAmount(value price.Amount, count int) []price.Amount {
+	values := make([]price.Amount, count)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
+
+func TestClassify(t *testing.T) {
+	classifier := NewClassifier(ClassifierConfig{})
+	withData := newTestTransaction(1, 100000, 200000)
+	withData.Outputs = append(withData.Outputs, &parser.Output{ScriptType: parser.SCRIPT_NULLDATA})
+
+	tests := []struct {
+		name     string
+		tx       *parser.Transaction
+		expected TxType
+	}{
+		{"transfer", newTestTransaction(2, 500000000), TX_TRANSFER},
+		{"transfer with change", newTestTransaction(1, 100000, 200000), TX_TRANSFER},
+		{"transfer with OP_RETURN", withData, TX_TRANSFER},
+		{"payment with small change", newTestTransaction(1, 150000000000, 200000000), TX_TRANSFER},
+		{"small payment with large change", newTestTransaction(1, 100000, 99900000), TX_TRANSFER},
+		{"consolidation", newTestTransaction(150, 7500000000), TX_CONSOLIDATION},
+		{"batch payout", newTestTransaction(1, append(repeatAmount(1000, 30), 5000, 7000)...), TX_BATCH_PAYOUT},
+		{"equal outputs", newTestTransaction(8, append(repeatAmount(1000000, 5), 12345, 67890)...), TX_COINJOIN},
+	}
+	for _, test := range tests {
+		if txType := classifier.Classify(test.tx); txType != test.expected {
+			t.Errorf("Expected %s TX to be %s, got %s", test.name, test.expected, txType)
+		}
+	}
+
+	manyToMany := newTestTransaction(40, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20)
+	if txType := classifier.Classify(manyToMany); txType != TX_COINJOIN {
+		t.Errorf("Expected many inputs to many outputs to be %s, got %s", TX_COINJOIN, txType)
+	}
+}
+
+func TestClassifyPeelChain(t *testing.T) {
+	classifier := NewClassifier(ClassifierConfig{})
+	first := newTestTransaction(1, 100000, 99900000)
+	first.Hash = "first"
+	if txType := classifier.Classify(first); txType != TX_TRANSFER {
+		t.Fatalf("Expected first peel to be %s, got %s", TX_TRANSFER, txType)
+	}
+
+	// the next TX spending the large change of the first one is a peel chain
+	second := newTestTransaction(1, 99800000, 50000)
+	second.Hash = "second"
+	second.Inputs[0] = &parser.Input{PrevHash: "first", PrevIndex: 1}
+	if txType := classifier.Classify(second); txType != TX_PEEL_CHAIN {
+		t.Errorf("Expected TX spending peel change to be %s, got %s", TX_PEEL_CHAIN, txType)
+	}
+	// the same TX is classified again when it's confirmed
+	if txType := classifier.Classify(second); txType != TX_PEEL_CHAIN || len(classifier.peelOrder) != 2 {
+		t.Errorf("Expected TX classified again to be %s with 2 outputs, got %s with %d", TX_PEEL_CHAIN, txType, len(classifier.peelOrder))
+	}
+	third := newTestTransaction(1, 40000, 99700000)
+	third.Inputs[0] = &parser.Input{PrevHash: "second", PrevIndex: 0}
+	if txType := classifier.Classify(third); txType != TX_PEEL_CHAIN {
+		t.Errorf("Expected TX spending change with other index to be %s, got %s", TX_PEEL_CHAIN, txType)
+	}
+
+	// spending the small payment of a peel is no peel chain
+	payment := newTestTransaction(1, 1000, 98000)
+	payment.Inputs[0] = &parser.Input{PrevHash: "first", PrevIndex: 0}
+	if txType := classifier.Classify(payment); txType != TX_TRANSFER {
+		t.Errorf("Expected TX spending peel payment to be %s, got %s", TX_TRANSFER, txType)
+	}
+}
+
+func TestRuleTypes(t *testing.T) {
+	var all *RuleTypes
+	if !all.Allows(TX_CONSOLIDATION) {
+		t.Errorf("Expected rule without types to allow all types")
+	}
+	types := &RuleTypes{Exclude: []TxType{TX_CONSOLIDATION, TX_BATCH_PAYOUT}}
+	if types.Allows(TX_CONSOLIDATION) || !types.Allows(TX_TRANSFER) {
+		t.Errorf("Unexpected excluded types of %+v", types)
+	}
+	types = &RuleTypes{Include: []TxType{TX_TRANSFER, TX_PEEL_CHAIN}, Exclude: []TxType{TX_PEEL_CHAIN}}
+	if !types.Allows(TX_TRANSFER) || types.Allows(TX_PEEL_CHAIN) || types.Allows(TX_COINJOIN) {
+		t.Errorf("Unexpected included types of %+v", types)
+	}
+
+	if err := ValidateRuleTypes(map[string]*RuleTypes{RULE_THRESHOLD: types, RULE_UPPER_PERCENT: nil}); err != nil {
+		t.Errorf("Expected valid rule types: %v", err)
+	}
+	if err := ValidateRuleTypes(map[string]*RuleTypes{"unknown": types}); err == nil {
+		t.Errorf("Expected error for unknown rule")
+	}
+	if err := ValidateRuleTypes(map[string]*RuleTypes{RULE_THRESHOLD: {Include: []TxType{"swap"}}}); err == nil {
+		t.Errorf("Expected error for unknown TX type")
+	}
+}
@@ -2,29 +2,90 @@ package watcher
 
 import (
 	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/bch/parser"
 	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/miner"
 	"github.com/Ekliptor/cashwhale/internal/monitoring"
 	"github.com/Ekliptor/cashwhale/internal/social"
 	"github.com/Ekliptor/cashwhale/pkg/notification"
+	"github.com/Ekliptor/cashwhale/pkg/price"
 	"github.com/Ekliptor/cashwhale/pkg/txcounter"
-	"github.com/prompt-cash/go-bitcoin"
-	"github.com/spf13/viper"
+	"github.com/pkg/errors"
+	"sync"
 	"time"
 )
 
+// Names of the rules that can identify a whale.
+const (
+	RULE_THRESHOLD     = "threshold"     // above the fixed Message.WahleThresholdBCH
+	RULE_UPPER_PERCENT = "upper_percent" // above the average of the upper Average.UpperTxPercent TX
+)
+
+// Rules are the names of all rules in the order they are checked.
+var Rules = []string{RULE_THRESHOLD, RULE_UPPER_PERCENT}
+
 type Watcher struct {
+	config     WatcherConfig
 	counter    *txcounter.TxCounter
 	monitor    *monitoring.HttpMonitoring
 	msgBuilder *social.MessageBuilder
+	miners     *miner.MinerTracker // nil if disabled
+	classifier *Classifier
 	logger     log.Logger
+
+	configLock sync.Mutex // guards thresholds, ruleTypes and notify
+	thresholds Thresholds
+	ruleTypes  map[string]*RuleTypes
+	notify     []*notification.NotificationReceiver
+	recordOnly bool // only store whales without publishing them (for backfilling)
+
+	blocksProcessed     *monitoring.Counter
+	transactionsScanned *monitoring.Counter
+	coinbaseSkipped     *monitoring.Counter
+	txClassified        *monitoring.Counter
+	whalesDetected      *monitoring.Counter
 }
 
-func NewWatcher(logger log.Logger, monitor *monitoring.HttpMonitoring, counter *txcounter.TxCounter, msgBuilder *social.MessageBuilder) (*Watcher, error) {
+// Thresholds are the values of the rules identifying whales. They can be changed at runtime.
+type Thresholds struct {
+	WhaleBch       float64 `json:"whale_bch"`        // RULE_THRESHOLD
+	UpperTxPercent float64 `json:"upper_tx_percent"` // RULE_UPPER_PERCENT
+	MinTxCount     int     `json:"min_tx_count"`     // RULE_UPPER_PERCENT is only active with this many TX in TxCounter
+}
+
+type WatcherConfig struct {
+	Thresholds     Thresholds
+	Classifier     ClassifierConfig
+	RuleTypes      map[string]*RuleTypes                // rule name -> TX types the rule applies to, missing rules apply to all types
+	Notify         []*notification.NotificationReceiver // receivers of the 'tweets stopped' notification
+	Notifier       notification.NotifierConfig
+	TweetThreshold time.Duration // notify if nothing was published for this long, defaults to 24h
+}
+
+func NewWatcher(config WatcherConfig, logger log.Logger, monitor *monitoring.HttpMonitoring, counter *txcounter.TxCounter, msgBuilder *social.MessageBuilder) (*Watcher, error) {
+	if config.TweetThreshold <= 0 {
+		config.TweetThreshold = 24 * time.Hour
+	}
+	metrics := monitor.Metrics()
 	watcher := &Watcher{
+		config:     config,
 		counter:    counter,
 		monitor:    monitor,
 		msgBuilder: msgBuilder,
+		classifier: NewClassifier(config.Classifier),
 		logger:     logger,
+		notify:     config.Notify,
+
+		blocksProcessed:     metrics.Counter("cashwhale_blocks_processed_total", "Number of blocks processed."),
+		transactionsScanned: metrics.Counter("cashwhale_transactions_scanned_total", "Number of transactions checked for whales."),
+		coinbaseSkipped:     metrics.Counter("cashwhale_coinbase_skipped_total", "Number of coinbase transactions excluded from whales and TX stats."),
+		txClassified:        metrics.Counter("cashwhale_transactions_classified_total", "Number of transactions per type.", "type"),
+		whalesDetected:      metrics.Counter("cashwhale_whales_detected_total", "Number of whale transactions detected.", "rule"),
+	}
+	if err := watcher.SetThresholds(config.Thresholds); err != nil {
+		return nil, err
+	} else if err = watcher.SetRuleTypes(config.RuleTypes); err != nil {
+		return nil, err
 	}
 
 	// add dummy tweet so we always have a LastTweet value (in case we never start sending)
@@ -36,54 +97,152 @@ func NewWatcher(logger log.Logger, monitor *monitoring.HttpMonitoring, counter *
 	return watcher, nil
 }
 
+// SetRecordOnly disables publishing. Whales are only stored in the whale database.
+// Call this before checking any blocks.
+func (w *Watcher) SetRecordOnly(recordOnly bool) {
+	w.recordOnly = recordOnly
+	w.miners.SetRecordOnly(recordOnly)
+}
+
+// SetMinerTracker sets the tracker of the pools that mined blocks and their payouts.
+// Call this before checking any blocks.
+func (w *Watcher) SetMinerTracker(miners *miner.MinerTracker) {
+	w.miners = miners
+	w.miners.SetRecordOnly(w.recordOnly)
+}
+
+// CheckBlock checks all transactions of a new block.
+func (w *Watcher) CheckBlock(block *parser.Block) {
+	w.CheckBlockAt(block, time.Now())
+}
+
+// CheckBlockAt checks all transactions of a block mined at the given time (for historical blocks).
+func (w *Watcher) CheckBlockAt(block *parser.Block, when time.Time) {
+	for i := range block.Tx {
+		w.checkTransaction(block.Tx[i], when)
+	}
+	w.BlockChecked()
+}
+
+// CheckTransactions checks a part of the transactions of a new block.
+// Call BlockChecked after the last part of the block.
+func (w *Watcher) CheckTransactions(txs []*parser.Transaction) {
+	now := time.Now()
+	for i := range txs {
+		w.checkTransaction(txs[i], now)
+	}
+}
+
+// CheckUnconfirmedTransactions checks new TX of the mempool. Whales are published as unconfirmed
+// and updated when they are checked again in their block. Only TX in blocks are counted.
+func (w *Watcher) CheckUnconfirmedTransactions(txs []*parser.Transaction) {
+	now := time.Now()
+	for i := range txs {
+		w.checkUnconfirmedTransaction(txs[i], now)
+	}
+}
+
+// BlockChecked finishes checking a block.
+func (w *Watcher) BlockChecked() {
+	w.blocksProcessed.Inc()
+	if !w.recordOnly {
+		w.CheckLastTweetTime()
+	}
+}
+
 // CheckTransaction will see if it's a big transaction to tweet about.
-func (w *Watcher) CheckTransaction(tx *bitcoin.RawTransaction) {
-	// check if it's a Coinbase TX
-	inputs := tx.Vin
-	if len(inputs) == 0 { // can't happen
+func (w *Watcher) CheckTransaction(tx *parser.Transaction) {
+	w.checkTransaction(tx, time.Now())
+}
+
+func (w *Watcher) checkTransaction(tx *parser.Transaction, when time.Time) {
+	w.transactionsScanned.Inc()
+	if len(tx.Inputs) == 0 { // can't happen
 		w.logger.Errorf("TX has 0 inputs. block height %d, hash (reversed) %s", tx.BlockHeight, tx.Hash)
 		return
 	}
-	/*
-		inputHash, err := chainhash.NewHash(inputs[0].GetOutpoint().GetHash())
-		if err != nil {
-			gc.logger.Errorf("Error getting input hash of TX %+v", err)
-			continue
-		} else if (inputHash.IsEqual(&chainhash.Hash{})) {
-			continue // Coinbase TX has no input
-		}
-	*/
-
-	// loop through TX outputs and find big transactions
-	//fee := getTransactionFee(tx)
-	fee := tx.Fee
-
-	outputs := tx.Vout
-	var amountBCH float64 = 0.0
-	for _, out := range outputs {
-		// TODO add a filter if outputAddress in [previousInputAddress, ...] and deduct it
-		// last address is usually change address
-		//amountBCH += price.SatoshiToBitcoin(out.GetValue())
-		amountBCH += out.Value
-	}
-	w.counter.AddTransaction(float32(amountBCH))
-	if amountBCH < viper.GetFloat64("Message.WahleThresholdBCH") {
-		//if gc.counter.GetTransactionCount() < viper.GetInt("Average.MinTxCount") || amountBCH < float64(gc.counter.GetAverageTransactionSize()) * viper.GetFloat64("Average.AverageTxFactor") {
-		if w.counter.GetTransactionCount() < viper.GetInt("Average.MinTxCount") || amountBCH < float64(w.counter.GetUpperTransactionSizePercent(float32(viper.GetFloat64("Average.UpperTxPercent")))) {
-			return
-		}
+	if tx.IsCoinbase() {
+		// block rewards are no transfers, so they are neither whales nor part of the average TX size
+		w.coinbaseSkipped.Inc()
+		w.miners.CheckCoinbase(tx)
+		return
 	}
 
+	// TODO add a filter if outputAddress in [previousInputAddress, ...] and deduct it
+	// last address is usually change address
+	amount := tx.OutputValue()
+	w.counter.AddTransactionAt(amount, when)
+	txType := w.classifier.Classify(tx)
+	w.txClassified.Inc(string(txType))
+	rule := w.matchRule(amount, txType)
+	if len(rule) == 0 {
+		w.miners.CheckPayout(tx) // whales that are payouts are only posted as whales
+		return
+	}
+	w.whalesDetected.Inc(rule)
+
 	txData := &social.TransactionData{
-		AmountBchRaw: amountBCH,
-		//FeeBch:       price.SatoshiToBitcoin(fee),
-		FeeBch: float64(fee),
-		Hash:   tx.Hash,
+		AmountRaw:   amount,
+		FeeRaw:      tx.Fee(),
+		Hash:        tx.Hash,
+		Confirmed:   true,
+		BlockHeight: tx.BlockHeight,
+		Detected:    when,
+		Rule:        rule,
+		TxType:      string(txType),
+		Labels:      []string{"confirmed"},
+	}
+	if pool := w.miners.WhalePayout(tx); pool != nil {
+		txData.Pool = pool.Name
+		txData.Labels = append(txData.Labels, miner.LABEL_MINER_PAYOUT)
+	}
+	if w.recordOnly {
+		// the current price would be wrong for old TX, so we don't create a message
+		txData.Labels = append(txData.Labels, "backfill")
+		w.msgBuilder.RecordTransaction(txData)
+		return
+	}
+	w.sendWhale(txData)
+}
+
+// Checks a TX of the mempool. It's not counted, because it's checked again in its block.
+func (w *Watcher) checkUnconfirmedTransaction(tx *parser.Transaction, when time.Time) {
+	if w.recordOnly || len(tx.Inputs) == 0 || tx.IsCoinbase() {
+		return
 	}
+	amount := tx.OutputValue()
+	txType := w.classifier.Classify(tx)
+	rule := w.matchRule(amount, txType)
+	if len(rule) == 0 {
+		return
+	}
+
+	txData := &social.TransactionData{
+		AmountRaw: amount,
+		FeeRaw:    tx.Fee(),
+		Hash:      tx.Hash,
+		Confirmed: false,
+		Detected:  when,
+		Rule:      rule,
+		TxType:    string(txType),
+		Labels:    []string{"unconfirmed"},
+	}
+	if pool := w.miners.PayoutPool(tx); pool != nil {
+		txData.Pool = pool.Name
+		txData.Labels = append(txData.Labels, miner.LABEL_MINER_PAYOUT)
+	}
+	w.sendWhale(txData)
+}
+
+// Creates the message of the whale, streams it and sends it to all publishers.
+func (w *Watcher) sendWhale(txData *social.TransactionData) {
 	err := w.msgBuilder.CreateMessage(txData)
+	w.msgBuilder.StreamTransaction(txData) // also stream whales we couldn't create a message for
 	if err == nil {
 		err = w.msgBuilder.SendMessage(txData)
-		if err != nil {
+		if err == social.ErrTransactionSuppressed {
+			w.logger.Infof("Skipped suppressed TX %s", txData.Hash)
+		} else if err != nil {
 			w.logger.Errorf("Error sending message %+v", err)
 		} else if w.monitor != nil {
 			w.monitor.AddEvent("LastTweet", monitoring.D{
@@ -94,7 +253,68 @@ func (w *Watcher) CheckTransaction(tx *bitcoin.RawTransaction) {
 	}
 }
 
+// Returns the name of the first rule that identifies a TX of this amount and type as whale or an empty string.
+func (w *Watcher) matchRule(amount price.Amount, txType TxType) string {
+	w.configLock.Lock()
+	thresholds, ruleTypes := w.thresholds, w.ruleTypes
+	w.configLock.Unlock()
+	if amount >= price.NewAmount(thresholds.WhaleBch) && ruleTypes[RULE_THRESHOLD].Allows(txType) {
+		return RULE_THRESHOLD
+	}
+	//if gc.counter.GetTransactionCount() < viper.GetInt("Average.MinTxCount") || amountBCH < float64(gc.counter.GetAverageTransactionSize()) * viper.GetFloat64("Average.AverageTxFactor") {
+	if w.counter.GetTransactionCount() >= thresholds.MinTxCount && amount >= w.counter.GetUpperTransactionSizePercent(float32(thresholds.UpperTxPercent)) &&
+		ruleTypes[RULE_UPPER_PERCENT].Allows(txType) {
+		return RULE_UPPER_PERCENT
+	}
+	return ""
+}
+
+// GetThresholds returns the current values of the whale rules.
+func (w *Watcher) GetThresholds() Thresholds {
+	w.configLock.Lock()
+	defer w.configLock.Unlock()
+	return w.thresholds
+}
+
+// SetThresholds changes the values of the whale rules until the next restart or config reload.
+func (w *Watcher) SetThresholds(thresholds Thresholds) error {
+	if thresholds.WhaleBch <= 0.0 {
+		return errors.New("whale threshold must be positive")
+	} else if thresholds.UpperTxPercent <= 0.0 || thresholds.UpperTxPercent > 100.0 {
+		return errors.New("upper TX percent must be in (0, 100]")
+	} else if thresholds.MinTxCount < 0 {
+		return errors.New("min TX count must not be negative")
+	}
+	w.configLock.Lock()
+	w.thresholds = thresholds
+	w.configLock.Unlock()
+	w.counter.SetUpperTxPercent(thresholds.UpperTxPercent) // report the same upper percent to monitoring
+	return nil
+}
+
+// SetRuleTypes changes the TX types the rules apply to until the next restart or config reload.
+// Rules without types apply to all types.
+func (w *Watcher) SetRuleTypes(ruleTypes map[string]*RuleTypes) error {
+	if err := ValidateRuleTypes(ruleTypes); err != nil {
+		return err
+	}
+	w.configLock.Lock()
+	defer w.configLock.Unlock()
+	w.ruleTypes = ruleTypes
+	return nil
+}
+
+// SetNotifyReceivers replaces the receivers of the 'tweets stopped' notification.
+func (w *Watcher) SetNotifyReceivers(notify []*notification.NotificationReceiver) {
+	w.configLock.Lock()
+	defer w.configLock.Unlock()
+	w.notify = notify
+}
+
 func (w *Watcher) CheckLastTweetTime() {
+	if w.monitor == nil {
+		return // monitoring disabled
+	}
 	lastTweet := w.monitor.GetEvent("LastTweet")
 	if lastTweet == nil {
 		w.logger.Errorf("No LastTweet event found. Monitoring will not work")
@@ -102,24 +322,22 @@ func (w *Watcher) CheckLastTweetTime() {
 	}
 
 	lastTweetTime := time.Unix(lastTweet.When, 0)
-	threshold := time.Duration(viper.GetInt("Monitoring.TweetThresholdH"))
-	if lastTweetTime.Add(threshold * time.Hour).After(time.Now()) {
+	if lastTweetTime.Add(w.config.TweetThreshold).After(time.Now()) {
 		return
 	}
 
-	// TODO move config loading to a better place. Errors won't happen often though
-	notifier := make([]*notification.NotificationReceiver, 0, 5)
-	err := viper.UnmarshalKey("Notify", &notifier)
-	if err != nil {
-		w.logger.Errorf("Error reading notifier config %+v", err)
-		return
-	}
+	w.configLock.Lock()
+	notifier := w.notify
+	w.configLock.Unlock()
 
-	sendData := notification.NewNotification(fmt.Sprintf("%s tweets stopped", viper.GetString("App.Name")),
+	sendData := notification.NewNotification(fmt.Sprintf("%s tweets stopped", w.config.Notifier.AppName),
 		fmt.Sprintf("Last tweet: %s ago", time.Since(lastTweetTime)))
 
 	for _, notify := range notifier {
-		_, err = notification.CreateAndSendNotification(sendData, notify)
+		if len(notify.Method) == 0 {
+			continue // disabled
+		}
+		_, err := notification.CreateAndSendNotification(sendData, notify, w.config.Notifier)
 		if err != nil {
 			w.logger.Errorf("Error sending 'tweets stopped' notification %+v", err)
 			return
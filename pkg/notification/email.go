@@ -1,11 +1,13 @@
 package notification
 
 import (
+	"bytes"
+	"crypto/rand"
 	"crypto/tls"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"github.com/pkg/errors"
-	"github.com/spf13/viper"
 	"net"
 	"net/mail"
 	"net/smtp"
@@ -16,17 +18,29 @@ import (
 // ensure we always implement Notifier (compile error otherwise)
 var _ Notifier = (*Email)(nil)
 
+// SmtpSecurity is the way we connect to the SMTP server.
+type SmtpSecurity string
+
+const (
+	SMTP_SECURITY_TLS      SmtpSecurity = "tls"      // implicit TLS, usually port 465
+	SMTP_SECURITY_STARTTLS SmtpSecurity = "starttls" // upgrade a plain connection, usually port 587
+	SMTP_SECURITY_PLAIN    SmtpSecurity = "plain"    // no encryption, only for local relays
+)
+
 type Email struct {
 	config EmailConfig
 }
 
 type EmailConfig struct {
+	NotifierConfig
+
 	// SMTP config of our mailbox for outgoing mail
 	SmtpHost        string
 	SmtpPort        int
+	Security        SmtpSecurity // defaults to implicit TLS
 	AllowSelfSigned bool
 	FromAddress     string
-	FromPassword    string
+	FromPassword    string // can be empty for plain local relays without authentication
 
 	RecAddress string // receiver. can be comma-separated list
 }
@@ -37,10 +51,21 @@ func (c *EmailConfig) Address() string {
 }
 
 func NewEmail(config EmailConfig) (*Email, error) {
+	if len(config.Security) == 0 {
+		config.Security = SMTP_SECURITY_TLS
+	}
+	switch config.Security {
+	case SMTP_SECURITY_TLS, SMTP_SECURITY_STARTTLS, SMTP_SECURITY_PLAIN:
+	default:
+		return nil, errors.New(fmt.Sprintf("invalid SMTP security mode '%s' - must be tls, starttls or plain", config.Security))
+	}
+
 	if len(config.SmtpHost) < 4 || config.SmtpPort <= 0 {
 		return nil, errors.New("invalid Email SMTP config")
-	} else if len(config.FromAddress) < 5 || len(config.FromPassword) == 0 {
+	} else if len(config.FromAddress) < 5 {
 		return nil, errors.New("missing/invalid SMTP Email account to send mail")
+	} else if len(config.FromPassword) == 0 && config.Security != SMTP_SECURITY_PLAIN {
+		return nil, errors.New("missing SMTP Email password to send mail")
 	} else if len(config.RecAddress) < 5 {
 		return nil, errors.New("receiver Email is missing")
 	}
@@ -50,32 +75,21 @@ func NewEmail(config EmailConfig) (*Email, error) {
 }
 
 func (e *Email) SendNotification(notification *Notification) error {
-	notification.prepare()
+	notification.prepare(e.config.AppName)
 
-	to := strings.Split(e.config.RecAddress, ",")
-	for i, _ := range to {
-		to[i] = strings.TrimSpace(to[i])
+	to := e.getReceivers()
+	mailer := NewMailer(e.config.AllowSelfSigned, e.config.Security, e.config.ConnectTimeout)
+	message, err := e.buildMessage(mailer, notification, to)
+	if err != nil {
+		return errors.Wrap(err, "error creating Email")
 	}
 
-	mailer := NewMailer(e.config.AllowSelfSigned)
-	header := make(map[string]string)
-	header["From"] = e.config.FromAddress
-	header["To"] = to[0]
-	header["Subject"] = mailer.EncodeRFC2047(notification.Title)
-	header["MIME-Version"] = "1.0"
-	header["Content-Type"] = "text/plain; charset=\"utf-8\""
-	header["Content-Transfer-Encoding"] = "base64"
-
-	message := ""
-	for k, v := range header {
-		message += fmt.Sprintf("%s: %s\r\n", k, v)
+	var auth smtp.Auth
+	if len(e.config.FromPassword) != 0 {
+		auth = smtp.PlainAuth("", e.config.FromAddress, e.config.FromPassword, e.config.SmtpHost)
 	}
-	body := notification.Text
-	message += "\r\n" + base64.StdEncoding.EncodeToString([]byte(body))
 
-	auth := smtp.PlainAuth("", e.config.FromAddress, e.config.FromPassword, e.config.SmtpHost)
-
-	err := mailer.SendMail(e.config.Address(), auth, e.config.FromAddress, to, []byte(message))
+	err = mailer.SendMail(e.config.Address(), auth, e.config.FromAddress, to, message)
 	if err != nil {
 		return errors.Wrap(err, "error sending Email")
 	}
@@ -83,27 +97,124 @@ func (e *Email) SendNotification(notification *Notification) error {
 	return nil
 }
 
+func (e *Email) getReceivers() []string {
+	to := strings.Split(e.config.RecAddress, ",")
+	receivers := make([]string, 0, len(to))
+	for _, addr := range to {
+		addr = strings.TrimSpace(addr)
+		if len(addr) != 0 {
+			receivers = append(receivers, addr)
+		}
+	}
+	return receivers
+}
+
+// Build the full message including headers. Headers are always written in the same order.
+// If the notification contains HTML we send a multipart/alternative message with a plain text part
+// for clients that can't display HTML.
+func (e *Email) buildMessage(mailer *Mailer, notification *Notification, to []string) ([]byte, error) {
+	header := []mailHeader{
+		{"From", e.config.FromAddress},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mailer.EncodeRFC2047(notification.Title)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+	}
+
+	var body bytes.Buffer
+	if len(notification.Html) == 0 {
+		header = append(header,
+			mailHeader{"Content-Type", "text/plain; charset=\"utf-8\""},
+			mailHeader{"Content-Transfer-Encoding", "base64"},
+		)
+		body.WriteString(encodeBase64Lines(notification.Text))
+	} else {
+		boundary, err := newBoundary()
+		if err != nil {
+			return nil, err
+		}
+		header = append(header, mailHeader{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=\"%s\"", boundary)})
+
+		parts := []struct {
+			contentType string
+			content     string
+		}{
+			{"text/plain", notification.Text},
+			{"text/html", notification.Html},
+		}
+		for _, part := range parts {
+			body.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+			body.WriteString(fmt.Sprintf("Content-Type: %s; charset=\"utf-8\"\r\n", part.contentType))
+			body.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+			body.WriteString(encodeBase64Lines(part.content))
+			body.WriteString("\r\n")
+		}
+		body.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+	}
+
+	var message bytes.Buffer
+	for _, h := range header {
+		if err := mailer.validateLine(h.value); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid %s header", h.key))
+		}
+		message.WriteString(fmt.Sprintf("%s: %s\r\n", h.key, h.value))
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+type mailHeader struct {
+	key   string
+	value string
+}
+
+// Encode the string as base64 with line breaks after 76 chars as required by RFC 2045.
+func encodeBase64Lines(str string) string {
+	encoded := base64.StdEncoding.EncodeToString([]byte(str))
+	var lines strings.Builder
+	for len(encoded) > 76 {
+		lines.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	lines.WriteString(encoded)
+	return lines.String()
+}
+
+func newBoundary() (string, error) {
+	buf := make([]byte, 15)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "error creating MIME boundary")
+	}
+	return "cashwhale-" + hex.EncodeToString(buf), nil
+}
+
 type Mailer struct {
 	localName              string // localhost
 	dialTimeout            time.Duration
 	allowSelfSignedTlsCert bool
+	security               SmtpSecurity
 }
 
-func NewMailer(allowSelfSignedTlsCert bool) *Mailer {
-	timeoutSec := viper.GetInt("Email.ConnectTimeoutSec")
-	if timeoutSec <= 0 {
-		timeoutSec = 10
+func NewMailer(allowSelfSignedTlsCert bool, security SmtpSecurity, dialTimeout time.Duration) *Mailer {
+	if dialTimeout <= 0 {
+		dialTimeout = defaultTimeout
+	}
+	if len(security) == 0 {
+		security = SMTP_SECURITY_TLS
 	}
 	return &Mailer{
 		localName:              "localhost",
-		dialTimeout:            time.Duration(timeoutSec) * time.Second,
+		dialTimeout:            dialTimeout,
 		allowSelfSignedTlsCert: allowSelfSignedTlsCert,
+		security:               security,
 	}
 }
 
 // Drop-in replacement for official net/smtp.SendMail() with:
 // - a connect-timeout of 10 seconds
-// - using implicit TLS instead of upgrading via STARTTLS
+// - using implicit TLS, STARTTLS or a plain connection depending on the security mode
+// - auth being optional (pass nil for relays without authentication)
 func (m *Mailer) SendMail(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
 	host, _, err := net.SplitHostPort(addr)
 	if err != nil {
@@ -113,10 +224,6 @@ func (m *Mailer) SendMail(addr string, auth smtp.Auth, from string, to []string,
 		ServerName:         host,
 		InsecureSkipVerify: m.allowSelfSignedTlsCert,
 	}
-	if err = m.validateLine(from); err != nil {
-		return err
-	}
-
 	if err := m.validateLine(from); err != nil {
 		return err
 	}
@@ -129,7 +236,12 @@ func (m *Mailer) SendMail(addr string, auth smtp.Auth, from string, to []string,
 	dialer := &net.Dialer{
 		Timeout: m.dialTimeout,
 	}
-	conn, err := tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	var conn net.Conn
+	if m.security == SMTP_SECURITY_TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
 	if err != nil {
 		return err
 	}
@@ -143,8 +255,19 @@ func (m *Mailer) SendMail(addr string, auth smtp.Auth, from string, to []string,
 	if err = c.Hello(m.localName); err != nil {
 		return err
 	}
-	if err = c.Auth(auth); err != nil {
-		return err
+	if m.security == SMTP_SECURITY_STARTTLS {
+		// never fall back to plain text if the server doesn't support it
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp: server doesn't support STARTTLS")
+		}
+		if err = c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
 	}
 	if err = c.Mail(from); err != nil {
 		return err
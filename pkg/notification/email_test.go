@@ -0,0 +1,339 @@
+package notification
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A received mail of our SMTP stand-in.
+type testSmtpMessage struct {
+	from string
+	to   []string
+	data string
+	auth bool
+	tls  bool
+}
+
+// A minimal in-process SMTP server supporting implicit TLS, STARTTLS and AUTH PLAIN.
+type testSmtpServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	startTLS  bool // advertise STARTTLS on plain connections
+	messages  chan *testSmtpMessage
+}
+
+func newTestSmtpServer(t *testing.T, security SmtpSecurity, startTLS bool) *testSmtpServer {
+	server := &testSmtpServer{
+		tlsConfig: newTestTlsConfig(t),
+		startTLS:  startTLS,
+		messages:  make(chan *testSmtpMessage, 1),
+	}
+	var err error
+	if security == SMTP_SECURITY_TLS {
+		server.listener, err = tls.Listen("tcp", "127.0.0.1:0", server.tlsConfig)
+	} else {
+		server.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	if err != nil {
+		t.Fatalf("Error starting SMTP stand-in: %+v", err)
+	}
+	go server.serve(security == SMTP_SECURITY_TLS)
+	return server
+}
+
+func (s *testSmtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *testSmtpServer) close() {
+	s.listener.Close()
+}
+
+func (s *testSmtpServer) serve(implicitTls bool) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn, implicitTls)
+	}
+}
+
+func (s *testSmtpServer) handle(conn net.Conn, isTls bool) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	msg := &testSmtpMessage{tls: isTls}
+	text.PrintfLine("220 localhost ESMTP stand-in")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			text.PrintfLine("250-localhost")
+			if s.startTLS && !msg.tls {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			text.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			msg.tls = true
+		case "AUTH":
+			msg.auth = true
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(line[5:], "FROM:"), "<>")
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(line[5:], "TO:"), "<>"))
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 send data")
+			data, err := ioutil.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			msg.data = string(data)
+			text.PrintfLine("250 queued")
+			s.messages <- msg
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func newTestTlsConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %+v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %+v", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+}
+
+func newTestEmail(t *testing.T, server *testSmtpServer, security SmtpSecurity, password string) *Email {
+	email, err := NewEmail(EmailConfig{
+		SmtpHost:        "127.0.0.1",
+		SmtpPort:        server.port(),
+		Security:        security,
+		AllowSelfSigned: true,
+		FromAddress:     "bot@example.com",
+		FromPassword:    password,
+		RecAddress:      "alice@example.com, bob@example.com",
+	})
+	if err != nil {
+		t.Fatalf("Error creating Email: %+v", err)
+	}
+	return email
+}
+
+func receiveTestMessage(t *testing.T, server *testSmtpServer) *testSmtpMessage {
+	select {
+	case msg := <-server.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SMTP stand-in didn't receive a message")
+		return nil
+	}
+}
+
+func TestSendEmailSecurityModes(t *testing.T) {
+	tests := []struct {
+		security SmtpSecurity
+		password string
+		wantTls  bool
+		wantAuth bool
+	}{
+		{SMTP_SECURITY_TLS, "secret", true, true},
+		{SMTP_SECURITY_STARTTLS, "secret", true, true},
+		{SMTP_SECURITY_PLAIN, "", false, false},
+		{SMTP_SECURITY_PLAIN, "secret", false, true}, // PlainAuth allows localhost without TLS
+	}
+
+	for _, test := range tests {
+		server := newTestSmtpServer(t, test.security, true)
+		email := newTestEmail(t, server, test.security, test.password)
+		err := email.SendNotification(NewNotification("Whale", "A big one"))
+		if err != nil {
+			server.close()
+			t.Fatalf("Error sending %s mail: %+v", test.security, err)
+		}
+
+		msg := receiveTestMessage(t, server)
+		server.close()
+		if msg.tls != test.wantTls {
+			t.Errorf("%s: TLS used %v, want %v", test.security, msg.tls, test.wantTls)
+		}
+		if msg.auth != test.wantAuth {
+			t.Errorf("%s: AUTH used %v, want %v", test.security, msg.auth, test.wantAuth)
+		}
+		if msg.from != "bot@example.com" {
+			t.Errorf("%s: unexpected sender %s", test.security, msg.from)
+		}
+		if strings.Join(msg.to, ",") != "alice@example.com,bob@example.com" {
+			t.Errorf("%s: unexpected recipients %v", test.security, msg.to)
+		}
+	}
+}
+
+func TestSendEmailStartTlsRequired(t *testing.T) {
+	server := newTestSmtpServer(t, SMTP_SECURITY_STARTTLS, false)
+	defer server.close()
+	email := newTestEmail(t, server, SMTP_SECURITY_STARTTLS, "secret")
+
+	err := email.SendNotification(NewNotification("Whale", "A big one"))
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("Expected STARTTLS error when server doesn't support it, got %v", err)
+	}
+}
+
+func TestSendEmailHeaders(t *testing.T) {
+	server := newTestSmtpServer(t, SMTP_SECURITY_PLAIN, false)
+	defer server.close()
+	email := newTestEmail(t, server, SMTP_SECURITY_PLAIN, "")
+
+	if err := email.SendNotification(NewNotification("Whale", "A big one")); err != nil {
+		t.Fatalf("Error sending mail: %+v", err)
+	}
+	msg := receiveTestMessage(t, server)
+
+	// headers must always be written in the same order
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(msg.data)))
+	keys := make([]string, 0, 7)
+	for {
+		line, err := reader.ReadLine()
+		if err != nil || len(line) == 0 {
+			break
+		}
+		keys = append(keys, strings.SplitN(line, ":", 2)[0])
+	}
+	want := "From,To,Subject,Date,MIME-Version,Content-Type,Content-Transfer-Encoding"
+	if strings.Join(keys, ",") != want {
+		t.Errorf("Unexpected header order %v, want %s", keys, want)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(msg.data))
+	if err != nil {
+		t.Fatalf("Error parsing mail: %+v", err)
+	}
+	to, err := parsed.Header.AddressList("To")
+	if err != nil || len(to) != 2 {
+		t.Fatalf("Expected 2 addresses in To header, got %v (%v)", to, err)
+	}
+	body, _ := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, parsed.Body))
+	if string(body) != "A big one" {
+		t.Errorf("Unexpected body %q", body)
+	}
+}
+
+func TestSendEmailHtml(t *testing.T) {
+	server := newTestSmtpServer(t, SMTP_SECURITY_PLAIN, false)
+	defer server.close()
+	email := newTestEmail(t, server, SMTP_SECURITY_PLAIN, "")
+
+	notification := NewNotification("Whale", "A big one")
+	notification.Html = "<p>A <b>big</b> one " + strings.Repeat("x", 100) + "</p>"
+	if err := email.SendNotification(notification); err != nil {
+		t.Fatalf("Error sending mail: %+v", err)
+	}
+	msg := receiveTestMessage(t, server)
+
+	parsed, err := mail.ReadMessage(strings.NewReader(msg.data))
+	if err != nil {
+		t.Fatalf("Error parsing mail: %+v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Expected multipart/alternative, got %s (%v)", mediaType, err)
+	}
+
+	parts := multipart.NewReader(parsed.Body, params["boundary"])
+	want := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain", "A big one"},
+		{"text/html", notification.Html},
+	}
+	for i, w := range want {
+		part, err := parts.NextPart()
+		if err != nil {
+			t.Fatalf("Error reading part %d: %+v", i, err)
+		}
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if partType != w.contentType {
+			t.Errorf("Part %d has type %s, want %s", i, partType, w.contentType)
+		}
+		content, _ := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		if string(content) != w.content {
+			t.Errorf("Part %d has content %q, want %q", i, content, w.content)
+		}
+	}
+	if _, err := parts.NextPart(); err == nil {
+		t.Errorf("Expected exactly 2 parts in multipart message")
+	}
+}
+
+func TestNewEmailSecurity(t *testing.T) {
+	config := EmailConfig{
+		SmtpHost:    "127.0.0.1",
+		SmtpPort:    25,
+		FromAddress: "bot@example.com",
+		RecAddress:  "alice@example.com",
+	}
+	for _, security := range []SmtpSecurity{"", SMTP_SECURITY_TLS, SMTP_SECURITY_STARTTLS} {
+		config.Security = security
+		if _, err := NewEmail(config); err == nil {
+			t.Errorf("Expected error for missing password with security '%s'", security)
+		}
+	}
+
+	config.Security = SMTP_SECURITY_PLAIN
+	if _, err := NewEmail(config); err != nil {
+		t.Errorf("Plain relay without password should be allowed: %+v", err)
+	}
+	config.Security = "ssl"
+	if _, err := NewEmail(config); err == nil {
+		t.Errorf("Expected error for unknown security mode")
+	}
+}
@@ -2,13 +2,28 @@ package notification
 
 import (
 	"fmt"
-	"github.com/spf13/viper"
+	"time"
 )
 
+// default timeout of HTTP requests and SMTP connections
+const defaultTimeout = 10 * time.Second
+
 type Notification struct {
 	Title               string
 	Text                string
+	Html                string // optional HTML version of Text (only used by Email)
 	RequireConfirmation bool
+
+	// Pushover options. Empty values use the defaults of the receiver config.
+	Priority *int // -2 (lowest) to 2 (emergency, same as RequireConfirmation)
+	Sound    string
+	Url      string // supplementary URL shown below the message
+	UrlTitle string
+
+	// Telegram options. Empty values use the defaults of the receiver config.
+	ParseMode TelegramParseMode
+	Silent    *bool // deliver without sound
+	ThreadID  int   // ID of the topic in forum groups
 }
 
 func NewNotification(title string, text string) *Notification {
@@ -19,6 +34,18 @@ func NewNotification(title string, text string) *Notification {
 	}
 }
 
+// SetPriority sets the Pushover priority of this notification.
+func (n *Notification) SetPriority(priority int) *Notification {
+	n.Priority = &priority
+	return n
+}
+
+// SetSilent sets if this notification is delivered without sound on Telegram.
+func (n *Notification) SetSilent(silent bool) *Notification {
+	n.Silent = &silent
+	return n
+}
+
 // Return the messenger text message containing title + message text to be used for Telegram, etc...
 func (n *Notification) GetMessengerText() string {
 	message := n.Title
@@ -28,9 +55,17 @@ func (n *Notification) GetMessengerText() string {
 	return message
 }
 
-func (n *Notification) prepare() {
-	prefix := fmt.Sprintf("%s: ", viper.GetString("App.Name"))
-	n.Title = prefix + n.Title
+// NotifierConfig are the settings shared by all notifiers.
+type NotifierConfig struct {
+	AppName        string        // prefixed to the title of all notifications
+	Timeout        time.Duration // of HTTP requests, defaults to 10s
+	ConnectTimeout time.Duration // of SMTP connections, defaults to 10s
+}
+
+func (n *Notification) prepare(appName string) {
+	if len(appName) != 0 {
+		n.Title = fmt.Sprintf("%s: %s", appName, n.Title)
+	}
 	if len(n.Text) == 0 {
 		n.Text = "empty text" // some services (Pushover) can't send empty messages
 	}
@@ -20,7 +20,7 @@ func TestSendNotification(t *testing.T) {
 	sendData := NewNotification(fmt.Sprintf("%s test notification", viper.GetString("App.Name")), "test message")
 
 	for _, notify := range notifier {
-		_, err = CreateAndSendNotification(sendData, notify)
+		_, err = CreateAndSendNotification(sendData, notify, NotifierConfig{AppName: viper.GetString("App.Name")})
 		if err != nil {
 			t.Fatalf("Error sending test notification %+v", err)
 			return
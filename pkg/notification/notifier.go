@@ -3,7 +3,6 @@ package notification
 import (
 	"fmt"
 	"github.com/pkg/errors"
-	"github.com/spf13/viper"
 	"net/http"
 	"time"
 )
@@ -12,12 +11,18 @@ type Notifier interface {
 	SendNotification(notification *Notification) error
 }
 
-func CreateAndSendNotification(sendData *Notification, notify *NotificationReceiver) (Notifier, error) {
+// CreateAndSendNotification creates the notifier of the receiver and sends the notification.
+func CreateAndSendNotification(sendData *Notification, notify *NotificationReceiver, config NotifierConfig) (Notifier, error) {
 	switch notify.Method {
 	case "pushover":
 		push, err := NewPushover(PushoverConfig{
-			AppToken: notify.AppToken,
-			Receiver: notify.Receiver,
+			NotifierConfig: config,
+			AppToken:       notify.AppToken,
+			Receiver:       notify.Receiver,
+			Priority:       notify.Priority,
+			Sound:          notify.Sound,
+			Url:            notify.Url,
+			UrlTitle:       notify.UrlTitle,
 		})
 		if err != nil {
 			return nil, err
@@ -30,8 +35,12 @@ func CreateAndSendNotification(sendData *Notification, notify *NotificationRecei
 
 	case "telegram":
 		tele, err := NewTelegram(TelegramConfig{
-			Token:   notify.Token,
-			Channel: notify.Channel,
+			NotifierConfig: config,
+			Token:          notify.Token,
+			Channel:        notify.Channel,
+			ParseMode:      notify.ParseMode,
+			Silent:         notify.Silent,
+			ThreadID:       notify.ThreadID,
 		})
 		if err != nil {
 			return nil, err
@@ -44,8 +53,10 @@ func CreateAndSendNotification(sendData *Notification, notify *NotificationRecei
 
 	case "email":
 		email, err := NewEmail(EmailConfig{
+			NotifierConfig:  config,
 			SmtpHost:        notify.SmtpHost,
 			SmtpPort:        notify.SmtpPort,
+			Security:        notify.SmtpSecurity,
 			AllowSelfSigned: notify.AllowSelfSigned,
 			FromAddress:     notify.FromAddress,
 			FromPassword:    notify.FromPassword,
@@ -77,24 +88,35 @@ type NotificationReceiver struct {
 	Method NotificationMethod `mapstructure:"Method"`
 
 	// Email
-	SmtpHost        string `mapstructure:"SmtpHost"`
-	SmtpPort        int    `mapstructure:"SmtpPort"`
-	AllowSelfSigned bool   `mapstructure:"AllowSelfSigned"`
-	FromAddress     string `mapstructure:"FromAddress"`
-	FromPassword    string `mapstructure:"FromPassword"`
-	RecAddress      string `mapstructure:"RecAddress"`
+	SmtpHost        string       `mapstructure:"SmtpHost"`
+	SmtpPort        int          `mapstructure:"SmtpPort"`
+	SmtpSecurity    SmtpSecurity `mapstructure:"SmtpSecurity"` // tls|starttls|plain
+	AllowSelfSigned bool         `mapstructure:"AllowSelfSigned"`
+	FromAddress     string       `mapstructure:"FromAddress"`
+	FromPassword    string       `mapstructure:"FromPassword"`
+	RecAddress      string       `mapstructure:"RecAddress"`
 
 	// Pushover
 	AppToken string `mapstructure:"AppToken"`
 	Receiver string `mapstructure:"Receiver"`
+	Priority int    `mapstructure:"Priority"` // -2 to 2
+	Sound    string `mapstructure:"Sound"`
+	Url      string `mapstructure:"Url"`
+	UrlTitle string `mapstructure:"UrlTitle"`
 
 	// Telegram
-	Token   string `mapstructure:"Token"`
-	Channel string `mapstructure:"Channel"`
+	Token     string            `mapstructure:"Token"`
+	Channel   string            `mapstructure:"Channel"`
+	ParseMode TelegramParseMode `mapstructure:"ParseMode"` // MarkdownV2|HTML or empty for plain text
+	Silent    bool              `mapstructure:"Silent"`
+	ThreadID  int               `mapstructure:"ThreadID"`
 }
 
-func getHttpAgent() *http.Client {
+func getHttpAgent(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
 	return &http.Client{
-		Timeout: time.Duration(viper.GetInt("HTTP.RequestTimeoutSec")) * time.Second,
+		Timeout: timeout,
 	}
 }
@@ -6,25 +6,46 @@ import (
 	"github.com/pkg/errors"
 	"io/ioutil"
 	"net/url"
+	"strconv"
 )
 
 // ensure we always implement Notifier (compile error otherwise)
 var _ Notifier = (*Pushover)(nil)
 
-const pushoverApiUrl = "https://api.pushover.net/1/messages.json"
+// replaced in tests
+var pushoverApiUrl = "https://api.pushover.net/1/messages.json"
+
+// Pushover message priorities: https://pushover.net/api#priority
+const (
+	PUSHOVER_PRIORITY_LOWEST    = -2
+	PUSHOVER_PRIORITY_LOW       = -1
+	PUSHOVER_PRIORITY_NORMAL    = 0
+	PUSHOVER_PRIORITY_HIGH      = 1
+	PUSHOVER_PRIORITY_EMERGENCY = 2 // repeated until the user confirms
+)
 
 type Pushover struct {
 	config PushoverConfig
 }
 
 type PushoverConfig struct {
+	NotifierConfig
+
 	AppToken string
 	Receiver string
+
+	// defaults for all messages
+	Priority int
+	Sound    string // one of https://pushover.net/api#sounds
+	Url      string
+	UrlTitle string
 }
 
 func NewPushover(config PushoverConfig) (*Pushover, error) {
 	if len(config.Receiver) < 10 {
 		return nil, errors.New("invalid Pushover receiver token")
+	} else if err := validatePushoverPriority(config.Priority); err != nil {
+		return nil, err
 	}
 	return &Pushover{
 		config: config,
@@ -37,19 +58,12 @@ type PusoverResponse struct {
 }
 
 func (p *Pushover) SendNotification(notification *Notification) error {
-	httpAgent := getHttpAgent()
-	notification.prepare()
+	httpAgent := getHttpAgent(p.config.Timeout)
+	notification.prepare(p.config.AppName)
 
-	data := url.Values{
-		"token":   []string{p.config.AppToken},
-		"user":    []string{p.config.Receiver},
-		"message": []string{notification.Text},
-		"title":   []string{notification.Title},
-	}
-	if notification.RequireConfirmation {
-		data["priority"] = []string{"2"}
-		data["expire"] = []string{"900"} // 15min
-		data["retry"] = []string{"60"}
+	data, err := p.getMessageData(notification)
+	if err != nil {
+		return err
 	}
 
 	resp, err := httpAgent.PostForm(pushoverApiUrl, data)
@@ -73,3 +87,54 @@ func (p *Pushover) SendNotification(notification *Notification) error {
 
 	return nil
 }
+
+// Merge the options of the notification with our receiver defaults.
+func (p *Pushover) getMessageData(notification *Notification) (url.Values, error) {
+	data := url.Values{
+		"token":   []string{p.config.AppToken},
+		"user":    []string{p.config.Receiver},
+		"message": []string{notification.Text},
+		"title":   []string{notification.Title},
+	}
+
+	priority := p.config.Priority
+	if notification.Priority != nil {
+		priority = *notification.Priority
+	}
+	if notification.RequireConfirmation {
+		priority = PUSHOVER_PRIORITY_EMERGENCY
+	}
+	if err := validatePushoverPriority(priority); err != nil {
+		return nil, err
+	}
+	if priority != PUSHOVER_PRIORITY_NORMAL {
+		data["priority"] = []string{strconv.Itoa(priority)}
+	}
+	if priority == PUSHOVER_PRIORITY_EMERGENCY {
+		data["expire"] = []string{"900"} // 15min
+		data["retry"] = []string{"60"}
+	}
+
+	optional := map[string][2]string{
+		"sound":     {notification.Sound, p.config.Sound},
+		"url":       {notification.Url, p.config.Url},
+		"url_title": {notification.UrlTitle, p.config.UrlTitle},
+	}
+	for key, values := range optional {
+		for _, value := range values {
+			if len(value) != 0 {
+				data[key] = []string{value}
+				break
+			}
+		}
+	}
+
+	return data, nil
+}
+
+func validatePushoverPriority(priority int) error {
+	if priority < PUSHOVER_PRIORITY_LOWEST || priority > PUSHOVER_PRIORITY_EMERGENCY {
+		return errors.New(fmt.Sprintf("invalid Pushover priority %d - must be between %d and %d", priority, PUSHOVER_PRIORITY_LOWEST, PUSHOVER_PRIORITY_EMERGENCY))
+	}
+	return nil
+}
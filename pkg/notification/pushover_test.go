@@ -0,0 +1,65 @@
+package notification
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestPushoverOptions(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"status":1,"request":"test"}`))
+	}))
+	defer server.Close()
+	prevUrl := pushoverApiUrl
+	pushoverApiUrl = server.URL
+	defer func() { pushoverApiUrl = prevUrl }()
+
+	push, err := NewPushover(PushoverConfig{
+		AppToken: "app-token",
+		Receiver: "receiver-token",
+		Priority: PUSHOVER_PRIORITY_HIGH,
+		Sound:    "cashregister",
+		Url:      "https://example.com",
+	})
+	if err != nil {
+		t.Fatalf("Error creating Pushover: %+v", err)
+	}
+
+	// receiver defaults
+	if err = push.SendNotification(NewNotification("title", "text")); err != nil {
+		t.Fatalf("Error sending Pushover message: %+v", err)
+	}
+	if form.Get("priority") != "1" || form.Get("sound") != "cashregister" || form.Get("url") != "https://example.com" || form.Get("url_title") != "" {
+		t.Errorf("Unexpected receiver default options: %v", form)
+	}
+
+	// message options override receiver defaults
+	notification := NewNotification("title", "text").SetPriority(PUSHOVER_PRIORITY_LOW)
+	notification.Sound = "none"
+	notification.UrlTitle = "View TX"
+	if err = push.SendNotification(notification); err != nil {
+		t.Fatalf("Error sending Pushover message: %+v", err)
+	}
+	if form.Get("priority") != "-1" || form.Get("sound") != "none" || form.Get("url_title") != "View TX" || form.Get("expire") != "" {
+		t.Errorf("Unexpected message options: %v", form)
+	}
+
+	// confirmation requires emergency priority with retry settings
+	notification = NewNotification("title", "text")
+	notification.RequireConfirmation = true
+	if err = push.SendNotification(notification); err != nil {
+		t.Fatalf("Error sending Pushover message: %+v", err)
+	}
+	if form.Get("priority") != "2" || form.Get("expire") == "" || form.Get("retry") == "" {
+		t.Errorf("Unexpected emergency options: %v", form)
+	}
+
+	if _, err = NewPushover(PushoverConfig{Receiver: "receiver-token", Priority: 3}); err == nil {
+		t.Errorf("Expected error for invalid priority")
+	}
+}
@@ -7,20 +7,48 @@ import (
 	"io/ioutil"
 	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
 // ensure we always implement Notifier (compile error otherwise)
 var _ Notifier = (*Telegram)(nil)
 
-const telegramApiUrl = "https://api.telegram.org/bot%s/sendMessage?%s"
+// replaced in tests
+var telegramApiUrl = "https://api.telegram.org/bot%s/sendMessage?%s"
+
+// TelegramParseMode is the formatting of Telegram messages: https://core.telegram.org/bots/api#formatting-options
+type TelegramParseMode string
+
+const (
+	TELEGRAM_PARSE_MODE_TEXT       TelegramParseMode = "" // plain text, no formatting
+	TELEGRAM_PARSE_MODE_MARKDOWNV2 TelegramParseMode = "MarkdownV2"
+	TELEGRAM_PARSE_MODE_HTML       TelegramParseMode = "HTML"
+)
+
+// characters that must be escaped with a preceding '\' in MarkdownV2
+var telegramMarkdownV2Replacer = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+	"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=",
+	"|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+var telegramHtmlReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
 
 type Telegram struct {
 	config TelegramConfig
 }
 
 type TelegramConfig struct {
+	NotifierConfig
+
 	Token   string // received by talking to @BotFather
 	Channel string // channel ID or user ID
+
+	// defaults for all messages
+	ParseMode TelegramParseMode
+	Silent    bool // deliver without sound
+	ThreadID  int  // ID of the topic in forum groups
 }
 
 func NewTelegram(config TelegramConfig) (*Telegram, error) {
@@ -34,6 +62,9 @@ func NewTelegram(config TelegramConfig) (*Telegram, error) {
 	if isNumeric == false && config.Channel[:1] != "@" {
 		return nil, errors.New("Telegram channel ID must start with @ or be a numeric channel ID from: curl -X POST https://api.telegram.org/bot[BOT_API_KEY]/getUpdates")
 	}
+	if err := validateTelegramParseMode(config.ParseMode); err != nil {
+		return nil, err
+	}
 	return &Telegram{
 		config: config,
 	}, nil
@@ -46,12 +77,12 @@ type TelegramResponse struct {
 }
 
 func (t *Telegram) SendNotification(notification *Notification) error {
-	httpAgent := getHttpAgent()
-	notification.prepare()
+	httpAgent := getHttpAgent(t.config.Timeout)
+	notification.prepare(t.config.AppName)
 
-	data := url.Values{
-		"chat_id": []string{t.config.Channel},
-		"text":    []string{notification.GetMessengerText()},
+	data, err := t.getMessageData(notification)
+	if err != nil {
+		return err
 	}
 
 	urlStr := fmt.Sprintf(telegramApiUrl, t.config.Token, data.Encode())
@@ -76,3 +107,79 @@ func (t *Telegram) SendNotification(notification *Notification) error {
 
 	return nil
 }
+
+// Merge the options of the notification with our receiver defaults.
+func (t *Telegram) getMessageData(notification *Notification) (url.Values, error) {
+	parseMode := t.config.ParseMode
+	if len(notification.ParseMode) != 0 {
+		parseMode = notification.ParseMode
+	}
+	if err := validateTelegramParseMode(parseMode); err != nil {
+		return nil, err
+	}
+
+	data := url.Values{
+		"chat_id": []string{t.config.Channel},
+		"text":    []string{t.getFormattedText(notification, parseMode)},
+	}
+	if parseMode != TELEGRAM_PARSE_MODE_TEXT {
+		data["parse_mode"] = []string{string(parseMode)}
+	}
+	silent := t.config.Silent
+	if notification.Silent != nil {
+		silent = *notification.Silent
+	}
+	if silent {
+		data["disable_notification"] = []string{"true"}
+	}
+	threadID := t.config.ThreadID
+	if notification.ThreadID != 0 {
+		threadID = notification.ThreadID
+	}
+	if threadID != 0 {
+		data["message_thread_id"] = []string{strconv.Itoa(threadID)}
+	}
+
+	return data, nil
+}
+
+// Returns the escaped title + text in the given parse mode. The title is shown in bold.
+func (t *Telegram) getFormattedText(notification *Notification, parseMode TelegramParseMode) string {
+	switch parseMode {
+	case TELEGRAM_PARSE_MODE_MARKDOWNV2:
+		message := "*" + EscapeTelegramMarkdownV2(notification.Title) + "*"
+		if len(notification.Text) != 0 {
+			message += "\r\n" + EscapeTelegramMarkdownV2(notification.Text)
+		}
+		return message
+
+	case TELEGRAM_PARSE_MODE_HTML:
+		message := "<b>" + EscapeTelegramHtml(notification.Title) + "</b>"
+		if len(notification.Text) != 0 {
+			message += "\r\n" + EscapeTelegramHtml(notification.Text)
+		}
+		return message
+
+	default:
+		return notification.GetMessengerText()
+	}
+}
+
+// EscapeTelegramMarkdownV2 escapes all reserved characters so the text is displayed as-is.
+func EscapeTelegramMarkdownV2(text string) string {
+	return telegramMarkdownV2Replacer.Replace(text)
+}
+
+// EscapeTelegramHtml escapes all HTML entities so the text is displayed as-is.
+func EscapeTelegramHtml(text string) string {
+	return telegramHtmlReplacer.Replace(text)
+}
+
+func validateTelegramParseMode(parseMode TelegramParseMode) error {
+	switch parseMode {
+	case TELEGRAM_PARSE_MODE_TEXT, TELEGRAM_PARSE_MODE_MARKDOWNV2, TELEGRAM_PARSE_MODE_HTML:
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("invalid Telegram parse mode '%s' - must be MarkdownV2, HTML or empty", parseMode))
+	}
+}
@@ -0,0 +1,80 @@
+package notification
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestEscapeTelegram(t *testing.T) {
+	markdown := EscapeTelegramMarkdownV2("1,000 BCH (350.5 USD) transferred - TX: https://x.com/tx_1?a=b!")
+	want := "1,000 BCH \\(350\\.5 USD\\) transferred \\- TX: https://x\\.com/tx\\_1?a\\=b\\!"
+	if markdown != want {
+		t.Errorf("Unexpected MarkdownV2 escaping:\n%s\nwant\n%s", markdown, want)
+	}
+
+	html := EscapeTelegramHtml("<b>A & B</b>")
+	if html != "&lt;b&gt;A &amp; B&lt;/b&gt;" {
+		t.Errorf("Unexpected HTML escaping: %s", html)
+	}
+}
+
+func TestTelegramOptions(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+	prevUrl := telegramApiUrl
+	telegramApiUrl = server.URL + "/bot%s/sendMessage?%s"
+	defer func() { telegramApiUrl = prevUrl }()
+
+	tele, err := NewTelegram(TelegramConfig{
+		NotifierConfig: NotifierConfig{AppName: "Whales"},
+		Token:          "token",
+		Channel:        "@whales",
+		ParseMode:      TELEGRAM_PARSE_MODE_HTML,
+		ThreadID:       5,
+	})
+	if err != nil {
+		t.Fatalf("Error creating Telegram: %+v", err)
+	}
+
+	// receiver defaults
+	if err = tele.SendNotification(NewNotification("a<b", "c&d")); err != nil {
+		t.Fatalf("Error sending Telegram message: %+v", err)
+	}
+	if query.Get("parse_mode") != "HTML" || query.Get("message_thread_id") != "5" || query.Get("disable_notification") != "" {
+		t.Errorf("Unexpected receiver default options: %v", query)
+	}
+	if query.Get("text") != "<b>Whales: a&lt;b</b>\r\nc&amp;d" {
+		t.Errorf("Unexpected escaped text: %q", query.Get("text"))
+	}
+
+	// message options override receiver defaults
+	notification := NewNotification("title", "text")
+	notification.ParseMode = TELEGRAM_PARSE_MODE_MARKDOWNV2
+	notification.SetSilent(true)
+	notification.ThreadID = 7
+	if err = tele.SendNotification(notification); err != nil {
+		t.Fatalf("Error sending Telegram message: %+v", err)
+	}
+	if query.Get("parse_mode") != "MarkdownV2" || query.Get("message_thread_id") != "7" || query.Get("disable_notification") != "true" {
+		t.Errorf("Unexpected message options: %v", query)
+	}
+
+	// messages can deliver with sound on silent receivers
+	tele.config.Silent = true
+	if err = tele.SendNotification(NewNotification("title", "text").SetSilent(false)); err != nil {
+		t.Fatalf("Error sending Telegram message: %+v", err)
+	}
+	if query.Get("disable_notification") != "" {
+		t.Errorf("Expected message with sound on silent receiver: %v", query)
+	}
+
+	if _, err = NewTelegram(TelegramConfig{Token: "token", Channel: "@whales", ParseMode: "Markdown"}); err == nil {
+		t.Errorf("Expected error for unsupported parse mode")
+	}
+}
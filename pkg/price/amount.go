@@ -0,0 +1,95 @@
+package price
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Satoshis per unit of BCH amounts.
+const (
+	SATOSHI_PER_BCH  = 100000000
+	SATOSHI_PER_MBCH = 100000
+	SATOSHI_PER_BIT  = 100
+)
+
+// Amount is a BCH amount in satoshis.
+type Amount int64
+
+// TemplateFuncs format amounts in message templates, for example {{mbch .AmountRaw}}.
+var TemplateFuncs = template.FuncMap{
+	"bch":  Amount.FormatBCH,
+	"mbch": Amount.FormatMilliBCH,
+	"bits": Amount.FormatBits,
+	"sats": Amount.FormatSats,
+}
+
+// NewAmount converts a BCH amount (for example from a config or the node API) to satoshis.
+func NewAmount(bch float64) Amount {
+	return Amount(math.Round(bch * SATOSHI_PER_BCH))
+}
+
+// BCH returns the amount in BCH. Use it for display and fiat values only, not for sums.
+func (a Amount) BCH() float64 {
+	return float64(a) / SATOSHI_PER_BCH
+}
+
+// Fiat returns the value of the amount at the BCH price rate.
+func (a Amount) Fiat(rate float32) float64 {
+	return a.BCH() * float64(rate)
+}
+
+// FormatBCH returns the amount in BCH with thousands separators and up to 8 decimals.
+func (a Amount) FormatBCH() string {
+	return a.format(SATOSHI_PER_BCH)
+}
+
+// FormatMilliBCH returns the amount in mBCH with thousands separators and up to 5 decimals.
+func (a Amount) FormatMilliBCH() string {
+	return a.format(SATOSHI_PER_MBCH)
+}
+
+// FormatBits returns the amount in bits (100 satoshis) with thousands separators and up to 2 decimals.
+func (a Amount) FormatBits() string {
+	return a.format(SATOSHI_PER_BIT)
+}
+
+// FormatSats returns the amount in satoshis with thousands separators.
+func (a Amount) FormatSats() string {
+	return a.format(1)
+}
+
+func (a Amount) String() string {
+	return a.FormatBCH() + " BCH"
+}
+
+// Formats the amount without floating point errors. Trailing zero decimals are removed.
+func (a Amount) format(unit int64) string {
+	sats := int64(a)
+	sign := ""
+	if sats < 0 {
+		sign = "-"
+		sats = -sats
+	}
+	text := sign + groupThousands(strconv.FormatInt(sats/unit, 10))
+	if unit == 1 {
+		return text
+	}
+	fraction := strings.TrimRight(strconv.FormatInt(unit+sats%unit, 10)[1:], "0")
+	if len(fraction) == 0 {
+		return text
+	}
+	return text + "." + fraction
+}
+
+func groupThousands(digits string) string {
+	var builder strings.Builder
+	for i, digit := range digits {
+		if i != 0 && (len(digits)-i)%3 == 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteRune(digit)
+	}
+	return builder.String()
+}
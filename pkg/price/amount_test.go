@@ -0,0 +1,44 @@
+package price
+
+import (
+	"testing"
+)
+
+func TestNewAmount(t *testing.T) {
+	// 0.1 + 0.2 is not exactly 0.3 in floating point
+	if amount := NewAmount(0.1 + 0.2); amount != 30000000 {
+		t.Errorf("Expected 30000000 satoshis, got %d", amount)
+	}
+	if amount := NewAmount(20999999.9769); amount != 2099999997690000 {
+		t.Errorf("Expected 2099999997690000 satoshis, got %d", amount)
+	}
+	if bch := Amount(150000000).BCH(); bch != 1.5 {
+		t.Errorf("Expected 1.5 BCH, got %f", bch)
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   Amount
+		format   func(Amount) string
+		expected string
+	}{
+		{2500012345678, Amount.FormatBCH, "25,000.12345678"},
+		{2500000000000, Amount.FormatBCH, "25,000"},
+		{1000, Amount.FormatBCH, "0.00001"},
+		{-150000000, Amount.FormatBCH, "-1.5"},
+		{123456789, Amount.FormatMilliBCH, "1,234.56789"},
+		{123456789, Amount.FormatBits, "1,234,567.89"},
+		{100, Amount.FormatBits, "1"},
+		{123456789, Amount.FormatSats, "123,456,789"},
+		{0, Amount.FormatSats, "0"},
+	}
+	for _, test := range tests {
+		if formatted := test.format(test.amount); formatted != test.expected {
+			t.Errorf("Expected %d to be formatted as %s, got %s", test.amount, test.expected, formatted)
+		}
+	}
+	if text := Amount(1000).String(); text != "0.00001 BCH" {
+		t.Errorf("Unexpected amount string %s", text)
+	}
+}
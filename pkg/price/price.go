@@ -4,9 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/spf13/viper"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type BitcoinComRate struct {
@@ -14,12 +15,39 @@ type BitcoinComRate struct {
 	Stamp uint64 `json:"stamp"`
 }
 
-func GetBitcoinCashRate(fiatCurrency string) (float32, error) {
-	url := viper.GetString(fmt.Sprintf("Price.API.%s", fiatCurrency))
+type PriceAPI struct {
+	config PriceAPIConfig
+	client *http.Client
+}
+
+type PriceAPIConfig struct {
+	URLs    map[string]string // fiat currency -> URL returning BitcoinComRate
+	Timeout time.Duration     // defaults to 10s
+}
+
+func NewPriceAPI(config PriceAPIConfig) *PriceAPI {
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	urls := make(map[string]string, len(config.URLs))
+	for currency, url := range config.URLs {
+		urls[strings.ToLower(currency)] = url // case-insensitive like viper keys
+	}
+	config.URLs = urls
+	return &PriceAPI{
+		config: config,
+		client: &http.Client{
+			Timeout: config.Timeout,
+		},
+	}
+}
+
+func (p *PriceAPI) GetBitcoinCashRate(fiatCurrency string) (float32, error) {
+	url := p.config.URLs[strings.ToLower(fiatCurrency)]
 	if len(url) == 0 {
 		return 0.0, errors.New(fmt.Sprintf("not supported fiat currency %s", fiatCurrency))
 	}
-	resp, err := http.Get(url)
+	resp, err := p.client.Get(url)
 	if err != nil {
 		return 0.0, err
 	}
@@ -42,5 +70,5 @@ func GetBitcoinCashRate(fiatCurrency string) (float32, error) {
 }
 
 func SatoshiToBitcoin(sats int64) float64 {
-	return float64(sats) / 100000000.0
+	return Amount(sats).BCH()
 }
@@ -1,31 +1,25 @@
 package price
 
 import (
-	"fmt"
-	"github.com/spf13/viper"
-	"os"
 	"testing"
 )
 
-func TestMain(m *testing.M) {
-	fmt.Println("setting up test environment")
-	viper.SetConfigName("config")
-	viper.AddConfigPath("../../")
-	viper.SetDefault("LogLevel", "debug")
-	viper.AutomaticEnv()
-	viper.ReadInConfig()
-
-	code := m.Run()
-
-	//fmt.Println("cleanup")
-
-	os.Exit(code)
-}
-
 func TestPriceAPI(t *testing.T) {
-	rate, err := GetBitcoinCashRate("USD")
+	api := NewPriceAPI(PriceAPIConfig{
+		URLs: map[string]string{
+			"USD": "https://index-api.bitcoin.com/api/v0/cash/price/usd",
+		},
+	})
+	rate, err := api.GetBitcoinCashRate("USD")
 	if err != nil {
 		t.Fatalf("Error in price API %+v", err)
 	}
 	t.Logf("Received price: %.2f", rate)
 }
+
+func TestUnsupportedCurrency(t *testing.T) {
+	api := NewPriceAPI(PriceAPIConfig{})
+	if _, err := api.GetBitcoinCashRate("EUR"); err == nil {
+		t.Errorf("Expected error for currency without URL")
+	}
+}
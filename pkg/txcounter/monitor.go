@@ -0,0 +1,32 @@
+package txcounter
+
+// Logger logs the cleanup and history file of the TX counter.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Monitor receives the TX count and average sizes whenever they change.
+type Monitor interface {
+	AddEvent(name string, value interface{}) error
+	Gauge(name string, help string) Gauge
+}
+
+// Gauge is a metric of the current value.
+type Gauge interface {
+	Set(value float64, labelValues ...string)
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Infof(format string, args ...interface{})  {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
+
+type nopMonitor struct{}
+
+func (nopMonitor) AddEvent(name string, value interface{}) error { return nil }
+func (nopMonitor) Gauge(name string, help string) Gauge          { return nopGauge{} }
+
+type nopGauge struct{}
+
+func (nopGauge) Set(value float64, labelValues ...string) {}
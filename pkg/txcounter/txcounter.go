@@ -4,48 +4,93 @@ import (
 	"container/heap"
 	"context"
 	"encoding/gob"
-	"github.com/Ekliptor/cashwhale/internal/log"
-	"github.com/Ekliptor/cashwhale/internal/monitoring"
+	"github.com/Ekliptor/cashwhale/pkg/price"
 	"github.com/pkg/errors"
-	"github.com/spf13/viper"
 	"os"
+	"sync"
 	"time"
 )
 
+// DefaultDistributionBuckets are the upper bounds of the TX size distribution (one per order of magnitude).
+var DefaultDistributionBuckets = []price.Amount{
+	price.SATOSHI_PER_BCH / 100,
+	price.SATOSHI_PER_BCH / 10,
+	price.SATOSHI_PER_BCH,
+	price.SATOSHI_PER_BCH * 10,
+	price.SATOSHI_PER_BCH * 100,
+	price.SATOSHI_PER_BCH * 1000,
+	price.SATOSHI_PER_BCH * 10000,
+}
+
 // A struct counting the average TX size (in BCH) over a specified
 // time period (such as 24h).
 // This gives a dynamic threshold to identify whales.
 type TxCounter struct {
-	config             TxCounterConfig
+	config TxCounterConfig
+
+	lock               sync.RWMutex // transactions are added and read from different goroutines
 	transactionHistory []*TxCounterTransaction
-	avgTxSize          float32
+	avgTxSize          price.Amount
 
 	ctx     context.Context
-	logger  log.Logger
-	monitor *monitoring.HttpMonitoring
+	logger  Logger
+	monitor Monitor
+
+	windowSize   Gauge
+	avgSize      Gauge
+	upperPercent Gauge
 }
 
 type TxCounterConfig struct {
-	AverageTime time.Duration // the time to go back and include TX for average size calculation
+	AverageTime     time.Duration // the time to go back and include TX for average size calculation
+	CleanupInterval time.Duration // how often to remove old TX and write the history file, defaults to 1h
+	HistoryFile     string        // file to store TX across restarts, empty to keep them in memory only
+	UpperTxPercent  float64       // the upper percent of TX to report to monitoring, defaults to 0.1
 }
 
 type TxCounterTransaction struct {
-	SizeBch float32
+	Size    price.Amount
+	SizeBch float32 // only set in history files of older versions
 	When    time.Time
 }
 
-func NewTxCounter(config *TxCounterConfig, ctx context.Context, logger log.Logger, monitor *monitoring.HttpMonitoring) (*TxCounter, error) {
+// TxDistributionBucket is the number of TX within a size range of the distribution.
+type TxDistributionBucket struct {
+	MinBch float64 `json:"min_bch"`
+	MaxBch float64 `json:"max_bch"` // 0 for the last bucket without upper bound
+	Count  int     `json:"count"`
+}
+
+// NewTxCounter creates a TX counter. logger and monitor are optional.
+func NewTxCounter(config *TxCounterConfig, ctx context.Context, logger Logger, monitor Monitor) (*TxCounter, error) {
+	if logger == nil {
+		logger = nopLogger{}
+	}
+	if monitor == nil {
+		monitor = nopMonitor{}
+	}
 	if config == nil {
 		config = &TxCounterConfig{
 			AverageTime: 24 * time.Hour,
 		}
 	}
+	counterConfig := *config
+	if counterConfig.CleanupInterval <= 0 {
+		counterConfig.CleanupInterval = time.Hour
+	}
+	if counterConfig.UpperTxPercent <= 0.0 {
+		counterConfig.UpperTxPercent = 0.1
+	}
 	counter := &TxCounter{
-		config:             *config,
+		config:             counterConfig,
 		transactionHistory: make([]*TxCounterTransaction, 0, 10000),
 		ctx:                ctx,
 		logger:             logger,
 		monitor:            monitor,
+
+		windowSize:   monitor.Gauge("cashwhale_txcounter_transactions", "Number of transactions in the average window."),
+		avgSize:      monitor.Gauge("cashwhale_txcounter_average_bch", "Average transaction size in BCH in the window."),
+		upperPercent: monitor.Gauge("cashwhale_txcounter_upper_percent_bch", "Average size in BCH of the upper percent of transactions in the window."),
 	}
 	if err := counter.readTransactionsFile(); err != nil {
 		return nil, err
@@ -53,19 +98,46 @@ func NewTxCounter(config *TxCounterConfig, ctx context.Context, logger log.Logge
 	return counter, nil
 }
 
-func (counter *TxCounter) AddTransaction(sizeBch float32) {
+func (counter *TxCounter) AddTransaction(size price.Amount) {
+	counter.AddTransactionAt(size, time.Now())
+}
+
+// AddTransactionAt adds a TX that happened at the given time, for example from a historical block.
+// TX older than the average window are ignored.
+func (counter *TxCounter) AddTransactionAt(size price.Amount, when time.Time) {
+	if when.Before(time.Now().Add(-counter.config.AverageTime)) {
+		return
+	}
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
 	counter.transactionHistory = append(counter.transactionHistory, &TxCounterTransaction{
-		SizeBch: sizeBch,
-		When:    time.Now(),
+		Size: size,
+		When: when,
 	})
 	counter.calcAverageTransactionSize()
 }
 
-func (counter *TxCounter) GetAverageTransactionSize() float32 {
+// SetUpperTxPercent changes the upper percent of TX reported to monitoring, for example when the whale thresholds change.
+func (counter *TxCounter) SetUpperTxPercent(percent float64) {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	counter.config.UpperTxPercent = percent
+	counter.calcAverageTransactionSize()
+}
+
+func (counter *TxCounter) GetAverageTransactionSize() price.Amount {
+	counter.lock.RLock()
+	defer counter.lock.RUnlock()
 	return counter.avgTxSize
 }
 
-func (counter *TxCounter) GetUpperTransactionSizePercent(percent float32) float32 {
+func (counter *TxCounter) GetUpperTransactionSizePercent(percent float32) price.Amount {
+	counter.lock.RLock()
+	defer counter.lock.RUnlock()
+	return counter.getUpperTransactionSizePercent(percent)
+}
+
+func (counter *TxCounter) getUpperTransactionSizePercent(percent float32) price.Amount {
 	// TODO add map with percent number as key and invalidate on AddTransaction()
 	txCount := int(float32(len(counter.transactionHistory)) / 100.0 * percent)
 	if txCount == 0 {
@@ -80,38 +152,55 @@ func (counter *TxCounter) GetUpperTransactionSizePercent(percent float32) float3
 	}
 
 	// get the sum of top n TX and compute average
-	var sum float32 = 0.0
+	var sum price.Amount
 	for i := 0; i < txCount && transactionHeap.Len() > 0; i++ {
 		tx := heap.Pop(transactionHeap).(*TxCounterTransaction)
-		sum += tx.SizeBch
+		sum += tx.Size
 	}
-	return sum / float32(txCount)
+	return sum / price.Amount(txCount)
 }
 
 func (counter *TxCounter) GetTransactionCount() int {
+	counter.lock.RLock()
+	defer counter.lock.RUnlock()
 	return len(counter.transactionHistory)
 }
 
+// GetDistribution returns the number of TX in the average window grouped by size.
+// buckets are the upper bounds in increasing order, another bucket without upper bound is added.
+func (counter *TxCounter) GetDistribution(buckets []price.Amount) []TxDistributionBucket {
+	distribution := make([]TxDistributionBucket, len(buckets)+1)
+	var min price.Amount
+	for i, max := range buckets {
+		distribution[i].MinBch = min.BCH()
+		distribution[i].MaxBch = max.BCH()
+		min = max
+	}
+	distribution[len(buckets)].MinBch = min.BCH()
+
+	counter.lock.RLock()
+	defer counter.lock.RUnlock()
+	for _, tx := range counter.transactionHistory {
+		i := 0
+		for i < len(buckets) && tx.Size >= buckets[i] {
+			i++
+		}
+		distribution[i].Count++
+	}
+	return distribution
+}
+
 func (counter *TxCounter) ScheduleCleanupTransactions() error {
 	// start the cleanup timer
-	tickerInterval := time.Duration(viper.GetInt("Average.AverageTxCleanupTimeMin")) * time.Minute
-	var ticker = time.NewTicker(tickerInterval)
+	var ticker = time.NewTicker(counter.config.CleanupInterval)
 	terminating := false
 	for !terminating {
 		select {
 		case _ = <-ticker.C:
-			counter.logger.Infof("Start cleaning up old transaction data...")
-			err := counter.cleanupOldTransactions()
-			if err != nil {
-				counter.logger.Errorf("Error cleaning up old transaction data %+v", err)
-			}
-			err = counter.WriteTransactionsFile()
-			if err != nil {
-				counter.logger.Errorf("Error writing transaction data to disk %+v", err)
+			if err := counter.Flush(); err != nil {
+				counter.logger.Errorf("Error flushing transaction data %+v", err)
 			}
 
-			counter.logger.Infof("Successfully cleaned up old transaction data.")
-
 		case <-counter.ctx.Done():
 			terminating = true
 			break
@@ -121,15 +210,36 @@ func (counter *TxCounter) ScheduleCleanupTransactions() error {
 	return nil
 }
 
+// Flush removes transactions older than the average window and writes the remaining ones to disk.
+func (counter *TxCounter) Flush() error {
+	counter.logger.Infof("Start cleaning up old transaction data...")
+	err := counter.cleanupOldTransactions()
+	if err != nil {
+		return errors.Wrap(err, "error cleaning up old transaction data")
+	}
+	err = counter.WriteTransactionsFile()
+	if err != nil {
+		return errors.Wrap(err, "error writing transaction data to disk")
+	}
+
+	counter.logger.Infof("Successfully cleaned up old transaction data.")
+	return nil
+}
+
 func (counter *TxCounter) WriteTransactionsFile() error {
+	if len(counter.config.HistoryFile) == 0 {
+		return nil // in memory only
+	}
 	// create a new file
-	file, err := os.Create(viper.GetString("Average.TxHistoryFile"))
+	file, err := os.Create(counter.config.HistoryFile)
 	if err != nil {
 		return errors.Wrap(err, "error opening file to write")
 	}
 	defer file.Close()
 
 	// then write all to disk
+	counter.lock.RLock()
+	defer counter.lock.RUnlock()
 	encoder := gob.NewEncoder(file)
 	if err := encoder.Encode(counter.transactionHistory); err != nil {
 		return errors.Wrap(err, "error encoding transaction data")
@@ -140,10 +250,12 @@ func (counter *TxCounter) WriteTransactionsFile() error {
 }
 
 func (counter *TxCounter) cleanupOldTransactions() error {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
 	// create a new smaller slice and copy TX over
 	capacity := int(float32(len(counter.transactionHistory))*0.9 + 1)
 	transactions := make([]*TxCounterTransaction, 0, capacity)
-	expiry := time.Now().Add(-1 * time.Duration(viper.GetInt("Average.TransactionAverageTimeH")) * time.Hour)
+	expiry := time.Now().Add(-1 * counter.config.AverageTime)
 	for _, tx := range counter.transactionHistory {
 		if tx.When.After(expiry) {
 			transactions = append(transactions, tx)
@@ -156,24 +268,36 @@ func (counter *TxCounter) cleanupOldTransactions() error {
 
 func (counter *TxCounter) calcAverageTransactionSize() {
 	size := len(counter.transactionHistory)
+	if counter.windowSize != nil { // nil if not created by NewTxCounter
+		counter.windowSize.Set(float64(size))
+	}
 	if size == 0 {
-		counter.avgTxSize = 0.0
+		counter.avgTxSize = 0
 		return
 	}
-	var sum float32 = 0.0
+	var sum price.Amount
 	for _, tx := range counter.transactionHistory {
-		sum += tx.SizeBch
+		sum += tx.Size
 	}
-	counter.avgTxSize = sum / float32(size)
+	counter.avgTxSize = sum / price.Amount(size)
 
 	// monitoring
+	if counter.monitor == nil {
+		return
+	}
+	upperPercent := counter.getUpperTransactionSizePercent(float32(counter.config.UpperTxPercent))
 	counter.monitor.AddEvent("TxCount", size)
-	counter.monitor.AddEvent("TxAvgBch", counter.avgTxSize)
-	counter.monitor.AddEvent("TxUpperPercentBch", counter.GetUpperTransactionSizePercent(float32(viper.GetFloat64("Average.UpperTxPercent"))))
+	counter.monitor.AddEvent("TxAvgBch", counter.avgTxSize.BCH())
+	counter.monitor.AddEvent("TxUpperPercentBch", upperPercent.BCH())
+	counter.avgSize.Set(counter.avgTxSize.BCH())
+	counter.upperPercent.Set(upperPercent.BCH())
 }
 
 func (counter *TxCounter) readTransactionsFile() error {
-	file, err := os.Open(viper.GetString("Average.TxHistoryFile"))
+	if len(counter.config.HistoryFile) == 0 {
+		return nil
+	}
+	file, err := os.Open(counter.config.HistoryFile)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return errors.Wrap(err, "error opening existing transactions file")
@@ -188,6 +312,12 @@ func (counter *TxCounter) readTransactionsFile() error {
 		return errors.Wrap(err, "error decoding previously stored transaction data")
 	}
 
+	for _, tx := range counter.transactionHistory {
+		if tx.SizeBch != 0.0 { // convert TX of older versions
+			tx.Size = price.NewAmount(float64(tx.SizeBch))
+			tx.SizeBch = 0.0
+		}
+	}
 	counter.logger.Infof("Loaded transaction history containing %d transactions.", len(counter.transactionHistory))
 	counter.calcAverageTransactionSize()
 	return nil
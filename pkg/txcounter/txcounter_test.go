@@ -0,0 +1,175 @@
+package txcounter
+
+import (
+	"context"
+	"encoding/gob"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetDistribution(t *testing.T) {
+	counter := &TxCounter{}
+	for _, size := range []float64{0.001, 0.5, 0.9, 10, 25000} {
+		counter.transactionHistory = append(counter.transactionHistory, &TxCounterTransaction{
+			Size: price.NewAmount(size),
+			When: time.Now(),
+		})
+	}
+
+	distribution := counter.GetDistribution([]price.Amount{price.NewAmount(0.01), price.NewAmount(1), price.NewAmount(10000)})
+	expected := []TxDistributionBucket{
+		{MinBch: 0, MaxBch: 0.01, Count: 1},
+		{MinBch: 0.01, MaxBch: 1, Count: 2},
+		{MinBch: 1, MaxBch: 10000, Count: 1},
+		{MinBch: 10000, MaxBch: 0, Count: 1},
+	}
+	if len(distribution) != len(expected) {
+		t.Fatalf("Expected %d buckets, got %d", len(expected), len(distribution))
+	}
+	for i := range expected {
+		if distribution[i] != expected[i] {
+			t.Errorf("Unexpected bucket %d: %+v, expected %+v", i, distribution[i], expected[i])
+		}
+	}
+}
+
+func TestAddTransactionAt(t *testing.T) {
+	counter := &TxCounter{config: TxCounterConfig{AverageTime: 24 * time.Hour}}
+	counter.AddTransactionAt(10, time.Now().Add(-48*time.Hour))
+	counter.AddTransactionAt(20, time.Now().Add(-12*time.Hour))
+	counter.AddTransaction(41)
+
+	if count := counter.GetTransactionCount(); count != 2 {
+		t.Errorf("Expected 2 TX in the average window, got %d", count)
+	}
+	if avg := counter.GetAverageTransactionSize(); avg != 30 { // satoshis are rounded down
+		t.Errorf("Expected average TX size 30, got %d", avg)
+	}
+	counter.SetUpperTxPercent(50.0)
+	if counter.config.UpperTxPercent != 50.0 || counter.GetAverageTransactionSize() != 30 {
+		t.Errorf("Unexpected config after changing the upper percent: %+v", counter.config)
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	dir, err := ioutil.TempDir("", "cashwhale-txcounter")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	config := &TxCounterConfig{
+		AverageTime: 24 * time.Hour,
+		HistoryFile: filepath.Join(dir, "txhistory.gob"),
+	}
+
+	counter, err := NewTxCounter(config, context.Background(), logger, nil)
+	if err != nil {
+		t.Fatalf("Error creating TX counter: %+v", err)
+	}
+	counter.AddTransaction(10)
+	counter.AddTransaction(20)
+	if err = counter.WriteTransactionsFile(); err != nil {
+		t.Fatalf("Error writing history: %+v", err)
+	}
+
+	counter, err = NewTxCounter(config, context.Background(), logger, nil)
+	if err != nil {
+		t.Fatalf("Error reading history: %+v", err)
+	}
+	if count := counter.GetTransactionCount(); count != 2 {
+		t.Errorf("Expected 2 TX from the history file, got %d", count)
+	}
+
+	config.HistoryFile = "" // in memory only
+	counter, err = NewTxCounter(config, context.Background(), logger, nil)
+	if err != nil || counter.GetTransactionCount() != 0 || counter.WriteTransactionsFile() != nil {
+		t.Errorf("Expected empty TX counter without history file: %v", err)
+	}
+}
+
+func TestLegacyHistoryFile(t *testing.T) {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	config := &TxCounterConfig{
+		AverageTime: 24 * time.Hour,
+		HistoryFile: filepath.Join(t.TempDir(), "txhistory.gob"),
+	}
+	// TX of older versions stored sizes in BCH
+	type legacyTransaction struct {
+		SizeBch float32
+		When    time.Time
+	}
+	file, err := os.Create(config.HistoryFile)
+	if err != nil {
+		t.Fatalf("Error creating history file: %+v", err)
+	}
+	err = gob.NewEncoder(file).Encode([]*legacyTransaction{{SizeBch: 1.5, When: time.Now()}, {SizeBch: 0.25, When: time.Now()}})
+	file.Close()
+	if err != nil {
+		t.Fatalf("Error writing history file: %+v", err)
+	}
+
+	counter, err := NewTxCounter(config, context.Background(), logger, nil)
+	if err != nil {
+		t.Fatalf("Error reading history: %+v", err)
+	}
+	if avg := counter.GetAverageTransactionSize(); avg != 87500000 {
+		t.Errorf("Expected average TX size of 0.875 BCH, got %s", avg)
+	}
+}
+
+type testMonitor struct {
+	events map[string]interface{}
+	gauges map[string]*testGauge
+}
+
+type testGauge struct {
+	value float64
+}
+
+func (m *testMonitor) AddEvent(name string, value interface{}) error {
+	m.events[name] = value
+	return nil
+}
+
+func (m *testMonitor) Gauge(name string, help string) Gauge {
+	m.gauges[name] = &testGauge{}
+	return m.gauges[name]
+}
+
+func (g *testGauge) Set(value float64, labelValues ...string) {
+	g.value = value
+}
+
+func TestOptionalLoggerAndMonitor(t *testing.T) {
+	counter, err := NewTxCounter(nil, context.Background(), nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating TX counter without logger and monitor: %+v", err)
+	}
+	counter.AddTransaction(10)
+	if err = counter.Flush(); err != nil {
+		t.Errorf("Error flushing TX counter without logger: %+v", err)
+	}
+
+	monitor := &testMonitor{events: make(map[string]interface{}), gauges: make(map[string]*testGauge)}
+	counter, err = NewTxCounter(nil, context.Background(), nil, monitor)
+	if err != nil {
+		t.Fatalf("Error creating TX counter: %+v", err)
+	}
+	counter.AddTransaction(price.SATOSHI_PER_BCH)
+	counter.AddTransaction(3 * price.SATOSHI_PER_BCH)
+	if monitor.events["TxCount"] != 2 || monitor.gauges["cashwhale_txcounter_average_bch"].value != 2.0 {
+		t.Errorf("Unexpected monitoring of TX counter: %+v %+v", monitor.events, monitor.gauges)
+	}
+}
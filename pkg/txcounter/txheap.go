@@ -7,13 +7,13 @@ import (
 // ensure we implement heap.Interface (compile error otherwise)
 var _ heap.Interface = (*TxHeap)(nil)
 
-// An TxHeap is a min-heap of float32 TX size values.
+// An TxHeap is a min-heap of TX size values.
 type TxHeap []*TxCounterTransaction
 
 func (h TxHeap) Len() int { return len(h) }
 
-// func (h TxHeap) Less(i, j int) bool { return h[i].SizeBch < h[j].SizeBch }
-func (h TxHeap) Less(i, j int) bool { return h[i].SizeBch >= h[j].SizeBch } // we want a heap with maximum on top
+// func (h TxHeap) Less(i, j int) bool { return h[i].Size < h[j].Size }
+func (h TxHeap) Less(i, j int) bool { return h[i].Size >= h[j].Size } // we want a heap with maximum on top
 func (h TxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
 
 func (h *TxHeap) Push(x interface{}) {
@@ -9,22 +9,22 @@ import (
 func TestTransactionsHeap(t *testing.T) {
 	h := &TxHeap{
 		&TxCounterTransaction{
-			SizeBch: 123.4,
-			When:    time.Now(),
+			Size: 12340000000,
+			When: time.Now(),
 		},
 		&TxCounterTransaction{
-			SizeBch: 0.4,
-			When:    time.Now(),
+			Size: 40000000,
+			When: time.Now(),
 		},
 		&TxCounterTransaction{
-			SizeBch: 444.4,
-			When:    time.Now(),
+			Size: 44440000000,
+			When: time.Now(),
 		},
 	}
 	heap.Init(h)
 	heap.Push(h, &TxCounterTransaction{
-		SizeBch: 5555.4,
-		When:    time.Now(),
+		Size: 555540000000,
+		When: time.Now(),
 	})
 	//t.Logf("minimum: %v", (*h)[0])
 	t.Logf("maximum: %v", (*h)[0])
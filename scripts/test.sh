@@ -10,6 +10,7 @@ mkdir -p "$PWD/testlog"
 
 PKGS=(
   "pkg/price"
+  "tests"
 )
 
 if [ -z "$1" ]; then
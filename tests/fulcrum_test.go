@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// fakeFulcrum is an Electrum/Fulcrum TCP stand-in pushing header notifications of the blocks of a fakeNode.
+type fakeFulcrum struct {
+	listener net.Listener
+	node     *fakeNode
+
+	lock  sync.Mutex
+	conns map[*fulcrumConn]bool
+}
+
+// A connected client. Writes are serialized since notifications are sent while reading requests.
+type fulcrumConn struct {
+	conn net.Conn
+
+	lock       sync.Mutex
+	subscribed bool
+}
+
+type electrumRequest struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     interface{}       `json:"id"`
+}
+
+type electrumHeader struct {
+	Height int    `json:"height"`
+	Hex    string `json:"hex"`
+}
+
+func newFakeFulcrum(node *fakeNode) (*fakeFulcrum, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	fulcrum := &fakeFulcrum{
+		listener: listener,
+		node:     node,
+		conns:    make(map[*fulcrumConn]bool, 2),
+	}
+	go fulcrum.accept()
+	return fulcrum, nil
+}
+
+// Address returns host:port of the TCP server.
+func (f *fakeFulcrum) Address() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeFulcrum) Close() {
+	f.listener.Close()
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for conn := range f.conns {
+		conn.conn.Close()
+	}
+}
+
+// NotifyHeader pushes the header at this height to all subscribed clients.
+func (f *fakeFulcrum) NotifyHeader(height int) {
+	f.lock.Lock()
+	conns := make([]*fulcrumConn, 0, len(f.conns))
+	for conn := range f.conns {
+		conns = append(conns, conn)
+	}
+	f.lock.Unlock()
+
+	for _, conn := range conns {
+		conn.lock.Lock()
+		if conn.subscribed {
+			conn.write(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"method":  "blockchain.headers.subscribe",
+				"params":  []interface{}{newElectrumHeader(height)},
+			})
+		}
+		conn.lock.Unlock()
+	}
+}
+
+func (f *fakeFulcrum) accept() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return // closed
+		}
+		client := &fulcrumConn{conn: conn}
+		f.lock.Lock()
+		f.conns[client] = true
+		f.lock.Unlock()
+		go f.serve(client)
+	}
+}
+
+func (f *fakeFulcrum) serve(client *fulcrumConn) {
+	defer func() {
+		f.lock.Lock()
+		delete(f.conns, client)
+		f.lock.Unlock()
+		client.conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(client.conn)
+	for scanner.Scan() {
+		var req electrumRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return
+		}
+		res := map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+		}
+
+		client.lock.Lock()
+		switch req.Method {
+		case "server.version":
+			res["result"] = []string{"Fulcrum 1.9.0", "1.4"}
+		case "server.ping":
+			res["result"] = nil
+		case "blockchain.headers.subscribe":
+			// subscribe before responding, so no header mined after the response is missed
+			client.subscribed = true
+			res["result"] = newElectrumHeader(f.node.Tip())
+		case "blockchain.scripthash.listunspent":
+			res["result"] = []interface{}{}
+		default:
+			res["error"] = map[string]interface{}{
+				"code":    -32601,
+				"message": fmt.Sprintf("unknown method \"%s\"", req.Method),
+			}
+		}
+		client.write(res)
+		client.lock.Unlock()
+	}
+}
+
+// Must be called with the lock held.
+func (c *fulcrumConn) write(msg interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	c.conn.Write(append(data, '\n'))
+}
+
+// Returns a header with a raw 80 byte hex string. Clients only use the height.
+func newElectrumHeader(height int) *electrumHeader {
+	return &electrumHeader{
+		Height: height,
+		Hex:    fmt.Sprintf("%0160x", height),
+	}
+}
@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Ekliptor/cashwhale/internal/bch"
+	"github.com/Ekliptor/cashwhale/internal/bch/network"
+	"github.com/Ekliptor/cashwhale/internal/config"
+	"github.com/Ekliptor/cashwhale/internal/log"
+	"github.com/Ekliptor/cashwhale/internal/social"
+	"github.com/Ekliptor/cashwhale/internal/watcher"
+	"github.com/Ekliptor/cashwhale/pkg/price"
+	"github.com/Ekliptor/cashwhale/pkg/txcounter"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	testMessageText   = "{{.Amount}} #{{.Currency}} #{{.Symbol}} ({{.FiatAmount}} {{.FiatSymbol}})\n\nTX: {{.TxLink}}"
+	testBlockExplorer = "https://explorer.test/tx/%s"
+	testPriceCents    = 30000 // 300 USD
+
+	// how long to wait for a whale to be published
+	publishTimeout = 5 * time.Second
+)
+
+// capturePublisher records all published whales.
+type capturePublisher struct {
+	published chan *social.TransactionData
+}
+
+func newCapturePublisher() *capturePublisher {
+	return &capturePublisher{
+		published: make(chan *social.TransactionData, 100),
+	}
+}
+
+func (p *capturePublisher) Name() string {
+	return "capture"
+}
+
+func (p *capturePublisher) Publish(tx *social.TransactionData) error {
+	txCopy := *tx
+	p.published <- &txCopy
+	return nil
+}
+
+// harness runs a watcher against a fake node, Fulcrum server and price API.
+// Blocks mined on the fake node are sent to the watcher like blocks of a regtest node.
+type harness struct {
+	t         *testing.T
+	cancel    context.CancelFunc
+	node      *fakeNode
+	fulcrum   *fakeFulcrum
+	priceAPI  *httptest.Server
+	publisher *capturePublisher
+
+	msgBuilder *social.MessageBuilder
+	watcher    *watcher.Watcher
+}
+
+func newHarness(t *testing.T, thresholds watcher.Thresholds) *harness {
+	logger, err := log.NewLogger(&log.Configuration{EnableConsole: true, ConsoleLevel: log.Debug}, log.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error creating logger: %+v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &harness{
+		t:      t,
+		cancel: cancel,
+		node:   newFakeNode(),
+		priceAPI: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(&price.BitcoinComRate{
+				Price: testPriceCents,
+				Stamp: uint64(time.Now().Unix()),
+			})
+		})),
+		publisher: newCapturePublisher(),
+	}
+	t.Cleanup(h.close)
+	h.fulcrum, err = newFakeFulcrum(h.node)
+	if err != nil {
+		t.Fatalf("Error starting fake Fulcrum: %+v", err)
+	}
+
+	counter, err := txcounter.NewTxCounter(&txcounter.TxCounterConfig{AverageTime: 24 * time.Hour}, ctx, logger, nil)
+	if err != nil {
+		t.Fatalf("Error creating TX counter: %+v", err)
+	}
+	h.msgBuilder, err = social.NewMessageBuilder(ctx, social.MessageBuilderConfig{
+		Text:          testMessageText,
+		BlockExplorer: testBlockExplorer,
+		FiatCurrency:  "USD",
+		Network:       network.REGTEST,
+		PriceAPI: price.PriceAPIConfig{
+			URLs: map[string]string{"USD": h.priceAPI.URL},
+		},
+	}, logger, nil)
+	if err != nil {
+		t.Fatalf("Error creating message builder: %+v", err)
+	}
+	h.msgBuilder.AddPublisher(h.publisher)
+
+	chain, err := bch.NewBch(ctx, bch.BchConfig{
+		Nodes: []*config.NodeConfig{{
+			Address:        h.node.Address(),
+			User:           fakeNodeUser,
+			Password:       fakeNodePassword,
+			Fulcrum:        h.fulcrum.Address(),
+			FulcrumPingMin: config.DefaultFulcrumPingMin,
+		}},
+		Network: network.REGTEST,
+	}, logger, nil)
+	if err != nil {
+		t.Fatalf("Error creating BCH client: %+v", err)
+	}
+	h.watcher, err = watcher.NewWatcher(watcher.WatcherConfig{Thresholds: thresholds}, logger, nil, counter, h.msgBuilder)
+	if err != nil {
+		t.Fatalf("Error creating watcher: %+v", err)
+	}
+
+	// the same loop as the watch command
+	blockCh, err := chain.WatchNewBlocks(ctx)
+	if err != nil {
+		t.Fatalf("Error watching new blocks: %+v", err)
+	}
+	mempoolCh := chain.WatchMempool(ctx)
+	go func() {
+		for {
+			select {
+			case chunk := <-blockCh:
+				h.watcher.CheckTransactions(chunk.Tx)
+				if chunk.Last && !chunk.Aborted {
+					h.watcher.BlockChecked()
+				}
+
+			case txs := <-mempoolCh:
+				h.watcher.CheckUnconfirmedTransactions(txs)
+
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return h
+}
+
+func (h *harness) close() {
+	h.cancel()
+	if h.fulcrum != nil {
+		h.fulcrum.Close()
+	}
+	h.node.Close()
+	h.priceAPI.Close()
+}
+
+// mine adds a block with txs to the fake node and notifies the watcher via Fulcrum.
+func (h *harness) mine(txs ...*fakeTx) {
+	block := h.node.addBlock(txs)
+	h.fulcrum.NotifyHeader(block.Height)
+}
+
+// expectPublished waits for the whales with these txids to be published in this order.
+func (h *harness) expectPublished(txids ...string) []*social.TransactionData {
+	h.t.Helper()
+	published := make([]*social.TransactionData, 0, len(txids))
+	for _, txid := range txids {
+		select {
+		case tx := <-h.publisher.published:
+			if tx.Hash != txid {
+				h.t.Fatalf("Expected whale %s to be published, got %s: %s", txid, tx.Hash, tx.Message)
+			}
+			published = append(published, tx)
+
+		case <-time.After(publishTimeout):
+			h.t.Fatalf("Whale %s was not published within %s", txid, publishTimeout)
+		}
+	}
+	return published
+}
+
+// expectNothingPublished checks that no more whales were published.
+// Call this after expectPublished of a later block, so all previous blocks have been checked.
+func (h *harness) expectNothingPublished() {
+	h.t.Helper()
+	select {
+	case tx := <-h.publisher.published:
+		h.t.Errorf("Unexpected whale %s published: %s", tx.Hash, tx.Message)
+	default:
+	}
+}
@@ -0,0 +1,375 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	fakeNodeUser     = "cashwhale"
+	fakeNodePassword = "test"
+	fakeTxFee        = 0.00000226
+)
+
+// fakeNode is a bitcoind JSON-RPC stand-in serving scripted blocks.
+type fakeNode struct {
+	server *httptest.Server
+
+	lock    sync.Mutex
+	blocks  []*fakeBlock       // index is the block height
+	txIndex map[string]*fakeTx // txid -> TX
+	txCount int                // to create unique txids
+}
+
+type fakeBlock struct {
+	Height int
+	Hash   string
+	Time   time.Time
+	Tx     []*fakeTx
+}
+
+type fakeTx struct {
+	Txid     string
+	Coinbase bool
+	Fee      float64   // BCH
+	Inputs   []float64 // values of the spent outputs in BCH
+	Outputs  []float64 // BCH
+}
+
+type rpcRequest struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     interface{}       `json:"id"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	Result interface{} `json:"result"`
+	Error  *rpcError   `json:"error"`
+	ID     interface{} `json:"id"`
+}
+
+// Starts a node with only the genesis block.
+func newFakeNode() *fakeNode {
+	node := &fakeNode{
+		blocks:  make([]*fakeBlock, 0, 10),
+		txIndex: make(map[string]*fakeTx, 100),
+	}
+	node.addBlock(nil)
+	node.server = httptest.NewServer(http.HandlerFunc(node.serveRPC))
+	return node
+}
+
+func (n *fakeNode) Close() {
+	n.server.Close()
+}
+
+// Address returns host:port of the RPC server.
+func (n *fakeNode) Address() string {
+	return n.server.Listener.Addr().String()
+}
+
+// NewTx creates a TX with these output values in BCH spending a single input.
+func (n *fakeNode) NewTx(outputs ...float64) *fakeTx {
+	total := fakeTxFee
+	for _, value := range outputs {
+		total += value
+	}
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return &fakeTx{
+		Txid:    n.nextTxid(),
+		Fee:     fakeTxFee,
+		Inputs:  []float64{total},
+		Outputs: outputs,
+	}
+}
+
+// addBlock mines a block with a coinbase TX and txs on top of the current tip.
+func (n *fakeNode) addBlock(txs []*fakeTx) *fakeBlock {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	height := len(n.blocks)
+	hash := sha256.Sum256([]byte(fmt.Sprintf("block %d", height)))
+	block := &fakeBlock{
+		Height: height,
+		Hash:   hex.EncodeToString(hash[:]),
+		Time:   time.Now(),
+		Tx:     make([]*fakeTx, 0, len(txs)+1),
+	}
+	coinbase := &fakeTx{
+		Txid:     n.nextTxid(),
+		Coinbase: true,
+		Outputs:  []float64{6.25},
+	}
+	block.Tx = append(block.Tx, coinbase)
+	block.Tx = append(block.Tx, txs...)
+	for _, tx := range block.Tx {
+		n.txIndex[tx.Txid] = tx
+	}
+	n.blocks = append(n.blocks, block)
+	return block
+}
+
+// Tip returns the height of the best block.
+func (n *fakeNode) Tip() int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return len(n.blocks) - 1
+}
+
+// Must be called with the lock held.
+func (n *fakeNode) nextTxid() string {
+	n.txCount++
+	hash := sha256.Sum256([]byte(fmt.Sprintf("tx %d", n.txCount)))
+	return hex.EncodeToString(hash[:])
+}
+
+func (n *fakeNode) serveRPC(w http.ResponseWriter, r *http.Request) {
+	user, password, ok := r.BasicAuth()
+	if !ok || user != fakeNodeUser || password != fakeNodePassword {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	result, err := n.call(req.Method, req.Params)
+	res := &rpcResponse{Result: result, ID: req.ID}
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		res.Error = err
+		if err.Code == -32601 {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func (n *fakeNode) call(method string, params []json.RawMessage) (interface{}, *rpcError) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	tip := n.blocks[len(n.blocks)-1]
+
+	switch method {
+	case "getblockchaininfo":
+		return map[string]interface{}{
+			"chain":         "regtest",
+			"blocks":        tip.Height,
+			"headers":       tip.Height,
+			"bestblockhash": tip.Hash,
+			"mediantime":    tip.Time.Unix(),
+		}, nil
+
+	case "getblockcount":
+		return tip.Height, nil
+
+	case "getbestblockhash":
+		return tip.Hash, nil
+
+	case "getblockhash":
+		var height int
+		if err := getParam(params, 0, &height); err != nil {
+			return nil, err
+		} else if height < 0 || height >= len(n.blocks) {
+			return nil, &rpcError{Code: -8, Message: "Block height out of range"}
+		}
+		return n.blocks[height].Hash, nil
+
+	case "getblockheader":
+		var hash string
+		if err := getParam(params, 0, &hash); err != nil {
+			return nil, err
+		}
+		block := n.findBlock(hash)
+		if block == nil {
+			return nil, &rpcError{Code: -5, Message: "Block not found"}
+		}
+		return n.blockJSON(block, 0), nil
+
+	case "getblock":
+		var hash string
+		verbosity := 1
+		if err := getParam(params, 0, &hash); err != nil {
+			return nil, err
+		}
+		if len(params) > 1 {
+			var verbose interface{}
+			if err := getParam(params, 1, &verbose); err != nil {
+				return nil, err
+			}
+			switch verbose := verbose.(type) {
+			case bool:
+				if !verbose {
+					verbosity = 0
+				}
+			case float64:
+				verbosity = int(verbose)
+			}
+		}
+		block := n.findBlock(hash)
+		if block == nil {
+			return nil, &rpcError{Code: -5, Message: "Block not found"}
+		} else if verbosity == 0 {
+			return nil, &rpcError{Code: -8, Message: "Raw blocks are not supported by the fake node"}
+		}
+		return n.blockJSON(block, verbosity), nil
+
+	case "getrawtransaction":
+		var txid string
+		if err := getParam(params, 0, &txid); err != nil {
+			return nil, err
+		}
+		tx, ok := n.txIndex[txid]
+		if !ok {
+			return nil, &rpcError{Code: -5, Message: "No such mempool or blockchain transaction"}
+		}
+		return n.txJSON(tx, n.findTxBlock(txid)), nil
+	}
+	return nil, &rpcError{Code: -32601, Message: "Method not found"}
+}
+
+func getParam(params []json.RawMessage, i int, value interface{}) *rpcError {
+	if i >= len(params) {
+		return &rpcError{Code: -1, Message: fmt.Sprintf("missing parameter %d", i)}
+	} else if err := json.Unmarshal(params[i], value); err != nil {
+		return &rpcError{Code: -1, Message: fmt.Sprintf("invalid parameter %d: %v", i, err)}
+	}
+	return nil
+}
+
+func (n *fakeNode) findBlock(hash string) *fakeBlock {
+	for _, block := range n.blocks {
+		if block.Hash == hash {
+			return block
+		}
+	}
+	return nil
+}
+
+func (n *fakeNode) findTxBlock(txid string) *fakeBlock {
+	for _, block := range n.blocks {
+		for _, tx := range block.Tx {
+			if tx.Txid == txid {
+				return block
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the block like bitcoind. Verbosity 0 returns only the header, 1 the txids and 2 or 3 all TX with prevouts.
+func (n *fakeNode) blockJSON(block *fakeBlock, verbosity int) map[string]interface{} {
+	res := map[string]interface{}{
+		"hash":          block.Hash,
+		"confirmations": len(n.blocks) - block.Height,
+		"height":        block.Height,
+		"version":       536870912,
+		"merkleroot":    block.Hash,
+		"time":          block.Time.Unix(),
+		"mediantime":    block.Time.Unix(),
+		"nonce":         block.Height,
+		"bits":          "207fffff",
+		"difficulty":    4.656542373906925e-10,
+		"nTx":           len(block.Tx),
+	}
+	if block.Height > 0 {
+		res["previousblockhash"] = n.blocks[block.Height-1].Hash
+	}
+	if block.Height+1 < len(n.blocks) {
+		res["nextblockhash"] = n.blocks[block.Height+1].Hash
+	}
+	switch {
+	case verbosity == 1:
+		txids := make([]string, len(block.Tx))
+		for i, tx := range block.Tx {
+			txids[i] = tx.Txid
+		}
+		res["tx"] = txids
+	case verbosity >= 2:
+		txs := make([]map[string]interface{}, len(block.Tx))
+		for i, tx := range block.Tx {
+			txs[i] = n.txJSON(tx, nil)
+		}
+		res["tx"] = txs
+	}
+	return res
+}
+
+// Returns the TX like bitcoind. block is only set for getrawtransaction.
+func (n *fakeNode) txJSON(tx *fakeTx, block *fakeBlock) map[string]interface{} {
+	vin := make([]map[string]interface{}, 0, len(tx.Inputs))
+	if tx.Coinbase {
+		vin = append(vin, map[string]interface{}{
+			"coinbase": "0300000000",
+			"sequence": 4294967295,
+		})
+	}
+	for i, value := range tx.Inputs {
+		prevTxid := sha256.Sum256([]byte(tx.Txid + strconv.Itoa(i)))
+		vin = append(vin, map[string]interface{}{
+			"txid":      hex.EncodeToString(prevTxid[:]),
+			"vout":      0,
+			"scriptSig": map[string]interface{}{"asm": "", "hex": ""},
+			"sequence":  4294967295,
+			"prevout": map[string]interface{}{
+				"generated":    false,
+				"height":       0,
+				"value":        value,
+				"scriptPubKey": scriptPubKeyJSON(),
+			},
+		})
+	}
+	vout := make([]map[string]interface{}, len(tx.Outputs))
+	for i, value := range tx.Outputs {
+		vout[i] = map[string]interface{}{
+			"value":        value,
+			"n":            i,
+			"scriptPubKey": scriptPubKeyJSON(),
+		}
+	}
+
+	res := map[string]interface{}{
+		"txid":     tx.Txid,
+		"hash":     tx.Txid,
+		"version":  2,
+		"size":     226,
+		"locktime": 0,
+		"vin":      vin,
+		"vout":     vout,
+	}
+	if !tx.Coinbase {
+		res["fee"] = tx.Fee
+	}
+	if block != nil {
+		res["blockhash"] = block.Hash
+		res["confirmations"] = len(n.blocks) - block.Height
+		res["time"] = block.Time.Unix()
+		res["blocktime"] = block.Time.Unix()
+	}
+	return res
+}
+
+func scriptPubKeyJSON() map[string]interface{} {
+	return map[string]interface{}{
+		"asm":  "OP_DUP OP_HASH160 0000000000000000000000000000000000000000 OP_EQUALVERIFY OP_CHECKSIG",
+		"hex":  "76a914000000000000000000000000000000000000000088ac",
+		"type": "pubkeyhash",
+	}
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/Ekliptor/cashwhale/internal/watcher"
+	"testing"
+)
+
+func TestThresholdWhales(t *testing.T) {
+	h := newHarness(t, watcher.Thresholds{
+		WhaleBch:       1000.0,
+		UpperTxPercent: 0.1,
+		MinTxCount:     1000000, // only the fixed threshold
+	})
+
+	h.mine(h.node.NewTx(1.5, 0.3), h.node.NewTx(999.0))
+	whale := h.node.NewTx(24000.0, 1000.0)
+	h.mine(h.node.NewTx(12.0), whale)
+	published := h.expectPublished(whale.Txid)
+	h.expectNothingPublished()
+
+	tx := published[0]
+	expected := fmt.Sprintf("25,000 #BitcoinCashRegtest #rBCH (7,500,000 USD)\n\nTX: https://explorer.test/tx/%s", whale.Txid)
+	if tx.Message != expected {
+		t.Errorf("Unexpected message:\n%s\nexpected:\n%s", tx.Message, expected)
+	}
+	if tx.Rule != watcher.RULE_THRESHOLD || !tx.Confirmed || tx.Network != "regtest" {
+		t.Errorf("Unexpected whale data %+v", tx)
+	}
+
+	// multiple whales in 1 block are published in block order
+	first, second := h.node.NewTx(1000.0), h.node.NewTx(5000.0, 2.0)
+	h.mine(first, h.node.NewTx(3.0), second)
+	h.expectPublished(first.Txid, second.Txid)
+	h.expectNothingPublished()
+}
+
+func TestUpperPercentWhales(t *testing.T) {
+	h := newHarness(t, watcher.Thresholds{
+		WhaleBch:       100000.0,
+		UpperTxPercent: 10.0,
+		MinTxCount:     20,
+	})
+
+	// decreasing sizes, so no TX is in the upper percent of the TX before it
+	txs := make([]*fakeTx, 0, 30)
+	for i := 40; i > 10; i-- {
+		txs = append(txs, h.node.NewTx(float64(i)))
+	}
+	h.mine(txs...)
+
+	whale := h.node.NewTx(500.0)
+	h.mine(whale, h.node.NewTx(1.0))
+	published := h.expectPublished(whale.Txid)
+	h.expectNothingPublished()
+	if published[0].Rule != watcher.RULE_UPPER_PERCENT {
+		t.Errorf("Expected whale of rule %s, got %s", watcher.RULE_UPPER_PERCENT, published[0].Rule)
+	}
+}
+
+func TestSuppressedWhale(t *testing.T) {
+	h := newHarness(t, watcher.Thresholds{
+		WhaleBch:       1000.0,
+		UpperTxPercent: 0.1,
+		MinTxCount:     1000000,
+	})
+
+	suppressed, whale := h.node.NewTx(2000.0), h.node.NewTx(3000.0)
+	h.msgBuilder.SuppressTransaction(suppressed.Txid)
+	h.mine(suppressed, whale)
+	h.expectPublished(whale.Txid)
+	h.expectNothingPublished()
+}
+
+func TestCoinbaseIsNoWhale(t *testing.T) {
+	h := newHarness(t, watcher.Thresholds{
+		WhaleBch:       5.0,
+		UpperTxPercent: 0.1,
+		MinTxCount:     1000000,
+	})
+
+	// every block starts with a coinbase TX of 6.25 BCH
+	whale := h.node.NewTx(6.0)
+	h.mine(whale)
+	h.expectPublished(whale.Txid)
+	h.expectNothingPublished()
+}
+
+func TestRuleTypes(t *testing.T) {
+	h := newHarness(t, watcher.Thresholds{
+		WhaleBch:       1000.0,
+		UpperTxPercent: 0.1,
+		MinTxCount:     1000000,
+	})
+	err := h.watcher.SetRuleTypes(map[string]*watcher.RuleTypes{
+		watcher.RULE_THRESHOLD: {Exclude: []watcher.TxType{watcher.TX_BATCH_PAYOUT}},
+	})
+	if err != nil {
+		t.Fatalf("Error setting rule types: %+v", err)
+	}
+
+	payouts := make([]float64, 25)
+	for i := range payouts {
+		payouts[i] = 100.0
+	}
+	whale := h.node.NewTx(1500.0, 2.0)
+	h.mine(h.node.NewTx(payouts...), whale)
+	published := h.expectPublished(whale.Txid)
+	h.expectNothingPublished()
+	if published[0].TxType != string(watcher.TX_TRANSFER) {
+		t.Errorf("Expected whale of type %s, got %s", watcher.TX_TRANSFER, published[0].TxType)
+	}
+}